@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// identityAliases are the additional names and e-mail addresses that
+// identify a member in commits.
+type identityAliases struct {
+	Names  uniqueStringSlice `json:"names,omitempty"`
+	Emails uniqueStringSlice `json:"emails,omitempty"`
+}
+
+// aliases are the identity aliases keyed by lower-cased GitHub login.
+type aliases map[string]*identityAliases
+
+// decode decodes an alias file into the aliases object. Each line is a
+// login followed by its names and e-mail addresses.
+//
+//	akutz: Andrew Kutz, akutz@vmware.com, sakutz@gmail.com
+func (a aliases) decode(r io.Reader) error {
+	var (
+		scan    = bufio.NewScanner(r)
+		aliasRX = regexp.MustCompile(`^([^:\s]+)\s*:\s*(.*)$`)
+	)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := aliasRX.FindStringSubmatch(line)
+		if len(match) != 3 {
+			return fmt.Errorf("error matching alias: %s", line)
+		}
+		login := strings.ToLower(match[1])
+		ia, ok := a[login]
+		if !ok {
+			ia = &identityAliases{}
+			a[login] = ia
+		}
+		for _, v := range strings.Split(match[2], ",") {
+			if v = strings.TrimSpace(v); strings.Contains(v, "@") {
+				ia.Emails.append(v)
+			} else {
+				ia.Names.append(v)
+			}
+		}
+	}
+	return scan.Err()
+}
+
+// getAliases reads the alias file specified with -alias-file.
+func getAliases(opts options) (aliases, error) {
+	a := aliases{}
+	if opts.config.AliasFile == "" {
+		return a, nil
+	}
+	f, err := os.Open(opts.config.AliasFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := a.decode(f); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// names returns the name aliases for the login.
+func (a aliases) names(login string) []string {
+	if ia, ok := a[strings.ToLower(login)]; ok {
+		return ia.Names
+	}
+	return nil
+}
+
+func (m *member) loadFromAliases(opts options) {
+	if ia, ok := opts.aliases[strings.ToLower(m.Login)]; ok {
+		for _, email := range ia.Emails {
+			m.Emails.append(email)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultAPIBaseURL is the base URL of GitHub's REST API.
+	defaultAPIBaseURL = "https://api.github.com/"
+
+	// appMediaType is the media type of the GitHub App endpoints.
+	appMediaType = "application/vnd.github.machine-man-preview+json"
+
+	// appTokenRefresh is how long before an installation token expires
+	// that it is replaced.
+	appTokenRefresh = time.Duration(5) * time.Minute
+)
+
+// parseAppPrivateKey parses a GitHub App's PEM-encoded RSA private key,
+// which may be PKCS #1 or PKCS #8.
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid private key: no PEM data")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid private key: not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// appJWT returns a JSON Web Token that authenticates as the GitHub App.
+// The token is issued a minute in the past to allow for clock drift and
+// expires after nine minutes, within GitHub's limit of ten.
+func appJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// appTokenSource returns installation tokens for a GitHub App. It should
+// be wrapped with oauth2.ReuseTokenSource so that a new installation token
+// is only requested when the previous one is about to expire.
+type appTokenSource struct {
+	ctx     context.Context
+	client  *http.Client
+	baseURL string
+	appID   int64
+	key     *rsa.PrivateKey
+
+	// org is the org in which the app is installed. It is used to find
+	// the installation if installationID is zero.
+	org string
+
+	mu             sync.Mutex
+	installationID int64
+
+	// now may be replaced by tests.
+	now func() time.Time
+}
+
+func newAppTokenSource(
+	ctx context.Context, client *http.Client, opts options) (oauth2.TokenSource, error) {
+
+	app := opts.config.GitHub.App
+	if app.PrivateKeyFile == "" {
+		return nil, errors.New("-app-private-key is required with -app-id")
+	}
+	data, err := ioutil.ReadFile(app.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseAppPrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	src := &appTokenSource{
+		ctx:            ctx,
+		client:         client,
+		baseURL:        apiBaseURL(opts),
+		appID:          app.ID,
+		key:            key,
+		org:            opts.config.MemberOrg,
+		installationID: app.InstallationID,
+		now:            time.Now,
+	}
+	credential := fmt.Sprintf("app %d org %s", app.ID, src.org)
+	if app.InstallationID != 0 {
+		credential = fmt.Sprintf(
+			"app %d installation %d", app.ID, app.InstallationID)
+	}
+	return credentialTokenSource{
+		TokenSource: oauth2.ReuseTokenSource(nil, src),
+		id:          credential,
+	}, nil
+}
+
+// do makes a request authenticated as the app and decodes the response.
+func (s *appTokenSource) do(method, urlPath string, v interface{}) error {
+	jwt, err := appJWT(s.appID, s.key, s.now())
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(s.baseURL, "/") + "/" + urlPath
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(s.ctx)
+	req.Header.Set("Accept", appMediaType)
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	rep, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rep.Body.Close()
+	body, err := ioutil.ReadAll(rep.Body)
+	if err != nil {
+		return err
+	}
+	if rep.StatusCode > 299 {
+		return fmt.Errorf(
+			"%s %s: %s: %s",
+			method, u, rep.Status, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// getInstallationID returns the ID of the app's installation, which is
+// looked up in the org if it was not configured.
+func (s *appTokenSource) getInstallationID() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.installationID != 0 {
+		return s.installationID, nil
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := s.do(
+		http.MethodGet,
+		fmt.Sprintf("orgs/%s/installation", s.org),
+		&installation); err != nil {
+		return 0, fmt.Errorf(
+			"error finding the app installation for %s: %v", s.org, err)
+	}
+	s.installationID = installation.ID
+	return s.installationID, nil
+}
+
+// Token returns a new installation token. The token's expiry is moved up
+// by appTokenRefresh so that it is replaced before calls made with it
+// could fail.
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	id, err := s.getInstallationID()
+	if err != nil {
+		return nil, err
+	}
+	var tok struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := s.do(
+		http.MethodPost,
+		fmt.Sprintf("app/installations/%d/access_tokens", id),
+		&tok); err != nil {
+		return nil, fmt.Errorf("error creating an installation token: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: tok.Token,
+		TokenType:   "token",
+		Expiry:      tok.ExpiresAt.Add(-appTokenRefresh),
+	}, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAppTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if key, err = parseAppPrivateKey(pemKey); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lookups   int
+		created   int
+		expiresIn time.Duration
+	)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			// Verify the JWT's signature and issuer.
+			jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			parts := strings.Split(jwt, ".")
+			if len(parts) != 3 {
+				http.Error(w, "invalid jwt", http.StatusUnauthorized)
+				return
+			}
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if err := rsa.VerifyPKCS1v15(
+				&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			var claims map[string]int64
+			buf, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			json.Unmarshal(buf, &claims)
+			if claims["iss"] != 1234 || claims["exp"] <= claims["iat"] {
+				http.Error(w, "invalid claims", http.StatusUnauthorized)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/orgs/VMware/installation":
+				lookups++
+				fmt.Fprint(w, `{"id":42}`)
+			case "/app/installations/42/access_tokens":
+				created++
+				fmt.Fprintf(w, `{"token":"token-%d","expires_at":%q}`,
+					created,
+					time.Now().Add(expiresIn).UTC().Format(time.RFC3339))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	defer s.Close()
+
+	newSource := func() oauth2.TokenSource {
+		return oauth2.ReuseTokenSource(nil, &appTokenSource{
+			ctx:     context.Background(),
+			client:  s.Client(),
+			baseURL: s.URL,
+			appID:   1234,
+			key:     key,
+			org:     "VMware",
+			now:     time.Now,
+		})
+	}
+
+	// The installation token is reused until it is about to expire.
+	expiresIn = time.Hour
+	src := newSource()
+	for i := 0; i < 2; i++ {
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.AccessToken != "token-1" {
+			t.Fatalf("%d: token=%s", i, tok.AccessToken)
+		}
+	}
+	if lookups != 1 || created != 1 {
+		t.Fatalf("lookups=%d created=%d", lookups, created)
+	}
+
+	// A token that expires within appTokenRefresh is replaced, but the
+	// installation is not looked up again.
+	expiresIn = appTokenRefresh - time.Minute
+	src = newSource()
+	for i := 2; i <= 3; i++ {
+		tok, err := src.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := fmt.Sprintf("token-%d", i); tok.AccessToken != exp {
+			t.Fatalf("token: exp=%s act=%s", exp, tok.AccessToken)
+		}
+	}
+	if lookups != 2 || created != 3 {
+		t.Fatalf("lookups=%d created=%d", lookups, created)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// areaRule is a named area of a repository described by path globs.
+type areaRule struct {
+	Name  string
+	Globs []string
+}
+
+// areaClassifier assigns the paths of changed files to areas. A path
+// belongs to the first area with a matching glob, otherwise the directory
+// of the nearest OWNERS file, otherwise its top-level directory.
+type areaClassifier struct {
+	rules []areaRule
+
+	// owners is the set of directories with an OWNERS file, keyed by
+	// repository.
+	owners map[string]map[string]struct{}
+}
+
+// decode decodes an area file into the classifier. Each line is an area
+// followed by its path globs.
+//
+//	kubelet: pkg/kubelet/**, cmd/kubelet/**
+//	generated: **/zz_generated.*.go
+func (c *areaClassifier) decode(r io.Reader) error {
+	var (
+		scan   = bufio.NewScanner(r)
+		areaRX = regexp.MustCompile(`^([^:]+?)\s*:\s*(.*)$`)
+	)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := areaRX.FindStringSubmatch(line)
+		if len(match) != 3 {
+			return fmt.Errorf("error matching area: %s", line)
+		}
+		rule := areaRule{Name: match[1]}
+		for _, glob := range strings.Split(match[2], ",") {
+			if glob = strings.TrimSpace(glob); glob == "" {
+				continue
+			}
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("invalid area glob: %s: %v", glob, err)
+			}
+			rule.Globs = append(rule.Globs, glob)
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return scan.Err()
+}
+
+// getAreaClassifier reads the area file specified with -area-file and,
+// unless disabled, finds the OWNERS files in the targets.
+func getAreaClassifier(
+	ctx context.Context, opts options) (*areaClassifier, error) {
+
+	c := &areaClassifier{owners: map[string]map[string]struct{}{}}
+
+	if filePath := opts.config.Areas.File; filePath != "" {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := c.decode(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.config.Areas.NoOwners {
+		return c, nil
+	}
+	for _, t := range opts.targets {
+		if t.GitDir == "" || t.Head == "" {
+			continue
+		}
+		out, err := gitOutput(
+			ctx, opts,
+			"--git-dir", t.GitDir, "ls-tree", "-r", "--name-only", t.Head)
+		if err != nil {
+			return nil, err
+		}
+		dirs := map[string]struct{}{}
+		for _, filePath := range strings.Split(out, "\n") {
+			if path.Base(filePath) == "OWNERS" {
+				dirs[path.Dir(filePath)] = struct{}{}
+			}
+		}
+		c.owners[t.String()] = dirs
+	}
+
+	return c, nil
+}
+
+// classify returns the area of the path in the repository.
+func (c *areaClassifier) classify(repo, filePath string) string {
+	for _, rule := range c.rules {
+		for _, glob := range rule.Globs {
+			if matchGlob(glob, filePath) {
+				return rule.Name
+			}
+		}
+	}
+	if dirs, ok := c.owners[repo]; ok {
+		for dir := path.Dir(filePath); ; dir = path.Dir(dir) {
+			if _, ok := dirs[dir]; ok {
+				return dir
+			}
+			if dir == "." || dir == "/" {
+				break
+			}
+		}
+	}
+	if i := strings.Index(filePath, "/"); i > 0 {
+		return filePath[:i]
+	}
+	return "."
+}
+
+// matchGlob returns a flag indicating whether or not the path matches the
+// glob. The glob's segments are matched with path.Match, except for "**",
+// which matches zero or more segments.
+func matchGlob(glob, filePath string) bool {
+	return matchGlobSegments(
+		strings.Split(glob, "/"), strings.Split(filePath, "/"))
+}
+
+func matchGlobSegments(glob, segs []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchGlobSegments(glob[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], segs[0]); !ok {
+			return false
+		}
+		glob, segs = glob[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+var renameBracesRX = regexp.MustCompile(`\{([^{}]*) => ([^{}]*)\}`)
+
+// numstatPath returns the path of a file after it was changed. The paths
+// of renamed files in "git log --numstat" are formatted as
+// "dir/{old => new}/file" or "old => new".
+func numstatPath(p string) string {
+	if !strings.Contains(p, " => ") {
+		return p
+	}
+	if renameBracesRX.MatchString(p) {
+		p = renameBracesRX.ReplaceAllString(p, "$2")
+		return path.Clean(p)
+	}
+	return p[strings.Index(p, " => ")+4:]
+}
+
+// areaStats is a member's commit activity in an area of a repository.
+type areaStats struct {
+	Repo      string `json:"repo"`
+	Area      string `json:"area"`
+	Commits   int    `json:"commits"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+
+	EffectiveAdditions int `json:"effectiveAdditions"`
+	EffectiveDeletions int `json:"effectiveDeletions"`
+}
+
+// areaReport returns the member's authored commit activity by area,
+// sorted by repository and area. A commit that touches more than one
+// area is counted once in each area.
+func (m member) areaReport(opts options) []areaStats {
+	if opts.areas == nil {
+		return nil
+	}
+
+	type areaKey struct{ repo, area string }
+	stats := map[areaKey]*areaStats{}
+
+	for _, c := range m.Commits {
+		if c.CoAuthored {
+			continue
+		}
+		touched := map[areaKey]struct{}{}
+		for _, ce := range c.Changes {
+			key := areaKey{
+				repo: c.Repo,
+				area: opts.areas.classify(c.Repo, numstatPath(ce.Path)),
+			}
+			s, ok := stats[key]
+			if !ok {
+				s = &areaStats{Repo: key.repo, Area: key.area}
+				stats[key] = s
+			}
+			s.Additions += ce.Add
+			s.Deletions += ce.Del
+			if !opts.exclusions.excluded(c.Repo, ce) {
+				s.EffectiveAdditions += ce.Add
+				s.EffectiveDeletions += ce.Del
+			}
+			if _, ok := touched[key]; !ok {
+				touched[key] = struct{}{}
+				s.Commits++
+			}
+		}
+	}
+
+	report := make([]areaStats, 0, len(stats))
+	for _, s := range stats {
+		report = append(report, *s)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Repo != report[j].Repo {
+			return report[i].Repo < report[j].Repo
+		}
+		return report[i].Area < report[j].Area
+	})
+	return report
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAreaClassifier(t *testing.T) {
+	c := &areaClassifier{
+		owners: map[string]map[string]struct{}{
+			"kubernetes/kubernetes": {
+				".":              {},
+				"pkg/kubelet":    {},
+				"pkg/kubelet/cm": {},
+			},
+		},
+	}
+	if err := c.decode(strings.NewReader(`
+# Generated code is its own area.
+generated: **/zz_generated.*.go
+cloud: pkg/cloudprovider/providers/vsphere/**, cmd/vsphere*
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		repo string
+		path string
+		area string
+	}{
+		{"kubernetes/kubernetes", "pkg/api/zz_generated.deepcopy.go", "generated"},
+		{"kubernetes/kubernetes", "zz_generated.deepcopy.go", "generated"},
+		{"kubernetes/kubernetes", "pkg/cloudprovider/providers/vsphere/vs.go", "cloud"},
+		{"kubernetes/kubernetes", "cmd/vsphere-tool", "cloud"},
+		{"kubernetes/kubernetes", "pkg/kubelet/cm/cpu/cpu.go", "pkg/kubelet/cm"},
+		{"kubernetes/kubernetes", "pkg/kubelet/kubelet.go", "pkg/kubelet"},
+		{"kubernetes/kubernetes", "pkg/api/types.go", "."},
+		{"kubernetes/kubernetes", "README.md", "."},
+		{"kubernetes/test-infra", "prow/cmd/hook/main.go", "prow"},
+		{"kubernetes/test-infra", "README.md", "."},
+	}
+
+	for _, tc := range testCases {
+		if area := c.classify(tc.repo, tc.path); area != tc.area {
+			t.Errorf("classify(%s, %s)=%s, expected %s",
+				tc.repo, tc.path, area, tc.area)
+		}
+	}
+}
+
+func TestNumstatPath(t *testing.T) {
+	testCases := map[string]string{
+		"pkg/kubelet/kubelet.go":              "pkg/kubelet/kubelet.go",
+		"pkg/{kubelet => kubeletv2}/types.go": "pkg/kubeletv2/types.go",
+		"pkg/{ => kubelet}/types.go":          "pkg/kubelet/types.go",
+		"pkg/{kubelet => }/types.go":          "pkg/types.go",
+		"old.go => new.go":                    "new.go",
+	}
+	for p, exp := range testCases {
+		if v := numstatPath(p); v != exp {
+			t.Errorf("numstatPath(%s)=%s, expected %s", p, v, exp)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// cacheCategory is a kind of data cached in the output directory.
+type cacheCategory struct {
+	name        string
+	description string
+
+	// files returns the paths of the cached files or directories.
+	files func(outputDir string) ([]string, error)
+}
+
+// cacheDir returns a function that returns the cache directory with the
+// given name if it exists.
+func cacheDir(name string) func(string) ([]string, error) {
+	return func(outputDir string) ([]string, error) {
+		return existingFiles(path.Join(outputDir, ".cache", name))
+	}
+}
+
+func existingFiles(filePaths ...string) ([]string, error) {
+	var existing []string
+	for _, filePath := range filePaths {
+		ok, err := fileExists(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			existing = append(existing, filePath)
+		}
+	}
+	return existing, nil
+}
+
+var cacheCategories = []cacheCategory{
+	{
+		"members",
+		"The members and their activity",
+		cachedMemberFiles,
+	},
+	{
+		"affiliates",
+		"The developer affiliations file",
+		func(outputDir string) ([]string, error) {
+			return existingFiles(
+				path.Join(outputDir, "."+affiliationsFileName))
+		},
+	},
+	{"repos", "The repositories of the target orgs", cacheDir("repos")},
+	{"git", "The mirrors of the target repositories", cacheDir("git")},
+	{"index", "The commit indexes of the target repositories", cacheDir("index")},
+	{"reviews", "The reviews of the target repositories", cacheDir("reviews")},
+	{"http", "The responses of the GitHub API", cacheDir("http")},
+}
+
+func findCacheCategory(name string) (cacheCategory, bool) {
+	for _, c := range cacheCategories {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return cacheCategory{}, false
+}
+
+// diskUsage returns the number of regular files at or beneath the path
+// and their total size in bytes.
+func diskUsage(root string) (int, int64, error) {
+	var (
+		n    int
+		size int64
+	)
+	err := filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			n++
+			size += fi.Size()
+		}
+		return nil
+	})
+	return n, size, err
+}
+
+// formatBytes returns the size using the largest binary unit in which it
+// is at least one, ex. 1.5 MiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// cacheInfo writes the number of files and the size of each category.
+func cacheInfo(w io.Writer, outputDir string) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CATEGORY\tFILES\tSIZE\tDESCRIPTION")
+	var (
+		total     int
+		totalSize int64
+	)
+	for _, c := range cacheCategories {
+		filePaths, err := c.files(outputDir)
+		if err != nil {
+			return err
+		}
+		var (
+			n    int
+			size int64
+		)
+		for _, filePath := range filePaths {
+			fn, fsize, err := diskUsage(filePath)
+			if err != nil {
+				return err
+			}
+			n += fn
+			size += fsize
+		}
+		total += n
+		totalSize += size
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n",
+			c.name, n, formatBytes(size), c.description)
+	}
+	fmt.Fprintf(tw, "total\t%d\t%s\t\n", total, formatBytes(totalSize))
+	return tw.Flush()
+}
+
+// cacheClean removes the cached files of the categories.
+func cacheClean(w io.Writer, outputDir string, categories []cacheCategory) error {
+	for _, c := range categories {
+		filePaths, err := c.files(outputDir)
+		if err != nil {
+			return err
+		}
+		sort.Strings(filePaths)
+		for _, filePath := range filePaths {
+			if err := os.RemoveAll(filePath); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(w, "removed %d %s\n", len(filePaths), c.name)
+	}
+	return nil
+}
+
+func newCacheFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := newFlagSet(
+		"cache", "cache [FLAGS] info|clean [CATEGORY...]",
+		"The info command shows the number of files and the size of\n"+
+			"each category of the cache. The clean command removes the\n"+
+			"cache of the given categories, or \"all\" of them.")
+	addConfigFlag(fs)
+	fs.StringVar(
+		&opts.config.OutputDir, "output", opts.config.OutputDir,
+		"The output directory")
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(fs.Output(), "\nCATEGORIES")
+		for _, c := range cacheCategories {
+			fmt.Fprintf(fs.Output(), "  %-10s %s\n", c.name, c.description)
+		}
+	}
+	return fs
+}
+
+// cacheAction returns the action in the args and the args without it.
+// The flags may precede or follow the action, so the flags are parsed
+// with a scratch flag set to find it.
+func cacheAction(args []string) (string, []string) {
+	fs := newCacheFlagSet(&cliFlags{}, &options{})
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	if fs.Parse(args) != nil || fs.NArg() == 0 {
+		return "", args
+	}
+	n := len(args) - fs.NArg()
+	return fs.Arg(0), append(args[:n:n], fs.Args()[1:]...)
+}
+
+func cacheMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	action, args := cacheAction(args)
+	if err := initConfig(args, newCacheFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newCacheFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+
+	var err error
+	switch action {
+	case "info":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			return 1
+		}
+		err = cacheInfo(os.Stdout, opts.config.OutputDir)
+	case "clean":
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return 1
+		}
+		var categories []cacheCategory
+		for _, name := range fs.Args() {
+			if name == "all" {
+				categories = cacheCategories
+				break
+			}
+			c, ok := findCacheCategory(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Invalid category: %s\n", name)
+				fs.Usage()
+				return 1
+			}
+			categories = append(categories, c)
+		}
+		err = cacheClean(os.Stdout, opts.config.OutputDir, categories)
+	default:
+		fs.Usage()
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeCache
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCacheClean(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for fileName, data := range map[string]string{
+		"akutz.json":           `{"login":"akutz"}`,
+		"impact.json":          "{}",
+		"report.json":          "{}",
+		"report-metadata.json": "{}",
+		path.Join(".cache", "repos", "vmware.json"):             "{}",
+		path.Join(".cache", "reviews", "vmware", "impact.json"): "{}",
+	} {
+		filePath := path.Join(tmpDir, fileName)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := &bytes.Buffer{}
+	if err := cacheInfo(w, tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if total := strings.Fields(lines[len(lines)-1]); total[1] != "3" {
+		t.Fatalf("info:\n%s", w)
+	}
+
+	members, _ := findCacheCategory("members")
+	reviews, _ := findCacheCategory("reviews")
+	w.Reset()
+	if err := cacheClean(
+		w, tmpDir, []cacheCategory{members, reviews}); err != nil {
+		t.Fatal(err)
+	}
+	if w.String() != "removed 1 members\nremoved 1 reviews\n" {
+		t.Fatalf("clean:\n%s", w)
+	}
+
+	// The reports, the other JSON files and the other categories are not
+	// removed.
+	for fileName, exists := range map[string]bool{
+		"akutz.json":                   false,
+		"impact.json":                  true,
+		"report.json":                  true,
+		"report-metadata.json":         true,
+		path.Join(".cache", "repos"):   true,
+		path.Join(".cache", "reviews"): false,
+	} {
+		ok, err := fileExists(path.Join(tmpDir, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != exists {
+			t.Errorf("%s: exists=%v", fileName, ok)
+		}
+	}
+}
+
+func TestCacheMainConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := path.Join(tmpDir, "impact.json")
+	outputDir := path.Join(tmpDir, "file")
+	if err := ioutil.WriteFile(
+		configPath, []byte(`{"output-dir":"`+outputDir+`"}`),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	if os.Stdout, err = os.Open(os.DevNull); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Stdout.Close()
+
+	// The output directory is read from the config file or from the
+	// environment, and the flags may precede or follow the action.
+	for _, tc := range []struct {
+		name      string
+		env       string
+		args      []string
+		outputDir string
+	}{
+		{
+			name:      "config",
+			args:      []string{"clean", "-config", configPath, "members"},
+			outputDir: outputDir,
+		},
+		{
+			name:      "env",
+			env:       path.Join(tmpDir, "env"),
+			args:      []string{"clean", "members"},
+			outputDir: path.Join(tmpDir, "env"),
+		},
+		{
+			name: "flag",
+			env:  path.Join(tmpDir, "env"),
+			args: []string{
+				"-output", path.Join(tmpDir, "flag"), "clean", "members",
+			},
+			outputDir: path.Join(tmpDir, "flag"),
+		},
+	} {
+		filePath := path.Join(tc.outputDir, ".cache", "members", "akutz.json")
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if tc.env != "" {
+			os.Setenv("GITHUB_IMPACT_OUTPUT", tc.env)
+		} else {
+			os.Unsetenv("GITHUB_IMPACT_OUTPUT")
+		}
+		if code := cacheMain(tc.args); code != 0 {
+			t.Errorf("%s: exit code %d", tc.name, code)
+		}
+		if ok, err := fileExists(filePath); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Errorf("%s: %s was not removed", tc.name, filePath)
+		}
+	}
+	os.Unsetenv("GITHUB_IMPACT_OUTPUT")
+}
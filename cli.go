@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// command is one of the program's commands, ex. "fetch" or "report".
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands are the program's commands in the order they are listed by
+// the usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"fetch", "Update the cache of members and their activity", fetchMain},
+		{"report", "Write the reports from the cache", reportMain},
+		{"diff", "Compare two reports or caches", diffMain},
+		{"cache", "Show or remove the cache", cacheMain},
+		{"serve", "Serve the reports over HTTP", serveMain},
+		{"help", "Show the usage of a command", helpMain},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// newFlagSet returns a flag set for the command. The usage of the flag set
+// is the command's synopsis, its description and its flags.
+func newFlagSet(name, synopsis, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s %s\n\n", os.Args[0], synopsis)
+		if description != "" {
+			fmt.Fprintf(fs.Output(), "%s\n\n", description)
+		}
+		fmt.Fprintln(fs.Output(), "FLAGS")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// addConfigFlag adds the config file, which provides the defaults of the
+// other flags.
+func addConfigFlag(fs *flag.FlagSet) {
+	// The config file is loaded by initConfig before the flags are added
+	// so that its values are the flags' defaults.
+	fs.String(
+		"config", os.Getenv(configEnvVar),
+		"A JSON or YAML file with the default values of the flags. "+
+			"The values may be overridden by environment variables "+
+			"named after the flags, ex. "+envFlagName("output"))
+}
+
+// addCommonFlags adds the flags that select the members and targets and
+// the cache in which their activity is stored.
+func addCommonFlags(fs *flag.FlagSet, opts *options) {
+	addConfigFlag(fs)
+	fs.StringVar(
+		&opts.config.OutputDir, "output", opts.config.OutputDir,
+		"The output directory")
+	fs.StringVar(
+		&opts.config.MemberOrg, "member-org", opts.config.MemberOrg,
+		"The source GitHub org")
+	fs.StringVar(
+		&opts.config.TargetOrg, "target-org", opts.config.TargetOrg,
+		"The targeted GitHub org")
+	fs.StringVar(
+		&opts.config.TargetRepo, "target-repo", opts.config.TargetRepo,
+		"The targeted GitHub repo")
+	fs.Var(
+		newDefaultStringSliceFlag(&opts.config.Targets), "target",
+		"A targeted GitHub repo in the format ORG/REPO[=GIT_DIR]. "+
+			"The REPO may be * to target all of the org's repos. "+
+			"May be specified more than once and overrides "+
+			"-target-org, -target-repo and -target-git-dir")
+	fs.BoolVar(
+		&opts.config.Resume, "resume", opts.config.Resume,
+		"Resume at the specified member name. An errors occurs if "+
+			"more than one username is specified.")
+	fs.BoolVar(
+		&opts.config.UTC, "utc", opts.config.UTC,
+		"Print timestamps using UTC")
+	fs.StringVar(
+		&opts.config.AliasFile, "alias-file", opts.config.AliasFile,
+		"A file that maps GitHub logins to the additional names and "+
+			"e-mail addresses used in their commits, one login per line "+
+			"as LOGIN: NAME_OR_EMAIL[, NAME_OR_EMAIL...]")
+
+	fs.StringVar(
+		&opts.config.Areas.File, "area-file", opts.config.Areas.File,
+		"A file that maps area names to the path globs they contain, "+
+			"one area per line as AREA: GLOB[, GLOB...]")
+	fs.BoolVar(
+		&opts.config.Areas.NoOwners, "no-area-owners",
+		opts.config.Areas.NoOwners,
+		"Do not assign paths to the area of their nearest OWNERS file")
+
+	fs.Var(
+		newDefaultStringSliceFlag(&opts.config.Exclusions.Globs), "exclude",
+		"A glob of paths excluded from effective additions and deletions. "+
+			"May be specified more than once")
+	fs.BoolVar(
+		&opts.config.Exclusions.NoDefaults, "no-default-exclusions",
+		opts.config.Exclusions.NoDefaults,
+		"Do not exclude vendored, generated and lock files from "+
+			"effective additions and deletions")
+
+	// Check to see if the git command is in the path.
+	if exec.Command("git", "version").Run() == nil {
+		fs.StringVar(
+			&opts.config.Git.TargetDir, "target-git-dir",
+			opts.config.Git.TargetDir,
+			"The path to the git directory to search for commit activity. "+
+				"Defaults to a mirror managed in the output directory")
+		fs.BoolVar(
+			&opts.config.Git.Disabled, "no-git", opts.config.Git.Disabled,
+			"Do not write git commit activity")
+		fs.IntVar(
+			&opts.config.Git.Max, "git-max", opts.config.Git.Max,
+			"Number of max concurrent git commands")
+	} else {
+		opts.config.Git.Disabled = true
+	}
+}
+
+// addFetchFlags adds the flags that control how the cache is updated.
+func addFetchFlags(fs *flag.FlagSet, cf *cliFlags, opts *options) {
+	fs.BoolVar(
+		&opts.config.NoAffiliates, "no-fetch-affiliates",
+		opts.config.NoAffiliates,
+		"Do not update the local developer affiliations file "+
+			"(https://goo.gl/ux4PVs)")
+
+	fs.StringVar(
+		&opts.config.LDAP.Host, "ldap-host", opts.config.LDAP.Host,
+		"The LDAP host used to supplement e-mail addresses")
+	fs.BoolVar(
+		&opts.config.LDAP.Disabled, "no-ldap", opts.config.LDAP.Disabled,
+		"Disable LDAP lookups")
+	fs.BoolVar(
+		&opts.config.LDAP.TLS.Insecure, "ldap-tls-insecure",
+		opts.config.LDAP.TLS.Insecure,
+		"Enable LDAP TLS insecure mode")
+
+	fs.BoolVar(
+		&opts.config.GitHub.NoUsers, "no-fetch-users",
+		opts.config.GitHub.NoUsers,
+		"Do not update local user cache")
+	fs.BoolVar(
+		&opts.config.GitHub.NoIssues, "no-fetch-issues",
+		opts.config.GitHub.NoIssues,
+		"Do not update local issue cache")
+	fs.BoolVar(
+		&opts.config.GitHub.NoPullRequests, "no-fetch-pull-requests",
+		opts.config.GitHub.NoPullRequests,
+		"Do not update local pull request cache")
+	fs.BoolVar(
+		&opts.config.GitHub.NoReviews, "no-fetch-reviews",
+		opts.config.GitHub.NoReviews,
+		"Do not update local pull request review cache")
+	fs.StringVar(
+		&opts.config.GitHub.TokenFile, "token-file",
+		opts.config.GitHub.TokenFile,
+		"A file with GitHub API keys, one per line, that are used in "+
+			"addition to the keys in GITHUB_API_KEY. Each API call uses "+
+			"the key with the most remaining calls")
+	fs.Int64Var(
+		&opts.config.GitHub.App.ID, "app-id", opts.config.GitHub.App.ID,
+		"The ID of a GitHub App whose installation token is used for "+
+			"API calls. Requires -app-private-key")
+	fs.Int64Var(
+		&opts.config.GitHub.App.InstallationID, "app-installation-id",
+		opts.config.GitHub.App.InstallationID,
+		"The ID of the GitHub App's installation. Defaults to the "+
+			"installation in -member-org")
+	fs.StringVar(
+		&opts.config.GitHub.App.PrivateKeyFile, "app-private-key",
+		opts.config.GitHub.App.PrivateKeyFile,
+		"The path to the GitHub App's PEM-encoded private key")
+	fs.StringVar(
+		&opts.config.GitHub.BaseURL, "api-url",
+		opts.config.GitHub.BaseURL,
+		"The base URL of a GitHub Enterprise Server's REST API, ex. "+
+			"https://github.example.com/api/v3/. Defaults to "+
+			defaultAPIBaseURL)
+	fs.StringVar(
+		&opts.config.GitHub.UploadURL, "upload-url",
+		opts.config.GitHub.UploadURL,
+		"The upload URL of a GitHub Enterprise Server. Defaults to "+
+			"-api-url with /api/v3/ replaced by /api/uploads/")
+	fs.StringVar(
+		&opts.config.GitHub.CAFile, "ca-file",
+		opts.config.GitHub.CAFile,
+		"A PEM-encoded CA bundle that is trusted in addition to the "+
+			"system's certificates for API calls and git mirrors")
+	fs.BoolVar(
+		&opts.config.GitHub.NoCache, "no-api-cache",
+		opts.config.GitHub.NoCache,
+		"Do not cache the API responses. Cached responses are "+
+			"revalidated with conditional requests, which do not count "+
+			"against the rate limit when the response has not changed")
+	fs.IntVar(
+		&opts.config.GitHub.API.Max, "api-max", opts.config.GitHub.API.Max,
+		"Number of max concurrent API calls")
+	fs.IntVar(
+		&opts.config.GitHub.API.Retries, "api-retries",
+		opts.config.GitHub.API.Retries,
+		"Number of retries for a failed API call")
+	fs.StringVar(
+		&cf.apiWait, "api-wait", opts.config.GitHub.API.Wait.String(),
+		"Duration of time to wait between API calls")
+	fs.StringVar(
+		&cf.apiRetryWait, "api-retry-wait",
+		opts.config.GitHub.API.RetryWait.String(),
+		"Duration of time to wait between failed API calls when the "+
+			"response header \"Retry-After\" is missing")
+	fs.BoolVar(
+		&opts.config.GitHub.API.ShowRateLimit, "show-rate-limit",
+		opts.config.GitHub.API.ShowRateLimit,
+		"Shows the rate limit info after all API calls")
+
+	// The git flags are only added if addCommonFlags found git in the path.
+	if !opts.config.Git.Disabled {
+		fs.StringVar(
+			&opts.config.Git.URL, "git-url", opts.config.Git.URL,
+			"The base URL from which target mirrors are cloned as "+
+				"GIT_URL/ORG/REPO.git. Defaults to the scheme and host "+
+				"of -api-url, or "+defaultGitURL)
+		fs.BoolVar(
+			&opts.config.Git.NoFetch, "no-fetch-git", opts.config.Git.NoFetch,
+			"Do not clone or update the target mirrors")
+		fs.IntVar(
+			&opts.config.Git.SyncMax, "git-sync-max", opts.config.Git.SyncMax,
+			"Number of max concurrent target mirror clones and updates")
+	}
+}
+
+// addReportFlags adds the flags that control which activity is reported
+// and how the reports are written.
+func addReportFlags(fs *flag.FlagSet, cf *cliFlags, opts *options) {
+	fs.StringVar(
+		&opts.config.Period, "period", opts.config.Period,
+		"Also report activity by period: month, quarter or year. "+
+			"The period boundaries honor -utc")
+	fs.StringVar(
+		&opts.config.Format, "format", opts.config.Format,
+		"The format of the report written to stdout: csv, json or ndjson. "+
+			"A JSON or NDJSON report is also written to the output directory")
+	fs.StringVar(
+		&opts.config.MarkdownTemplate, "markdown-template",
+		opts.config.MarkdownTemplate,
+		"A text/template file used to render the Markdown report "+
+			"instead of the default template")
+	fs.IntVar(
+		&opts.config.Top, "top", opts.config.Top,
+		"The number of members in each leaderboard of the org summary")
+	fs.BoolVar(
+		&opts.config.SQLite, "sqlite", opts.config.SQLite,
+		"Export all of the collected activity to a SQLite database")
+	fs.StringVar(
+		&cf.since, "since", formatWindowTime(opts.config.Since),
+		"Only report activity at or after this time, "+
+			"ex. 2018-07-01 or 2018-07-01T00:00:00Z")
+	fs.StringVar(
+		&cf.until, "until", formatWindowTime(opts.config.Until),
+		"Only report activity before this time, "+
+			"ex. 2018-10-01 or 2018-10-01T00:00:00Z")
+}
+
+// newMainFlagSet returns the flag set used when the program is invoked
+// without a command. It has all of the flags of the fetch and report
+// commands.
+func newMainFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() { usage(fs) }
+
+	addCommonFlags(fs, opts)
+	addFetchFlags(fs, cf, opts)
+	addReportFlags(fs, cf, opts)
+	fs.BoolVar(
+		&opts.config.Offline, "offline", opts.config.Offline,
+		"Offline mode sets all -no-fetch flags to true")
+	fs.BoolVar(
+		&opts.config.Offline, "no-fetch", opts.config.Offline,
+		"Synonym for -offline")
+	fs.BoolVar(
+		&opts.config.Offline, "report-only", opts.config.Offline,
+		"Synonym for -offline")
+	return fs
+}
+
+// runMain fetches and reports the members' activity. It is the program's
+// behavior when it is invoked without a command.
+func runMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	if err := initConfig(args, newMainFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newMainFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+	return runReport(fs, cf, opts)
+}
+
+func newFetchFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := newFlagSet(
+		"fetch", "fetch [FLAGS] [USER...]",
+		"Updates the cached members and the activity in the target\n"+
+			"repositories, and then prints the login of each member.\n"+
+			"All of the org's members are fetched if no USER is given.")
+	addCommonFlags(fs, opts)
+	addFetchFlags(fs, cf, opts)
+	return fs
+}
+
+func fetchMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	if err := initConfig(args, newFetchFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newFetchFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+
+	ctx := context.Background()
+	initOptions(ctx, fs, cf, &opts)
+	defer closeOptions(opts)
+
+	for m := range streamMembers(ctx, opts) {
+		fmt.Println(m.Login)
+	}
+	return 0
+}
+
+func newReportFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := newFlagSet(
+		"report", "report [FLAGS] [USER...]",
+		"Writes the reports from the cache without using the network or\n"+
+			"updating the cache.\n"+
+			"All of the cached members are reported if no USER is given.")
+	addCommonFlags(fs, opts)
+	addReportFlags(fs, cf, opts)
+	return fs
+}
+
+func reportMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	if err := initConfig(args, newReportFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newReportFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+
+	opts.config.Offline = true
+	opts.config.NoAffiliates = true
+	opts.readOnly = true
+
+	return runReport(fs, cf, opts)
+}
+
+// runReport gets the members and writes the reports.
+func runReport(fs *flag.FlagSet, cf cliFlags, opts options) int {
+	ctx := context.Background()
+	initOptions(ctx, fs, cf, &opts)
+	defer closeOptions(opts)
+
+	if err := writeReport(ctx, streamMembers(ctx, opts), opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeWriteReport
+	}
+	return 0
+}
+
+func helpMain(args []string) int {
+	if len(args) == 0 {
+		opts := options{config: defaultConfig()}
+		newMainFlagSet(&cliFlags{}, &opts).Usage()
+		return 0
+	}
+	if args[0] == "help" {
+		fmt.Fprintf(os.Stderr, "usage: %s help [COMMAND]\n", os.Args[0])
+		return 0
+	}
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
+		opts := options{config: defaultConfig()}
+		newMainFlagSet(&cliFlags{}, &opts).Usage()
+		return 1
+	}
+	return c.run([]string{"-h"})
+}
+
+// printCommands writes the program's commands and their summaries.
+func printCommands(w io.Writer) {
+	fmt.Fprintln(w, "COMMANDS")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintf(
+		fs.Output(),
+		"usage: %s COMMAND [FLAGS] [ARGS...]\n"+
+			"       %[1]s [FLAGS] [USER...]\n\n"+
+			"Without a COMMAND the members are fetched and reported.\n"+
+			"Use \"%[1]s help COMMAND\" for the usage of a command.\n\n",
+		os.Args[0])
+	printCommands(fs.Output())
+	fmt.Fprintf(
+		fs.Output(),
+		"FLAGS\n")
+	fs.PrintDefaults()
+	fmt.Fprintln(
+		fs.Output(), `
+ENVIRONMENT VARIABLES
+  DEBUG
+    Set to a truthy value to enable verbose output
+
+  GITHUB_API_KEY
+    One or more comma-separated GitHub API keys with the following
+    permissions:
+
+      * public_repo
+      * read:discussion
+      * read:gpg_key
+      * read:org
+      * read:public_key
+      * read:repo_hook
+      * read:user
+      * repo:invite
+      * repo:status
+      * repo_deployment
+      * user:email
+
+    This environment variable, -token-file or -app-id is REQUIRED.`)
+}
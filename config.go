@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// configEnvVar is the environment variable with the path of the
+	// config file when -config is not specified.
+	configEnvVar = "GITHUB_IMPACT_CONFIG"
+
+	// envFlagPrefix is the prefix of the environment variables that
+	// override the config file, ex. GITHUB_IMPACT_MEMBER_ORG.
+	envFlagPrefix = "GITHUB_IMPACT_"
+)
+
+// defaultConfig returns the config used when neither a config file, the
+// environment nor the flags specify a value.
+func defaultConfig() config {
+	var c config
+	c.OutputDir = "data"
+	c.MemberOrg = "VMware"
+	c.TargetOrg = "kubernetes"
+	c.TargetRepo = "kubernetes"
+	c.Format = formatCSV
+	c.Top = 10
+	c.Git.Max = 10
+	c.Git.SyncMax = 4
+	c.GitHub.API.Max = 2
+	c.GitHub.API.Retries = 5
+	c.GitHub.API.Wait = time.Duration(1) * time.Second
+	c.GitHub.API.RetryWait = time.Duration(10) * time.Second
+	c.LDAP.Host = "SCROOTDC01.vmware.com:3269"
+	return c
+}
+
+// flagSetFunc returns a command's flag set with the flags bound to the
+// options. The flags' defaults are the options' values.
+type flagSetFunc func(cf *cliFlags, opts *options) *flag.FlagSet
+
+// initConfig sets the config to the defaults and then to the values in
+// the config file specified by -config or by the environment.
+func initConfig(args []string, newFlags flagSetFunc, c *config) error {
+	*c = defaultConfig()
+
+	if filePath := configFilePath(args, newFlags); filePath != "" {
+		if err := loadConfigFile(filePath, c); err != nil {
+			return err
+		}
+	}
+
+	// DEBUG is not named after a flag, but it too overrides the file.
+	if v, ok := os.LookupEnv("DEBUG"); ok {
+		c.Debug, _ = strconv.ParseBool(v)
+	}
+	if c.Debug {
+		c.GitHub.API.ShowRateLimit = true
+	}
+	return nil
+}
+
+// configFilePath returns the value of -config in the args, which
+// defaults to the environment.
+func configFilePath(args []string, newFlags flagSetFunc) string {
+	var (
+		cf   cliFlags
+		opts = options{config: defaultConfig()}
+	)
+	fs := newFlags(&cf, &opts)
+	fs.Init(fs.Name(), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	fs.Parse(args)
+	if f := fs.Lookup("config"); f != nil {
+		return f.Value.String()
+	}
+	return os.Getenv(configEnvVar)
+}
+
+// loadConfigFile decodes a JSON or YAML config file into the config.
+func loadConfigFile(filePath string, c *config) error {
+	buf, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(buf, &v); err != nil {
+			return fmt.Errorf("error parsing %s: %v", filePath, err)
+		}
+		if buf, err = json.Marshal(yamlToJSON(v)); err != nil {
+			return fmt.Errorf("error loading %s: %v", filePath, err)
+		}
+	}
+	if err := json.Unmarshal(buf, c); err != nil {
+		return fmt.Errorf("error loading %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// yamlToJSON replaces the maps decoded from YAML, whose keys may be of
+// any type, with maps that have string keys so that the value may be
+// encoded as JSON and decoded into the config.
+func yamlToJSON(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, v := range tv {
+			m[fmt.Sprint(k)] = yamlToJSON(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range tv {
+			tv[i] = yamlToJSON(v)
+		}
+	}
+	return v
+}
+
+// UnmarshalJSON allows -since and -until to be specified in a config file
+// using any of the formats accepted by the flags.
+func (c *config) UnmarshalJSON(data []byte) error {
+	type plainConfig config
+	aux := struct {
+		*plainConfig
+		Since *string `json:"since"`
+		Until *string `json:"until"`
+	}{plainConfig: (*plainConfig)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	for _, w := range []struct {
+		value *string
+		time  **time.Time
+	}{
+		{aux.Since, &c.Since},
+		{aux.Until, &c.Until},
+	} {
+		if w.value == nil {
+			continue
+		}
+		t, err := parseWindowTime(*w.value, options{config: *c})
+		if err != nil {
+			return err
+		}
+		*w.time = t
+	}
+	return nil
+}
+
+// UnmarshalJSON allows the API durations to be specified in a config file
+// as strings accepted by time.ParseDuration, ex. "1s", or as nanoseconds.
+func (c *githubAPIConfig) UnmarshalJSON(data []byte) error {
+	type plainGitHubAPIConfig githubAPIConfig
+	aux := struct {
+		*plainGitHubAPIConfig
+		Wait      json.RawMessage `json:"api-wait"`
+		RetryWait json.RawMessage `json:"api-retry-wait"`
+	}{plainGitHubAPIConfig: (*plainGitHubAPIConfig)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	for _, d := range []struct {
+		name  string
+		value json.RawMessage
+		dur   *time.Duration
+	}{
+		{"api-wait", aux.Wait, &c.Wait},
+		{"api-retry-wait", aux.RetryWait, &c.RetryWait},
+	} {
+		if len(d.value) == 0 {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(d.value, &s); err != nil {
+			if err := json.Unmarshal(d.value, d.dur); err != nil {
+				return fmt.Errorf("invalid %s: %s", d.name, d.value)
+			}
+			continue
+		}
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", d.name, err)
+		}
+		*d.dur = v
+	}
+	return nil
+}
+
+// envFlagName returns the name of the environment variable that
+// overrides the config file's value of the flag.
+func envFlagName(flagName string) string {
+	return envFlagPrefix +
+		strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// parseFlags parses the args and then sets the flags that were not in the
+// args from the environment, ex. -member-org from
+// GITHUB_IMPACT_MEMBER_ORG.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	set := map[string]struct{}{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = struct{}{} })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := set[f.Name]; ok || err != nil || f.Name == "config" {
+			return
+		}
+		name := envFlagName(f.Name)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, name, e)
+		}
+	})
+	return err
+}
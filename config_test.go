@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"impact.yaml": `---
+# The members and targets.
+member-org: VMware
+targets:
+  - kubernetes/kubernetes
+  - "kubernetes/*"   # all of the org's repos
+utc: true
+since: 2018-07-01
+gitHub:
+  api:
+    api-max: 4
+    api-wait: 2s
+ldap:
+  ldap-host: 'ldap.example.com:3269'
+exclusions:
+  exclude: [vendor/**, "*.pb.go"]
+`,
+		"anchors.yml": `
+api: &api {api-max: 4, api-wait: 2s}
+member-org: >-
+  VMware
+targets:
+  - kubernetes/kubernetes
+  - kubernetes/*
+utc: true
+since: 2018-07-01
+gitHub:
+  api: *api
+ldap: {ldap-host: "ldap.example.com:3269"}
+exclusions:
+  exclude:
+    - vendor/**
+    - |-
+      *.pb.go
+`,
+		"impact.json": `{
+  "member-org": "VMware",
+  "targets": ["kubernetes/kubernetes", "kubernetes/*"],
+  "utc": true,
+  "since": "2018-07-01T00:00:00Z",
+  "gitHub": {"api": {"api-max": 4, "api-wait": "2s"}},
+  "ldap": {"ldap-host": "ldap.example.com:3269"},
+  "exclusions": {"exclude": ["vendor/**", "*.pb.go"]}
+}`,
+	}
+
+	since := time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+	exp := defaultConfig()
+	exp.MemberOrg = "VMware"
+	exp.Targets = []string{"kubernetes/kubernetes", "kubernetes/*"}
+	exp.UTC = true
+	exp.Since = &since
+	exp.GitHub.API.Max = 4
+	exp.GitHub.API.Wait = 2 * time.Second
+	exp.LDAP.Host = "ldap.example.com:3269"
+	exp.Exclusions.Globs = []string{"vendor/**", "*.pb.go"}
+
+	for fileName, data := range files {
+		filePath := path.Join(tmpDir, fileName)
+		if err := ioutil.WriteFile(filePath, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := defaultConfig()
+		if err := loadConfigFile(filePath, &c); err != nil {
+			t.Fatalf("%s: %v", fileName, err)
+		}
+		if !c.Since.Equal(since) {
+			t.Errorf("%s: since=%v", fileName, c.Since)
+		}
+		c.Since = &since
+		if !reflect.DeepEqual(c, exp) {
+			t.Errorf("%s:\n exp=%+v\n act=%+v", fileName, exp, c)
+		}
+	}
+
+	invalidPath := path.Join(tmpDir, "invalid.yaml")
+	if err := ioutil.WriteFile(
+		invalidPath, []byte("a: 1\n  b: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := defaultConfig()
+	if err := loadConfigFile(invalidPath, &c); err == nil {
+		t.Error("exp error for invalid YAML")
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath := path.Join(tmpDir, "impact.yml")
+	if err := ioutil.WriteFile(filePath, []byte(`
+member-org: FileOrg
+target-org: FileOrg
+output-dir: file
+targets: [file/a, file/b]
+exclusions:
+  exclude:
+    - file/**
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range map[string]string{
+		"GITHUB_IMPACT_TARGET_ORG": "EnvOrg",
+		"GITHUB_IMPACT_OUTPUT":     "env",
+		"GITHUB_IMPACT_TARGET":     "env/a",
+	} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	args := []string{
+		"-config", filePath,
+		"-output", "flag",
+		"-exclude", "flag/**",
+		"akutz",
+	}
+	newFlags := func(cf *cliFlags, opts *options) *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addCommonFlags(fs, opts)
+		return fs
+	}
+	var opts options
+	if err := initConfig(args, newFlags, &opts.config); err != nil {
+		t.Fatal(err)
+	}
+	fs := newFlags(nil, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		t.Fatal(err)
+	}
+
+	c := opts.config
+	for _, v := range []struct {
+		name     string
+		exp, act interface{}
+	}{
+		{"member-org", "FileOrg", c.MemberOrg},
+		{"target-org", "EnvOrg", c.TargetOrg},
+		{"output", "flag", c.OutputDir},
+		{"target", []string{"env/a"}, c.Targets},
+		{"exclude", []string{"flag/**"}, c.Exclusions.Globs},
+		{"target-repo", "kubernetes", c.TargetRepo},
+		{"args", []string{"akutz"}, fs.Args()},
+	} {
+		if !reflect.DeepEqual(v.exp, v.act) {
+			t.Errorf("%s: exp=%v act=%v", v.name, v.exp, v.act)
+		}
+	}
+}
+
+func TestConfigFilePath(t *testing.T) {
+	os.Setenv(configEnvVar, "env.json")
+	defer os.Unsetenv(configEnvVar)
+
+	for i, tc := range []struct {
+		args []string
+		exp  string
+	}{
+		{nil, "env.json"},
+		{[]string{"-config", "c.json"}, "c.json"},
+		{[]string{"--config=c.json"}, "c.json"},
+		{[]string{"-output", "data", "-config", "c.json"}, "c.json"},
+		{[]string{"-utc", "-top", "5", "-config", "c.json", "akutz"}, "c.json"},
+		{[]string{"-output=data", "-exclude", "a/**", "-config=c.json"}, "c.json"},
+		{[]string{"akutz", "-config", "c.json"}, "env.json"},
+		{[]string{"-output", "data", "--", "-config", "c.json"}, "env.json"},
+		{[]string{"-unknown", "-config", "c.json"}, "env.json"},
+	} {
+		if act := configFilePath(tc.args, newMainFlagSet); act != tc.exp {
+			t.Errorf("%d: %v: exp=%s act=%s", i, tc.args, tc.exp, act)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dashboard accumulates the reported members for the self-contained HTML
+// report.
+type dashboard struct {
+	members []dashboardMember
+	areas   map[string]*areaStats
+
+	// commits is the number of authored commits, keyed by month
+	commits map[string]int
+}
+
+type dashboardMember struct {
+	report  memberReport
+	commits map[string]int
+}
+
+func newDashboard() *dashboard {
+	return &dashboard{
+		areas:   map[string]*areaStats{},
+		commits: map[string]int{},
+	}
+}
+
+// month returns the month that contains the time in the format used by
+// the dashboard's timelines.
+func (d *dashboard) month(t time.Time, opts options) string {
+	opts.config.Period = periodMonth
+	return periodOf(t, opts)
+}
+
+func (d *dashboard) add(m member, r memberReport, opts options) {
+	dm := dashboardMember{report: r, commits: map[string]int{}}
+	for _, c := range m.Commits {
+		if c.CoAuthored {
+			continue
+		}
+		month := d.month(c.AuthorDate, opts)
+		dm.commits[month]++
+		d.commits[month]++
+	}
+	d.members = append(d.members, dm)
+
+	for _, a := range r.Areas {
+		key := a.Repo + ":" + a.Area
+		s, ok := d.areas[key]
+		if !ok {
+			s = &areaStats{Repo: a.Repo, Area: a.Area}
+			d.areas[key] = s
+		}
+		s.Commits += a.Commits
+		s.Additions += a.Additions
+		s.Deletions += a.Deletions
+		s.EffectiveAdditions += a.EffectiveAdditions
+		s.EffectiveDeletions += a.EffectiveDeletions
+	}
+}
+
+// months returns every month from the first to the last month with a
+// commit so that gaps in activity are visible in the timelines.
+func (d *dashboard) months() []string {
+	if len(d.commits) == 0 {
+		return nil
+	}
+	var all []string
+	for month := range d.commits {
+		all = append(all, month)
+	}
+	sort.Strings(all)
+	first, _ := time.Parse("2006-01", all[0])
+	last, _ := time.Parse("2006-01", all[len(all)-1])
+	var months []string
+	for t := first; !t.After(last); t = t.AddDate(0, 1, 0) {
+		months = append(months, t.Format("2006-01"))
+	}
+	return months
+}
+
+// dashboardTopAreas is the number of areas in the top areas chart.
+const dashboardTopAreas = 10
+
+func (d *dashboard) topAreas() []areaStats {
+	areas := make([]areaStats, 0, len(d.areas))
+	for _, a := range d.areas {
+		areas = append(areas, *a)
+	}
+	sort.Slice(areas, func(i, j int) bool {
+		if areas[i].Commits != areas[j].Commits {
+			return areas[i].Commits > areas[j].Commits
+		}
+		if areas[i].Repo != areas[j].Repo {
+			return areas[i].Repo < areas[j].Repo
+		}
+		return areas[i].Area < areas[j].Area
+	})
+	if len(areas) > dashboardTopAreas {
+		areas = areas[:dashboardTopAreas]
+	}
+	return areas
+}
+
+func (d *dashboard) writeToDisk(
+	filePath string, sum orgSummary, opts options) error {
+
+	months := d.months()
+	counts := func(commits map[string]int) []int {
+		v := make([]int, len(months))
+		for i, month := range months {
+			v[i] = commits[month]
+		}
+		return v
+	}
+
+	type row struct {
+		memberReport
+		Timeline template.HTML
+	}
+	var data = struct {
+		Metadata           reportMetadata
+		Summary            orgSummary
+		Metrics            []summaryMetric
+		LeaderboardMetrics []string
+		Rows               []row
+		CommitsChart       template.HTML
+		Areas              []areaStats
+		AreasChart         template.HTML
+	}{
+		Metadata:           newReportMetadata(opts),
+		Summary:            sum,
+		Metrics:            summaryMetrics,
+		LeaderboardMetrics: leaderboardMetrics,
+		Areas:              d.topAreas(),
+	}
+
+	data.CommitsChart = svgColumnChart(months, counts(d.commits), 720, 200)
+	for _, dm := range d.members {
+		data.Rows = append(data.Rows, row{
+			memberReport: dm.report,
+			Timeline:     svgSparkline(counts(dm.commits), 120, 24),
+		})
+	}
+	var (
+		areaLabels = make([]string, len(data.Areas))
+		areaValues = make([]int, len(data.Areas))
+	)
+	for i, a := range data.Areas {
+		areaLabels[i] = fmt.Sprintf("%s %s", a.Repo, a.Area)
+		areaValues[i] = a.Commits
+	}
+	data.AreasChart = svgBarChart(areaLabels, areaValues, 720)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return dashboardTemplate.Execute(f, data)
+}
+
+// svgColumnChart returns a column chart of the values with the first and
+// last labels on the x-axis.
+func svgColumnChart(labels []string, values []int, width, height int) template.HTML {
+	const axis = 20
+	var (
+		b   strings.Builder
+		max = maxInt(values)
+	)
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+			`viewBox="0 0 %[1]d %[2]d">`, width, height)
+	if len(values) > 0 && max > 0 {
+		colWidth := float64(width) / float64(len(values))
+		for i, v := range values {
+			h := float64(height-axis) * float64(v) / float64(max)
+			fmt.Fprintf(&b,
+				`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4a7fb5">`+
+					`<title>%s: %d</title></rect>`,
+				float64(i)*colWidth+1, float64(height-axis)-h,
+				colWidth-2, h, template.HTMLEscapeString(labels[i]), v)
+		}
+		fmt.Fprintf(&b,
+			`<text x="0" y="%d" font-size="11">%s</text>`,
+			height-4, template.HTMLEscapeString(labels[0]))
+		fmt.Fprintf(&b,
+			`<text x="%d" y="%d" font-size="11" text-anchor="end">%s</text>`,
+			width, height-4,
+			template.HTMLEscapeString(labels[len(labels)-1]))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// svgBarChart returns a horizontal bar chart of the values with a label
+// above each bar.
+func svgBarChart(labels []string, values []int, width int) template.HTML {
+	const rowHeight = 32
+	var (
+		b      strings.Builder
+		max    = maxInt(values)
+		height = rowHeight * len(values)
+	)
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+			`viewBox="0 0 %[1]d %[2]d">`, width, height)
+	for i, v := range values {
+		w := 0.0
+		if max > 0 {
+			w = float64(width-60) * float64(v) / float64(max)
+		}
+		y := i * rowHeight
+		fmt.Fprintf(&b,
+			`<text x="0" y="%d" font-size="11">%s</text>`+
+				`<rect x="0" y="%d" width="%.1f" height="12" fill="#4a7fb5"/>`+
+				`<text x="%.1f" y="%d" font-size="11">%d</text>`,
+			y+12, template.HTMLEscapeString(labels[i]),
+			y+16, w, w+4, y+27, v)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// svgSparkline returns a line chart of the values without any labels.
+func svgSparkline(values []int, width, height int) template.HTML {
+	var (
+		b      strings.Builder
+		max    = maxInt(values)
+		points []string
+	)
+	fmt.Fprintf(&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+			`viewBox="0 0 %[1]d %[2]d">`, width, height)
+	if len(values) > 1 && max > 0 {
+		step := float64(width-2) / float64(len(values)-1)
+		for i, v := range values {
+			points = append(points, fmt.Sprintf("%.1f,%.1f",
+				1+float64(i)*step,
+				float64(height-1)-float64(height-2)*float64(v)/float64(max)))
+		}
+		fmt.Fprintf(&b,
+			`<polyline points="%s" fill="none" stroke="#4a7fb5" stroke-width="1.5"/>`,
+			strings.Join(points, " "))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func maxInt(values []int) int {
+	var max int
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GitHub Impact{{with .Metadata.MemberOrg}}: {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 8px; border-bottom: 1px solid #ddd; text-align: right; }
+th { cursor: pointer; background: #f4f4f4; }
+th:first-child, td:first-child { text-align: left; }
+.leaderboard { display: inline-table; margin-right: 2em; vertical-align: top; }
+.leaderboard td:nth-child(2) { text-align: left; }
+.totals td { font-size: 1.4em; text-align: center; border: none; }
+.totals th { text-align: center; cursor: default; background: none; border: none; }
+</style>
+</head>
+<body>
+<h1>GitHub Impact{{with .Metadata.MemberOrg}}: {{.}}{{end}}</h1>
+<p>
+Generated {{.Metadata.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}
+for {{range $i, $t := .Metadata.Targets}}{{if $i}}, {{end}}{{$t}}{{end}}
+{{- with .Metadata.Since}}, since {{.Format "2006-01-02"}}{{end}}
+{{- with .Metadata.Until}}, until {{.Format "2006-01-02"}}{{end}}.
+</p>
+
+<h2>Totals</h2>
+{{with .Summary}}<table class="totals">
+<tr><th>Members</th><th>Active</th><th>Commits</th><th>Additions</th><th>Deletions</th><th>Effective Additions</th><th>Effective Deletions</th><th>Pull Requests</th><th>Merged</th><th>Issues</th><th>Reviews</th></tr>
+<tr><td>{{.Members}}</td><td>{{.ActiveContributors}}</td><td>{{index .Totals "commits"}}</td><td>{{index .Totals "additions"}}</td><td>{{index .Totals "deletions"}}</td><td>{{index .Totals "effectiveAdditions"}}</td><td>{{index .Totals "effectiveDeletions"}}</td><td>{{index .Totals "pullRequestsCreated"}}</td><td>{{index .Totals "pullRequestsMerged"}}</td><td>{{index .Totals "issuesCreated"}}</td><td>{{index .Totals "reviews"}}</td></tr>
+</table>{{end}}
+
+<h2>Per-Member Distribution</h2>
+<p>Among the {{.Summary.ActiveContributors}} active contributors.</p>
+<table>
+<tr><th>Metric</th><th>Total</th><th>Median</th><th>75th Percentile</th><th>90th Percentile</th><th>Max</th></tr>
+{{range .Metrics}}{{$d := index $.Summary.Distributions .Name}}<tr><td>{{.Name}}</td><td>{{index $.Summary.Totals .Name}}</td><td>{{$d.Median}}</td><td>{{$d.P75}}</td><td>{{$d.P90}}</td><td>{{$d.Max}}</td></tr>
+{{end}}</table>
+
+<h2>Leaderboards</h2>
+{{range .LeaderboardMetrics}}<table class="leaderboard">
+<tr><th colspan="3">{{.}}</th></tr>
+{{range $i, $e := index $.Summary.Leaderboards .}}<tr><td>{{inc $i}}</td><td>{{$e.Login}}</td><td>{{$e.Value}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Commits by Month</h2>
+{{.CommitsChart}}
+
+{{if .Areas}}
+<h2>Top Areas</h2>
+{{.AreasChart}}
+{{end}}
+
+<h2>Members</h2>
+<table id="members">
+<thead>
+<tr><th>Login</th><th>Name</th><th>Commits</th><th>Additions</th><th>Deletions</th><th>Effective Additions</th><th>Effective Deletions</th><th>Co-authored</th><th>Pull Requests</th><th>Merged</th><th>Issues</th><th>Reviews</th><th>Review Comments</th><th>Latest Commit</th><th>Timeline</th></tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr><td>{{.Login}}</td><td>{{.Name}}</td><td>{{.Commits}}</td><td>{{.Additions}}</td><td>{{.Deletions}}</td><td>{{.EffectiveAdditions}}</td><td>{{.EffectiveDeletions}}</td><td>{{.CoAuthoredCommits}}</td><td>{{.PullRequestsCreated}}</td><td>{{.PullRequestsMerged}}</td><td>{{.IssuesCreated}}</td><td>{{.Reviews}}</td><td>{{.ReviewComments}}</td><td data-sort="{{with .LatestCommitDate}}{{.Unix}}{{else}}0{{end}}">{{with .LatestCommitDate}}{{.Format "2006-01-02"}}{{end}}</td><td>{{.Timeline}}</td></tr>
+{{end}}</tbody>
+</table>
+
+<script>
+(function() {
+  var table = document.getElementById("members");
+  var headers = table.tHead.rows[0].cells;
+  for (var i = 0; i < headers.length; i++) {
+    headers[i].addEventListener("click", sortBy(i));
+  }
+  // The cells whose text is not their value, such as dates, are sorted
+  // by their data-sort attribute.
+  function value(cell) {
+    return cell.hasAttribute("data-sort") ?
+      cell.getAttribute("data-sort") : cell.textContent;
+  }
+  function sortBy(col) {
+    var desc = false;
+    return function() {
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      desc = !desc;
+      rows.sort(function(a, b) {
+        var x = value(a.cells[col]), y = value(b.cells[col]);
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var c = isNaN(nx) || isNaN(ny) ? x.localeCompare(y) : nx - ny;
+        return desc ? -c : c;
+      });
+      rows.forEach(function(r) { body.appendChild(r); });
+    };
+  }
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDashboard(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.UTC = true
+	opts.config.MemberOrg = "vmware"
+	opts.areas = &areaClassifier{}
+
+	d := newDashboard()
+	summ := &summarizer{}
+	for _, m := range []member{
+		{
+			Login: "akutz",
+			Name:  "<Andrew>",
+			Commits: []changeset{
+				{
+					Repo:       "vmware/impact",
+					AuthorDate: time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC),
+					Changes:    []changesetEntry{{Add: 1, Path: "pkg/main.go"}},
+				},
+				{
+					Repo:       "vmware/impact",
+					AuthorDate: time.Date(2018, 4, 15, 0, 0, 0, 0, time.UTC),
+					Changes:    []changesetEntry{{Add: 2, Path: "docs/README.md"}},
+				},
+			},
+		},
+		{Login: "bob"},
+	} {
+		r := m.report(opts)
+		d.add(m, r, opts)
+		summ.add(r)
+	}
+
+	if months := d.months(); strings.Join(months, ",") !=
+		"2018-01,2018-02,2018-03,2018-04" {
+		t.Errorf("months=%v", months)
+	}
+	if areas := d.topAreas(); len(areas) != 2 {
+		t.Errorf("areas=%+v", areas)
+	}
+
+	filePath := path.Join(tmpDir, "report.html")
+	if err := d.writeToDisk(filePath, summ.summary(opts), opts); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(buf)
+	for _, s := range []string{
+		"<td>akutz</td>",
+		"<td>bob</td>",
+		"&lt;Andrew&gt;",
+		"<polyline",
+		"<rect",
+		"<td>1</td><td>akutz</td><td>2</td>",
+		`<td data-sort="1523750400">2018-04-15</td>`,
+		`<td data-sort="0"></td>`,
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("report is missing %q", s)
+		}
+	}
+	for _, s := range []string{"<Andrew>", "src=", "href="} {
+		if strings.Contains(html, s) {
+			t.Errorf("report contains %q", s)
+		}
+	}
+}
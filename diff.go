@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// snapshot is the activity of the members in a report or a cache
+// directory, keyed by login.
+type snapshot map[string]memberReport
+
+// loadSnapshot loads a CSV, JSON or NDJSON report, or the member caches in
+// a directory. The commits in a CSV report are unknown, so the commits
+// that appeared or disappeared cannot be diffed with a CSV report.
+func loadSnapshot(filePath string, opts options) (snapshot, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadSnapshotFromCache(filePath, opts)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch path.Ext(filePath) {
+	case ".csv":
+		return decodeCSVSnapshot(f)
+	case ".json":
+		return decodeJSONSnapshot(f)
+	case ".ndjson":
+		return decodeNDJSONSnapshot(f)
+	}
+	return nil, fmt.Errorf("unknown report format: %s", filePath)
+}
+
+func loadSnapshotFromCache(dir string, opts options) (snapshot, error) {
+	matches, err := cachedMemberFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot{}
+	for _, filePath := range matches {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		var m member
+		err = m.decode(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %v", filePath, err)
+		}
+		s[m.Login] = m.report(opts)
+	}
+	return s, nil
+}
+
+func decodeJSONSnapshot(r io.Reader) (snapshot, error) {
+	var report struct {
+		SchemaVersion int            `json:"schemaVersion"`
+		Members       []memberReport `json:"members"`
+	}
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	if report.SchemaVersion != reportSchemaVersion {
+		return nil, fmt.Errorf(
+			"unsupported schema version: %d", report.SchemaVersion)
+	}
+	s := snapshot{}
+	for _, mr := range report.Members {
+		s[mr.Login] = mr
+	}
+	return s, nil
+}
+
+func decodeNDJSONSnapshot(r io.Reader) (snapshot, error) {
+	var (
+		s    = snapshot{}
+		scan = bufio.NewScanner(r)
+	)
+	scan.Buffer(nil, 64*1024*1024)
+	for scan.Scan() {
+		var rec ndjsonRecord
+		if err := json.Unmarshal(scan.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		if rec.SchemaVersion != reportSchemaVersion {
+			return nil, fmt.Errorf(
+				"unsupported schema version: %d", rec.SchemaVersion)
+		}
+		if rec.Member != nil {
+			s[rec.Member.Login] = *rec.Member
+		}
+	}
+	return s, scan.Err()
+}
+
+// decodeCSVSnapshot decodes a CSV report. The columns are matched to the
+// JSON fields of the member report by name, so reports written before a
+// column was added may still be decoded.
+func decodeCSVSnapshot(r io.Reader) (snapshot, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing csv header")
+	}
+	s := snapshot{}
+	header := records[0]
+	for _, record := range records[1:] {
+		fields := map[string]interface{}{}
+		for i, col := range header {
+			if i >= len(record) {
+				break
+			}
+			switch col {
+			case "login", "name", "latestCommitSHA":
+				fields[col] = record[i]
+			case "emails":
+				if record[i] != "" {
+					fields[col] = strings.Split(record[i], "|")
+				}
+			case "latestCommitDate":
+				// The date is formatted for people and is not needed to
+				// compare the reports.
+			default:
+				n, err := strconv.Atoi(record[i])
+				if err != nil {
+					return nil, fmt.Errorf(
+						"error parsing %s: %s: %v", col, record[i], err)
+				}
+				fields[col] = n
+			}
+		}
+		buf, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		var mr memberReport
+		if err := json.Unmarshal(buf, &mr); err != nil {
+			return nil, err
+		}
+		s[mr.Login] = mr
+	}
+	return s, nil
+}
+
+// hasActivity returns a flag indicating whether or not the member has any
+// commits, issues, pull requests or reviews.
+func (r memberReport) hasActivity() bool {
+	return r.Commits > 0 || r.CoAuthoredCommits > 0 ||
+		r.IssuesCreated > 0 || r.IssuesAssigned > 0 ||
+		r.IssuesMentioned > 0 || r.PullRequestsCreated > 0 ||
+		r.PullRequestsAssigned > 0 || r.PullRequestsMentioned > 0 ||
+		r.Reviews > 0 || r.ReviewComments > 0
+}
+
+// diffReport is the difference between two snapshots.
+type diffReport struct {
+	SchemaVersion        int           `json:"schemaVersion"`
+	Old                  string        `json:"old"`
+	New                  string        `json:"new"`
+	NewContributors      []string      `json:"newContributors"`
+	DepartedContributors []string      `json:"departedContributors"`
+	Members              []memberDelta `json:"members"`
+	AddedCommits         []diffCommit  `json:"addedCommits"`
+	RemovedCommits       []diffCommit  `json:"removedCommits"`
+}
+
+// memberDelta is the change in a member's activity.
+type memberDelta struct {
+	Login               string `json:"login"`
+	Commits             int    `json:"commits"`
+	Additions           int    `json:"additions"`
+	Deletions           int    `json:"deletions"`
+	PullRequestsCreated int    `json:"pullRequestsCreated"`
+	PullRequestsMerged  int    `json:"pullRequestsMerged"`
+	Reviews             int    `json:"reviews"`
+}
+
+func (d memberDelta) isZero() bool {
+	return d == memberDelta{Login: d.Login}
+}
+
+// diffCommit is a commit that appeared in or disappeared from a member's
+// activity.
+type diffCommit struct {
+	Login      string    `json:"login"`
+	Repo       string    `json:"repo"`
+	SHA        string    `json:"sha"`
+	Subject    string    `json:"subject"`
+	AuthorDate time.Time `json:"authorDate"`
+}
+
+func diffSnapshots(oldSnap, newSnap snapshot) diffReport {
+	d := diffReport{
+		SchemaVersion:        reportSchemaVersion,
+		NewContributors:      []string{},
+		DepartedContributors: []string{},
+		Members:              []memberDelta{},
+		AddedCommits:         []diffCommit{},
+		RemovedCommits:       []diffCommit{},
+	}
+
+	var logins uniqueStringSlice
+	for login := range oldSnap {
+		logins.append(login)
+	}
+	for login := range newSnap {
+		logins.append(login)
+	}
+	sort.Strings(logins)
+
+	for _, login := range logins {
+		o, n := oldSnap[login], newSnap[login]
+		switch {
+		case !o.hasActivity() && n.hasActivity():
+			d.NewContributors = append(d.NewContributors, login)
+		case o.hasActivity() && !n.hasActivity():
+			d.DepartedContributors = append(d.DepartedContributors, login)
+		}
+
+		md := memberDelta{
+			Login:               login,
+			Commits:             n.Commits - o.Commits,
+			Additions:           n.Additions - o.Additions,
+			Deletions:           n.Deletions - o.Deletions,
+			PullRequestsCreated: n.PullRequestsCreated - o.PullRequestsCreated,
+			PullRequestsMerged:  n.PullRequestsMerged - o.PullRequestsMerged,
+			Reviews:             n.Reviews - o.Reviews,
+		}
+		if !md.isZero() {
+			d.Members = append(d.Members, md)
+		}
+
+		d.AddedCommits = append(
+			d.AddedCommits, diffCommits(login, n, o)...)
+		d.RemovedCommits = append(
+			d.RemovedCommits, diffCommits(login, o, n)...)
+	}
+	return d
+}
+
+// diffCommits returns the commits in a that are not in b.
+func diffCommits(login string, a, b memberReport) []diffCommit {
+	known := map[string]struct{}{}
+	for _, c := range b.CommitDetails {
+		known[changesetKey(c.Repo, c.SHA)] = struct{}{}
+	}
+	var commits []diffCommit
+	for _, c := range a.CommitDetails {
+		if _, ok := known[changesetKey(c.Repo, c.SHA)]; ok {
+			continue
+		}
+		commits = append(commits, diffCommit{
+			Login:      login,
+			Repo:       c.Repo,
+			SHA:        c.SHA,
+			Subject:    c.Subject,
+			AuthorDate: c.AuthorDate,
+		})
+	}
+	return commits
+}
+
+func (d diffReport) encodeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "old: %s\nnew: %s\n", d.Old, d.New)
+	fmt.Fprintf(tw, "\nnew contributors: %d\n", len(d.NewContributors))
+	for _, login := range d.NewContributors {
+		fmt.Fprintf(tw, "  %s\n", login)
+	}
+	fmt.Fprintf(tw, "\ndeparted contributors: %d\n",
+		len(d.DepartedContributors))
+	for _, login := range d.DepartedContributors {
+		fmt.Fprintf(tw, "  %s\n", login)
+	}
+	fmt.Fprintf(tw, "\nmembers: %d\n", len(d.Members))
+	if len(d.Members) > 0 {
+		fmt.Fprintf(tw,
+			"  login\tcommits\tadditions\tdeletions\t"+
+				"pullRequests\tmerged\treviews\n")
+	}
+	signed := func(i int) string {
+		if i > 0 {
+			return fmt.Sprintf("+%d", i)
+		}
+		return strconv.Itoa(i)
+	}
+	for _, md := range d.Members {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			md.Login,
+			signed(md.Commits),
+			signed(md.Additions),
+			signed(md.Deletions),
+			signed(md.PullRequestsCreated),
+			signed(md.PullRequestsMerged),
+			signed(md.Reviews))
+	}
+	for _, commits := range []struct {
+		name    string
+		commits []diffCommit
+	}{
+		{"added commits", d.AddedCommits},
+		{"removed commits", d.RemovedCommits},
+	} {
+		fmt.Fprintf(tw, "\n%s: %d\n", commits.name, len(commits.commits))
+		for _, c := range commits.commits {
+			sha := c.SHA
+			if len(sha) > 10 {
+				sha = sha[:10]
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n",
+				c.Login, c.Repo, sha, c.Subject)
+		}
+	}
+	return tw.Flush()
+}
+
+func (d diffReport) encodeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+func newDiffFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := newFlagSet(
+		"diff", "diff [FLAGS] OLD NEW",
+		"OLD and NEW are CSV, JSON or NDJSON reports or output\n"+
+			"directories with cached members.")
+	addConfigFlag(fs)
+	fs.StringVar(
+		&cf.diffFormat, "format", "text",
+		"The format of the diff: text or json")
+	fs.BoolVar(
+		&opts.config.UTC, "utc", opts.config.UTC,
+		"Print timestamps using UTC")
+	fs.Var(
+		(*stringSliceFlag)(&opts.config.Exclusions.Globs), "exclude",
+		"A glob of paths excluded from the effective additions and "+
+			"deletions of cached members. May be specified more than once")
+	fs.BoolVar(
+		&opts.config.Exclusions.NoDefaults, "no-default-exclusions",
+		opts.config.Exclusions.NoDefaults,
+		"Do not exclude vendored, generated and lock files from the "+
+			"effective additions and deletions of cached members")
+	return fs
+}
+
+// diffMain is the entry point of the diff command, which compares two
+// reports or cache directories.
+func diffMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	if err := initConfig(args, newDiffFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newDiffFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+
+	if fs.NArg() != 2 ||
+		(cf.diffFormat != "text" && cf.diffFormat != formatJSON) {
+		fs.Usage()
+		return 1
+	}
+
+	exclusions, err := newExclusions(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeExclusions
+	}
+	opts.exclusions = exclusions
+
+	var snaps [2]snapshot
+	for i, filePath := range fs.Args() {
+		if snaps[i], err = loadSnapshot(filePath, opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitCodeDiff
+		}
+	}
+
+	d := diffSnapshots(snaps[0], snaps[1])
+	d.Old, d.New = fs.Arg(0), fs.Arg(1)
+
+	if cf.diffFormat == formatJSON {
+		err = d.encodeJSON(os.Stdout)
+	} else {
+		err = d.encodeText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeDiff
+	}
+	return 0
+}
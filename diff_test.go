@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.UTC = true
+
+	commit := func(sha string, add int) changeset {
+		return changeset{
+			Repo:       "vmware/impact",
+			Long:       sha,
+			Subject:    sha,
+			AuthorDate: time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC),
+			Changes:    []changesetEntry{{Add: add, Path: "main.go"}},
+		}
+	}
+
+	// The old snapshot is a cache directory. The report files in the
+	// directory are not members.
+	oldDir := path.Join(tmpDir, "old")
+	opts.config.OutputDir = oldDir
+	if err := os.MkdirAll(oldDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []member{
+		{Login: "akutz", Commits: []changeset{commit("a", 1), commit("b", 2)}},
+		{Login: "bob", Commits: []changeset{commit("c", 3)}},
+		{Login: "carol"},
+	} {
+		if err := m.writeToDisk(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(
+		path.Join(oldDir, "report-metadata.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new snapshot is a JSON report.
+	newFile := path.Join(tmpDir, "report.json")
+	w := &bytes.Buffer{}
+	e, err := newReportEncoder(w, formatJSON, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []member{
+		{Login: "akutz", Commits: []changeset{commit("a", 1), commit("d", 4)}},
+		{Login: "carol", Commits: []changeset{commit("e", 5)}},
+	} {
+		if err := e.encode(m.report(opts)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.close(orgSummary{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(newFile, w.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldSnap, err := loadSnapshot(oldDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oldSnap) != 3 {
+		t.Fatalf("len(old)=%d, expected 3", len(oldSnap))
+	}
+	newSnap, err := loadSnapshot(newFile, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := diffSnapshots(oldSnap, newSnap)
+	if s := strings.Join(d.NewContributors, ","); s != "carol" {
+		t.Errorf("newContributors=%s, expected carol", s)
+	}
+	if s := strings.Join(d.DepartedContributors, ","); s != "bob" {
+		t.Errorf("departedContributors=%s, expected bob", s)
+	}
+	if len(d.Members) != 3 {
+		t.Fatalf("members=%+v", d.Members)
+	}
+	if md := d.Members[0]; md.Login != "akutz" ||
+		md.Commits != 0 || md.Additions != 2 {
+		t.Errorf("members[0]=%+v", md)
+	}
+	if len(d.AddedCommits) != 2 || d.AddedCommits[0].SHA != "d" ||
+		d.AddedCommits[1].SHA != "e" {
+		t.Errorf("addedCommits=%+v", d.AddedCommits)
+	}
+	if len(d.RemovedCommits) != 2 || d.RemovedCommits[0].SHA != "b" ||
+		d.RemovedCommits[1].SHA != "c" {
+		t.Errorf("removedCommits=%+v", d.RemovedCommits)
+	}
+
+	if err := d.encodeText(ioutil.Discard); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecodeCSVSnapshot(t *testing.T) {
+	var opts options
+	m := member{
+		Login:  "akutz",
+		Emails: []string{"akutz@vmware.com", "sakutz@gmail.com"},
+		Commits: []changeset{{
+			Repo:       "vmware/impact",
+			Long:       "abc",
+			AuthorDate: time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC),
+			Changes:    []changesetEntry{{Add: 3, Del: 2, Path: "main.go"}},
+		}},
+	}
+
+	w := &bytes.Buffer{}
+	csvw := csv.NewWriter(w)
+	csvw.Write(csvReportHeader)
+	csvw.Write(m.csvFields(opts))
+	csvw.Flush()
+
+	s, err := decodeCSVSnapshot(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s["akutz"]
+	if r.Commits != 1 || r.Additions != 3 || r.Deletions != 2 ||
+		len(r.Emails) != 2 {
+		t.Errorf("report=%+v", r)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// apiBaseURL returns the base URL of the REST API, which is GitHub's
+// unless -api-url specifies a GitHub Enterprise Server's, for example
+// https://github.example.com/api/v3/.
+func apiBaseURL(opts options) string {
+	if opts.config.GitHub.BaseURL == "" {
+		return defaultAPIBaseURL
+	}
+	return strings.TrimSuffix(opts.config.GitHub.BaseURL, "/") + "/"
+}
+
+// apiUploadURL returns the base URL for uploads. A GitHub Enterprise
+// Server's upload URL is derived from its REST API URL, which ends with
+// /api/v3, unless -upload-url is specified.
+func apiUploadURL(opts options) string {
+	if u := opts.config.GitHub.UploadURL; u != "" {
+		return strings.TrimSuffix(u, "/") + "/"
+	}
+	if opts.config.GitHub.BaseURL == "" {
+		return "https://uploads.github.com/"
+	}
+	u := strings.TrimSuffix(opts.config.GitHub.BaseURL, "/")
+	if strings.HasSuffix(u, "/api/v3") {
+		u = strings.TrimSuffix(u, "/api/v3") + "/api/uploads"
+	}
+	return u + "/"
+}
+
+// defaultGitURL is the base URL from which mirrors are cloned unless
+// -git-url or -api-url is specified.
+const defaultGitURL = "https://github.com"
+
+// gitBaseURL returns the base URL from which the target mirrors are
+// cloned, which is the host of -api-url unless -git-url is specified.
+func gitBaseURL(opts options) string {
+	if u := opts.config.Git.URL; u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	if opts.config.GitHub.BaseURL == "" {
+		return defaultGitURL
+	}
+	u, err := url.Parse(opts.config.GitHub.BaseURL)
+	if err != nil || u.Host == "" {
+		return defaultGitURL
+	}
+	return fmt.Sprintf("%s://%s", u.Scheme, strings.TrimPrefix(u.Host, "api."))
+}
+
+// newHTTPTransport returns the transport used for API calls. If -ca-file
+// is specified then the certificates in it are trusted in addition to the
+// system's, such as those of a GitHub Enterprise Server's internal CA.
+func newHTTPTransport(opts options) (http.RoundTripper, error) {
+	if opts.config.GitHub.CAFile == "" {
+		return http.DefaultTransport, nil
+	}
+	pem, err := ioutil.ReadFile(opts.config.GitHub.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf(
+			"no certificates in %s", opts.config.GitHub.CAFile)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return t, nil
+}
+
+// systemCABundles are the paths of the system's PEM-encoded CA bundle on
+// the platforms that have one, in the order in which they are searched.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Gentoo, Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS, RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, macOS, BSD
+}
+
+// systemCABundle returns the contents of the system's CA bundle, which
+// may be specified with SSL_CERT_FILE. Nil is returned if there is no
+// such bundle.
+func systemCABundle() ([]byte, error) {
+	filePaths := systemCABundles
+	if v := os.Getenv("SSL_CERT_FILE"); v != "" {
+		filePaths = append([]string{v}, filePaths...)
+	}
+	for _, filePath := range filePaths {
+		buf, err := ioutil.ReadFile(filePath)
+		if err == nil {
+			return buf, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// gitCABundleFilePath returns the path to the CA bundle written by
+// writeGitCABundle.
+func gitCABundleFilePath(opts options) string {
+	return path.Join(opts.config.OutputDir, ".cache", "git", "ca-bundle.pem")
+}
+
+// writeGitCABundle writes the system's certificates and those in -ca-file
+// to the CA bundle git trusts, and returns its path.
+func writeGitCABundle(opts options) (string, error) {
+	if opts.config.GitHub.CAFile == "" {
+		return "", nil
+	}
+	ca, err := ioutil.ReadFile(opts.config.GitHub.CAFile)
+	if err != nil {
+		return "", err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		return "", fmt.Errorf(
+			"no certificates in %s", opts.config.GitHub.CAFile)
+	}
+	system, err := systemCABundle()
+	if err != nil {
+		return "", err
+	}
+	if system == nil {
+		fmt.Fprintf(os.Stderr,
+			"no system CA bundle found, git only trusts %s\n",
+			opts.config.GitHub.CAFile)
+	}
+
+	filePath, err := filepath.Abs(gitCABundleFilePath(opts))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(path.Dir(filePath), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	for _, buf := range [][]byte{system, []byte("\n"), ca} {
+		if _, err := f.Write(buf); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := os.Rename(f.Name(), filePath); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// gitTLSArgs returns the git options that trust the CA bundle written by
+// writeGitCABundle when mirrors are cloned and fetched.
+func gitTLSArgs(opts options) []string {
+	if opts.gitCAFile == "" {
+		return nil
+	}
+	return []string{"-c", "http.sslCAInfo=" + opts.gitCAFile}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAPIUploadURL(t *testing.T) {
+	for i, tc := range []struct {
+		baseURL   string
+		uploadURL string
+		exp       string
+	}{
+		{"", "", "https://uploads.github.com/"},
+		{"https://ghe.example.com/api/v3", "", "https://ghe.example.com/api/uploads/"},
+		{"https://ghe.example.com/api/v3/", "", "https://ghe.example.com/api/uploads/"},
+		{"https://api.ghe.example.com/", "", "https://api.ghe.example.com/"},
+		{"https://ghe.example.com/api/v3/", "https://up.example.com", "https://up.example.com/"},
+	} {
+		var opts options
+		opts.config.GitHub.BaseURL = tc.baseURL
+		opts.config.GitHub.UploadURL = tc.uploadURL
+		if act := apiUploadURL(opts); act != tc.exp {
+			t.Errorf("%d: exp=%s act=%s", i, tc.exp, act)
+		}
+	}
+}
+
+func TestGitBaseURL(t *testing.T) {
+	for i, tc := range []struct {
+		baseURL string
+		gitURL  string
+		exp     string
+	}{
+		{"", "", "https://github.com"},
+		{"https://api.github.com/", "", "https://github.com"},
+		{"https://ghe.example.com/api/v3/", "", "https://ghe.example.com"},
+		{"http://ghe.example.com:8080/api/v3", "", "http://ghe.example.com:8080"},
+		{"https://api.ghe.example.com/", "", "https://ghe.example.com"},
+		{"https://ghe.example.com/api/v3/", "https://git.example.com/", "https://git.example.com"},
+		{"", "file:///tmp/src", "file:///tmp/src"},
+	} {
+		var opts options
+		opts.config.GitHub.BaseURL = tc.baseURL
+		opts.config.Git.URL = tc.gitURL
+		if act := gitBaseURL(opts); act != tc.exp {
+			t.Errorf("%d: exp=%s act=%s", i, tc.exp, act)
+		}
+	}
+}
+
+func TestGitHubEnterpriseClient(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v3/users/akutz" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"login":"akutz","name":"Andrew"}`)
+		}))
+	// The handshake that fails without the CA bundle is logged otherwise.
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	s.StartTLS()
+	defer s.Close()
+
+	// Write the server's self-signed certificate to the CA bundle.
+	caFile := path.Join(tmpDir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: s.Certificate().Raw,
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	getName := func(caFile string) (string, error) {
+		var opts options
+		opts.config.OutputDir = tmpDir
+		opts.config.GitHub.NoCache = true
+		opts.config.GitHub.BaseURL = s.URL + "/api/v3"
+		opts.config.GitHub.CAFile = caFile
+		transport, err := newHTTPTransport(opts)
+		if err != nil {
+			return "", err
+		}
+		client, err := newGitHubAPIClient(
+			context.Background(),
+			[]oauth2.TokenSource{
+				oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret"}),
+			},
+			transport,
+			opts)
+		if err != nil {
+			return "", err
+		}
+		if exp, act := s.URL+"/api/v3/", client.BaseURL.String(); exp != act {
+			t.Errorf("base url: exp=%s act=%s", exp, act)
+		}
+		if exp, act := s.URL+"/api/uploads/", client.UploadURL.String(); exp != act {
+			t.Errorf("upload url: exp=%s act=%s", exp, act)
+		}
+		user, _, err := client.Users.Get(context.Background(), "akutz")
+		if err != nil {
+			return "", err
+		}
+		return user.GetName(), nil
+	}
+
+	// The server's certificate is not trusted without the CA bundle.
+	if _, err := getName(""); err == nil {
+		t.Error("exp certificate error")
+	}
+
+	name, err := getName(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Andrew" {
+		t.Errorf("name: exp=Andrew act=%s", name)
+	}
+
+	// A CA bundle without certificates is an error.
+	emptyFile := path.Join(tmpDir, "empty.pem")
+	if err := ioutil.WriteFile(emptyFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getName(emptyFile); err == nil {
+		t.Error("exp error for empty CA bundle")
+	}
+}
+
+func TestWriteGitCABundle(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	s := httptest.NewTLSServer(http.NotFoundHandler())
+	s.Close()
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: s.Certificate().Raw,
+	})
+
+	systemFile := path.Join(tmpDir, "system.pem")
+	system := append([]byte("# system\n"), certPEM...)
+	if err := ioutil.WriteFile(systemFile, system, 0644); err != nil {
+		t.Fatal(err)
+	}
+	caFile := path.Join(tmpDir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("SSL_CERT_FILE", os.Getenv("SSL_CERT_FILE"))
+	os.Setenv("SSL_CERT_FILE", systemFile)
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+
+	// Git's CA bundle is not replaced without -ca-file.
+	if filePath, err := writeGitCABundle(opts); err != nil || filePath != "" {
+		t.Fatalf("filePath=%q err=%v, expected none", filePath, err)
+	}
+	if args := gitTLSArgs(opts); args != nil {
+		t.Errorf("args=%v, expected nil", args)
+	}
+
+	// The system's certificates are trusted in addition to -ca-file.
+	opts.config.GitHub.CAFile = caFile
+	if opts.gitCAFile, err = writeGitCABundle(opts); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(opts.gitCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := string(system) + "\n" + string(certPEM)
+	if act := string(buf); act != exp {
+		t.Errorf("bundle: exp=%q act=%q", exp, act)
+	}
+	if args := gitTLSArgs(opts); len(args) != 2 ||
+		args[1] != "http.sslCAInfo="+opts.gitCAFile {
+		t.Errorf("args=%v", args)
+	}
+
+	// A CA bundle without certificates is an error.
+	if err := ioutil.WriteFile(caFile, []byte("# empty\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeGitCABundle(opts); err == nil {
+		t.Error("exp error for empty CA bundle")
+	}
+}
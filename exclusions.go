@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultExclusions are the globs of the vendored, generated and
+// dependency lock files that are excluded from effective churn unless
+// -no-default-exclusions is set.
+var defaultExclusions = []string{
+	"**/vendor/**",
+	"Godeps/**",
+	"**/zz_generated.*.go",
+	"**/*.pb.go",
+	"**/*.pb.gw.go",
+	"**/bindata.go",
+	"**/go.sum",
+	"**/Gopkg.lock",
+	"**/glide.lock",
+}
+
+// generatedMarkerRX matches the comment with which generated files are
+// marked, such as "// Code generated by protoc-gen-go. DO NOT EDIT.", as
+// an extended regular expression for "git grep".
+const generatedMarkerRX = `^(//|#) Code generated .* DO NOT EDIT\.`
+
+// exclusions determines which changes do not contribute to a member's
+// effective churn. The raw churn in the cache is not affected.
+type exclusions struct {
+	globs []string
+
+	// attributes are the linguist-generated attributes in the targets'
+	// .gitattributes files, keyed by target.
+	attributes map[string][]generatedAttribute
+
+	// generated are the paths of the files in the targets' HEAD that are
+	// marked as generated, keyed by target.
+	generated map[string]map[string]struct{}
+}
+
+// generatedAttribute is a .gitattributes rule that sets or unsets the
+// linguist-generated attribute of the files matching the glob.
+type generatedAttribute struct {
+	glob      string
+	generated bool
+}
+
+// newExclusions returns the exclusion globs and the generated files in
+// the targets' HEAD.
+func newExclusions(ctx context.Context, opts options) (*exclusions, error) {
+	e := &exclusions{
+		attributes: map[string][]generatedAttribute{},
+		generated:  map[string]map[string]struct{}{},
+	}
+	if !opts.config.Exclusions.NoDefaults {
+		e.globs = append(e.globs, defaultExclusions...)
+	}
+	for _, glob := range opts.config.Exclusions.Globs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclusion glob: %s: %v", glob, err)
+		}
+		e.globs = append(e.globs, glob)
+	}
+	if opts.config.Exclusions.NoDefaults {
+		return e, nil
+	}
+	for _, t := range opts.targets {
+		if t.GitDir == "" || t.Head == "" {
+			continue
+		}
+		if err := e.addTarget(ctx, t, opts); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// addTarget finds the generated files in the target's HEAD.
+func (e *exclusions) addTarget(
+	ctx context.Context, t target, opts options) error {
+
+	generated, err := gitGrepFiles(ctx, opts, t, generatedMarkerRX)
+	if err != nil {
+		return err
+	}
+	if len(generated) > 0 {
+		e.generated[t.String()] = map[string]struct{}{}
+		for _, filePath := range generated {
+			e.generated[t.String()][filePath] = struct{}{}
+		}
+	}
+
+	attrFiles, err := gitGrepFiles(
+		ctx, opts, t, "linguist-generated", "*.gitattributes")
+	if err != nil {
+		return err
+	}
+
+	// The rules in deeper .gitattributes files take precedence, and the
+	// last matching rule is used.
+	sort.SliceStable(attrFiles, func(i, j int) bool {
+		return strings.Count(attrFiles[i], "/") <
+			strings.Count(attrFiles[j], "/")
+	})
+	for _, filePath := range attrFiles {
+		if path.Base(filePath) != ".gitattributes" {
+			continue
+		}
+		text, err := gitOutput(
+			ctx, opts,
+			"--git-dir", t.GitDir, "show", t.Head+":"+filePath)
+		if err != nil {
+			return err
+		}
+		e.attributes[t.String()] = append(
+			e.attributes[t.String()],
+			parseGeneratedAttributes(path.Dir(filePath), text)...)
+	}
+	return nil
+}
+
+// gitGrepFiles returns the paths of the files in the target's HEAD that
+// match the extended regular expression, optionally limited to the
+// pathspecs.
+func gitGrepFiles(
+	ctx context.Context,
+	opts options,
+	t target,
+	pattern string,
+	pathspecs ...string) ([]string, error) {
+
+	args := append([]string{
+		"--git-dir", t.GitDir, "grep", "-l", "-I", "-E", pattern, t.Head,
+		"--"}, pathspecs...)
+	out, err := gitOutput(ctx, opts, args...)
+	if err != nil {
+		// Git exits with 1 if no files match.
+		if err, ok := err.(*gitError); ok && err.exitCode() == 1 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var filePaths []string
+	for _, line := range strings.Split(out, "\n") {
+		if filePath := strings.TrimPrefix(line, t.Head+":"); filePath != "" {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	return filePaths, nil
+}
+
+// parseGeneratedAttributes returns the linguist-generated rules in the
+// .gitattributes file in the directory. The rules' patterns are converted
+// to globs relative to the root of the repository.
+func parseGeneratedAttributes(dir, text string) []generatedAttribute {
+	var attrs []generatedAttribute
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pattern := fields[0]
+
+		// Patterns that only match directories do not match files.
+		if strings.HasSuffix(pattern, "/") {
+			continue
+		}
+
+		var (
+			generated bool
+			ok        bool
+		)
+		for _, attr := range fields[1:] {
+			switch attr {
+			case "linguist-generated", "linguist-generated=true":
+				generated, ok = true, true
+			case "-linguist-generated", "!linguist-generated",
+				"linguist-generated=false":
+				generated, ok = false, true
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		// A pattern without a slash matches files at any depth below the
+		// directory, and any other pattern is relative to it.
+		glob := strings.TrimPrefix(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			glob = path.Join("**", glob)
+		}
+		if dir != "." && dir != "" {
+			glob = path.Join(dir, glob)
+		}
+		attrs = append(attrs, generatedAttribute{glob: glob, generated: generated})
+	}
+	return attrs
+}
+
+// excluded returns a flag indicating whether or not the change to a file
+// in the repository is excluded from effective churn.
+func (e *exclusions) excluded(repo string, ce changesetEntry) bool {
+	if ce.Binary {
+		return true
+	}
+	filePath := numstatPath(ce.Path)
+	if filePath != ce.Path && ce.Add == 0 && ce.Del == 0 {
+		return true
+	}
+	if e == nil {
+		return false
+	}
+	for _, glob := range e.globs {
+		if matchGlob(glob, filePath) {
+			return true
+		}
+	}
+
+	// The linguist-generated attribute overrides the generated marker.
+	attrs := e.attributes[repo]
+	for i := len(attrs) - 1; i >= 0; i-- {
+		if matchGlob(attrs[i].glob, filePath) {
+			return attrs[i].generated
+		}
+	}
+	_, ok := e.generated[repo][filePath]
+	return ok
+}
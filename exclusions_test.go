@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestExclusions(t *testing.T) {
+	var opts options
+	opts.config.Exclusions.Globs = []string{"docs/**"}
+	e, err := newExclusions(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		ce       changesetEntry
+		excluded bool
+	}{
+		{changesetEntry{Add: 1, Path: "pkg/kubelet/kubelet.go"}, false},
+		{changesetEntry{Add: 1, Path: "vendor/github.com/pkg/errors/errors.go"}, true},
+		{changesetEntry{Add: 1, Path: "pkg/api/zz_generated.deepcopy.go"}, true},
+		{changesetEntry{Add: 1, Path: "pkg/api/types.pb.go"}, true},
+		{changesetEntry{Add: 1, Path: "docs/README.md"}, true},
+		{changesetEntry{Path: "logo.png", Binary: true}, true},
+		{changesetEntry{Path: "pkg/{kubelet => kubeletv2}/types.go"}, true},
+		{changesetEntry{Add: 1, Path: "pkg/{kubelet => kubeletv2}/types.go"}, false},
+	}
+
+	for _, tc := range testCases {
+		if excluded := e.excluded("vmware/impact", tc.ce); excluded != tc.excluded {
+			t.Errorf("excluded(%+v)=%v, expected %v",
+				tc.ce, excluded, tc.excluded)
+		}
+	}
+
+	opts.config.Exclusions.Globs = []string{"["}
+	if _, err := newExclusions(context.Background(), opts); err == nil {
+		t.Error("expected invalid glob error")
+	}
+}
+
+func TestParseGeneratedAttributes(t *testing.T) {
+	text := `# comment
+*.json linguist-generated
+/api.json -linguist-generated
+docs/*.md linguist-generated=true text
+build/ linguist-generated
+*.txt text
+keep.go linguist-generated=false
+`
+	exp := []generatedAttribute{
+		{"**/*.json", true},
+		{"api.json", false},
+		{"docs/*.md", true},
+		{"**/keep.go", false},
+	}
+	if act := parseGeneratedAttributes(".", text); !reflect.DeepEqual(act, exp) {
+		t.Errorf("root: exp=%+v act=%+v", exp, act)
+	}
+
+	exp = []generatedAttribute{
+		{"pkg/**/*.json", true},
+		{"pkg/api.json", false},
+		{"pkg/docs/*.md", true},
+		{"pkg/**/keep.go", false},
+	}
+	if act := parseGeneratedAttributes("pkg", text); !reflect.DeepEqual(act, exp) {
+		t.Errorf("pkg: exp=%+v act=%+v", exp, act)
+	}
+}
+
+func TestGeneratedExclusions(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	srcDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	for filePath, text := range map[string]string{
+		"main.go":            "package main\n",
+		"gen.go":             "// Code generated by stringer. DO NOT EDIT.\n\npackage main\n",
+		"gen/gen.go":         "package gen\n\nconst header = \"// Code generated by gen. DO NOT EDIT.\"\n",
+		"hack/gen.sh":        "#!/bin/sh\n# Code generated by gen. DO NOT EDIT.\n",
+		"data.json":          "{}\n",
+		"api/api.json":       "{}\n",
+		"api/keep.json":      "{}\n",
+		"api/override.go":    "// Code generated by hand. DO NOT EDIT.\n",
+		".gitattributes":     "*.json linguist-generated\n",
+		"api/.gitattributes": "keep.json -linguist-generated\noverride.go -linguist-generated\n",
+	} {
+		filePath = path.Join(srcDir, filePath)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, srcDir, "init", "--quiet")
+	runGit(t, srcDir, "add", ".")
+	runGit(t, srcDir, "commit", "--quiet", "-m", "initial")
+
+	var opts options
+	opts.chanGit = make(chan struct{}, 1)
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact", GitDir: srcDir + "/.git"}
+	if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+		t.Fatal(err)
+	}
+	opts.targets = []target{tgt}
+
+	e, err := newExclusions(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filePath, exp := range map[string]bool{
+		"main.go":         false,
+		"gen.go":          true,
+		"gen/gen.go":      false,
+		"hack/gen.sh":     true,
+		"data.json":       true,
+		"api/api.json":    true,
+		"api/keep.json":   false,
+		"api/override.go": false,
+	} {
+		ce := changesetEntry{Add: 1, Path: filePath}
+		if act := e.excluded(tgt.String(), ce); act != exp {
+			t.Errorf("excluded(%s)=%v, expected %v", filePath, act, exp)
+		}
+		if act := e.excluded("vmware/other", ce); act {
+			t.Errorf("excluded(vmware/other, %s)=true", filePath)
+		}
+	}
+
+	// The generated files are not detected without the default exclusions.
+	opts.config.Exclusions.NoDefaults = true
+	if e, err = newExclusions(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if e.excluded(tgt.String(), changesetEntry{Add: 1, Path: "gen.go"}) {
+		t.Error("excluded(gen.go)=true without the default exclusions")
+	}
+}
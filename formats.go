@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	formatCSV    = "csv"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// validFormat returns a flag indicating whether or not the format is one
+// of the supported report formats.
+func validFormat(format string) bool {
+	switch format {
+	case formatCSV, formatJSON, formatNDJSON:
+		return true
+	}
+	return false
+}
+
+// reportEncoder writes member reports in one of the report formats.
+type reportEncoder interface {
+	encode(r memberReport) error
+
+	// close writes the end of the report, including the org summary if
+	// the format has one. It does not close the underlying writer.
+	close(sum orgSummary) error
+}
+
+func newReportEncoder(
+	w io.Writer, format string, opts options) (reportEncoder, error) {
+
+	switch format {
+	case formatCSV:
+		return newCSVReportEncoder(w)
+	case formatJSON:
+		return newJSONReportEncoder(w, opts)
+	case formatNDJSON:
+		return newNDJSONReportEncoder(w, opts)
+	}
+	return nil, fmt.Errorf("invalid format: %s", format)
+}
+
+type csvReportEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVReportEncoder(w io.Writer) (*csvReportEncoder, error) {
+	e := &csvReportEncoder{w: csv.NewWriter(w)}
+	e.w.Write(csvReportHeader)
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *csvReportEncoder) encode(r memberReport) error {
+	e.w.Write(r.csvFields())
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// close does not write the summary, whose columns differ from the
+// members'. It is written to report-summary.csv by writeReport.
+func (e *csvReportEncoder) close(sum orgSummary) error {
+	return nil
+}
+
+// jsonReportEncoder writes the report as a single JSON object.
+//
+//	{"schemaVersion":1,"metadata":{...},"members":[{...}],"summary":{...}}
+type jsonReportEncoder struct {
+	w       io.Writer
+	members int
+}
+
+func newJSONReportEncoder(
+	w io.Writer, opts options) (*jsonReportEncoder, error) {
+
+	md, err := json.Marshal(newReportMetadata(opts))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(
+		w, `{"schemaVersion":%d,"metadata":%s,"members":[`,
+		reportSchemaVersion, md); err != nil {
+		return nil, err
+	}
+	return &jsonReportEncoder{w: w}, nil
+}
+
+func (e *jsonReportEncoder) encode(r memberReport) error {
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if e.members > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.members++
+	_, err = e.w.Write(buf)
+	return err
+}
+
+func (e *jsonReportEncoder) close(sum orgSummary) error {
+	buf, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "],\"summary\":%s}\n", buf)
+	return err
+}
+
+// ndjsonRecord is a line of an NDJSON report.
+//
+//	{"schemaVersion":1,"kind":"metadata","metadata":{...}}
+//	{"schemaVersion":1,"kind":"member","member":{...}}
+//	{"schemaVersion":1,"kind":"summary","summary":{...}}
+type ndjsonRecord struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Kind          string          `json:"kind"`
+	Metadata      *reportMetadata `json:"metadata,omitempty"`
+	Member        *memberReport   `json:"member,omitempty"`
+	Summary       *orgSummary     `json:"summary,omitempty"`
+}
+
+type ndjsonReportEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONReportEncoder(
+	w io.Writer, opts options) (*ndjsonReportEncoder, error) {
+
+	e := &ndjsonReportEncoder{enc: json.NewEncoder(w)}
+	md := newReportMetadata(opts)
+	if err := e.enc.Encode(ndjsonRecord{
+		SchemaVersion: reportSchemaVersion,
+		Kind:          "metadata",
+		Metadata:      &md,
+	}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *ndjsonReportEncoder) encode(r memberReport) error {
+	return e.enc.Encode(ndjsonRecord{
+		SchemaVersion: reportSchemaVersion,
+		Kind:          "member",
+		Member:        &r,
+	})
+}
+
+func (e *ndjsonReportEncoder) close(sum orgSummary) error {
+	return e.enc.Encode(ndjsonRecord{
+		SchemaVersion: reportSchemaVersion,
+		Kind:          "summary",
+		Summary:       &sum,
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportEncoders(t *testing.T) {
+	var opts options
+	opts.config.UTC = true
+	opts.exclusions, _ = newExclusions(context.Background(), opts)
+
+	m := member{
+		Login:  "akutz",
+		Emails: []string{"akutz@vmware.com"},
+		Commits: []changeset{
+			{
+				Repo:       "vmware/impact",
+				Long:       "abc123",
+				Short:      "abc",
+				AuthorDate: time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC),
+				Changes: []changesetEntry{
+					{Add: 3, Del: 1, Path: "main.go"},
+					{Add: 10, Path: "vendor/lib/lib.go"},
+				},
+			},
+		},
+	}
+	r := m.report(opts)
+
+	if f := r.csvFields(); len(f) != len(csvReportHeader) {
+		t.Fatalf("len(fields)=%d, expected %d", len(f), len(csvReportHeader))
+	}
+
+	// The JSON fields are named after the CSV columns.
+	buf, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range csvReportHeader {
+		if _, ok := fields[h]; !ok {
+			t.Errorf("missing json field: %s", h)
+		}
+	}
+
+	encode := func(format string) string {
+		t.Helper()
+		w := &bytes.Buffer{}
+		e, err := newReportEncoder(w, format, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.encode(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.encode(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.close(orgSummary{}); err != nil {
+			t.Fatal(err)
+		}
+		return w.String()
+	}
+
+	var report struct {
+		SchemaVersion int            `json:"schemaVersion"`
+		Metadata      reportMetadata `json:"metadata"`
+		Members       []memberReport `json:"members"`
+	}
+	if err := json.Unmarshal([]byte(encode(formatJSON)), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.SchemaVersion != reportSchemaVersion {
+		t.Errorf("schemaVersion=%d, expected %d",
+			report.SchemaVersion, reportSchemaVersion)
+	}
+	if len(report.Members) != 2 {
+		t.Fatalf("len(members)=%d, expected 2", len(report.Members))
+	}
+	if mr := report.Members[0]; mr.Additions != 13 ||
+		mr.EffectiveAdditions != 3 || len(mr.CommitDetails) != 1 ||
+		mr.CommitDetails[0].SHA != "abc123" {
+		t.Errorf("member=%+v", mr)
+	}
+
+	var kinds []string
+	scan := bufio.NewScanner(strings.NewReader(encode(formatNDJSON)))
+	for scan.Scan() {
+		var rec ndjsonRecord
+		if err := json.Unmarshal(scan.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, rec.Kind)
+	}
+	if strings.Join(kinds, ",") != "metadata,member,member,summary" {
+		t.Errorf("kinds=%v", kinds)
+	}
+}
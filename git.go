@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -9,23 +10,55 @@ import (
 	"os/exec"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type changesetEntry struct {
-	Add  int    `json:"add"`
-	Del  int    `json:"del"`
-	Path string `json:"path"`
+	Add    int    `json:"add"`
+	Del    int    `json:"del"`
+	Path   string `json:"path"`
+	Binary bool   `json:"binary,omitempty"`
 }
 
 type changeset struct {
-	Short       string           `json:"shaShort"`
-	Long        string           `json:"shaLong"`
-	Subject     string           `json:"subject,omitempty"`
-	AuthorName  string           `json:"authorName,omitempty"`
-	AuthorEmail string           `json:"authorEmail,omitempty"`
-	AuthorDate  time.Time        `json:"authorDate"`
-	Changes     []changesetEntry `json:"changes"`
+	Repo           string           `json:"repo"`
+	Short          string           `json:"shaShort"`
+	Long           string           `json:"shaLong"`
+	Subject        string           `json:"subject,omitempty"`
+	AuthorName     string           `json:"authorName,omitempty"`
+	AuthorEmail    string           `json:"authorEmail,omitempty"`
+	AuthorDate     time.Time        `json:"authorDate"`
+	CommitterName  string           `json:"committerName,omitempty"`
+	CommitterEmail string           `json:"committerEmail,omitempty"`
+	CoAuthors      []coAuthor       `json:"coAuthors,omitempty"`
+	Changes        []changesetEntry `json:"changes"`
+
+	// CoAuthored is true when the member is credited with the commit
+	// by a Co-authored-by trailer instead of being its author.
+	CoAuthored bool `json:"coAuthored,omitempty"`
+}
+
+// coAuthor is a person credited with a commit by a Co-authored-by trailer.
+type coAuthor struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+var coAuthorRX = regexp.MustCompile(
+	`(?i)^\s*co-authored-by:\s*(.*?)\s*<([^>]+)>\s*$`)
+
+// parseCoAuthors returns the co-authors in a commit message's trailers.
+func parseCoAuthors(body, authorEmail string) []coAuthor {
+	var coAuthors []coAuthor
+	for _, line := range strings.Split(body, "\n") {
+		match := coAuthorRX.FindStringSubmatch(line)
+		if len(match) != 3 || strings.EqualFold(match[2], authorEmail) {
+			continue
+		}
+		coAuthors = append(coAuthors, coAuthor{Name: match[1], Email: match[2]})
+	}
+	return coAuthors
 }
 
 func (o options) waitForGit() {
@@ -37,6 +70,7 @@ func (o options) doneWithGit() {
 
 func git(
 	opts options,
+	gitDir string,
 	args ...string) (io.Reader, func(), func() error, error) {
 
 	opts.waitForGit()
@@ -44,7 +78,7 @@ func git(
 	args = append([]string{
 		"--no-pager",
 		"--git-dir",
-		opts.config.Git.TargetDir,
+		gitDir,
 	}, args...)
 	cmd := exec.Command("git", args...)
 
@@ -65,21 +99,127 @@ func git(
 	return stdout, opts.doneWithGit, cmd.Wait, nil
 }
 
-// gitLog gets the changesets for the user's available e-mail addresses.
+// gitOutput runs a git command to completion and returns its trimmed
+// stdout. The command's stderr is included in the returned error if the
+// command fails.
+func gitOutput(
+	ctx context.Context, opts options, args ...string) (string, error) {
+
+	opts.waitForGit()
+	defer opts.doneWithGit()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if opts.config.Debug {
+		log.Printf("%v\n", cmd.Args)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", &gitError{
+			args:   cmd.Args,
+			err:    err,
+			stderr: strings.TrimSpace(stderr.String()),
+		}
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitRun runs a git command to completion.
+func gitRun(ctx context.Context, opts options, args ...string) error {
+	_, err := gitOutput(ctx, opts, args...)
+	return err
+}
+
+type gitError struct {
+	args   []string
+	err    error
+	stderr string
+}
+
+func (e *gitError) Error() string {
+	return fmt.Sprintf("%v: %v: %s", e.args, e.err, e.stderr)
+}
+
+// exitCode returns the exit code of the failed git command or -1 if the
+// command did not exit.
+func (e *gitError) exitCode() int {
+	if err, ok := e.err.(*exec.ExitError); ok {
+		return err.ExitCode()
+	}
+	return -1
+}
+
+// gitHead returns the SHA of the HEAD commit in the git directory or an
+// empty string if the repository has no commits.
+func gitHead(ctx context.Context, opts options, gitDir string) (string, error) {
+	head, err := gitOutput(
+		ctx, opts, "--git-dir", gitDir, "rev-parse", "--verify", "--quiet",
+		"HEAD^{commit}")
+	if err != nil {
+		if err, ok := err.(*gitError); ok && err.exitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return head, nil
+}
+
+// gitIsAncestor returns a flag indicating whether or not the commit
+// ancestor is an ancestor of the commit descendant. A commit that no
+// longer exists is not an ancestor.
+func gitIsAncestor(
+	ctx context.Context,
+	opts options,
+	gitDir, ancestor, descendant string) (bool, error) {
+
+	err := gitRun(
+		ctx, opts, "--git-dir", gitDir, "merge-base", "--is-ancestor",
+		ancestor, descendant)
+	if err == nil {
+		return true, nil
+	}
+	if err, ok := err.(*gitError); ok && err.exitCode() > 0 {
+		return false, nil
+	}
+	return false, err
+}
+
+// changesetKey returns the key used to identify a changeset. The same
+// commit may be present in more than one target repository.
+func changesetKey(repo, sha string) string {
+	return repo + "@" + sha
+}
+
+// gitLog gets the changesets for the user's available e-mail addresses
+// from the git indexes of the target repositories.
 func (m *member) gitLog(ctx context.Context, opts options) error {
 	changesets := map[string]changeset{}
 	knownChangesets := map[string]struct{}{}
 
 	// Add the existing changesets to the list so dupes don't get added.
 	for _, cs := range m.Commits {
-		knownChangesets[cs.Long] = struct{}{}
+		knownChangesets[changesetKey(cs.Repo, cs.Long)] = struct{}{}
 	}
 
-	for _, email := range m.Emails {
-		if err := m.findChangesets(
-			ctx, email, knownChangesets, changesets, opts); err != nil {
+	for _, t := range opts.targets {
+		x, ok := opts.gitIndexes[t.String()]
+		if !ok {
+			continue
+		}
+		emails, err := x.canonicalEmails(ctx, opts, m.Emails)
+		if err != nil {
 			return err
 		}
+		for _, email := range emails {
+			m.findChangesets(
+				x.lookupEmail(email), knownChangesets, changesets, opts)
+		}
+		for _, name := range opts.aliases.names(m.Login) {
+			m.findChangesets(
+				x.lookupName(name), knownChangesets, changesets, opts)
+		}
 	}
 	for _, commit := range changesets {
 		m.Commits = append(m.Commits, commit)
@@ -87,131 +227,171 @@ func (m *member) gitLog(ctx context.Context, opts options) error {
 	return nil
 }
 
-// findChangesets finds the changesets for the provided author.
+// findChangesets adds the member's indexed changesets that are not
+// already known.
 func (m member) findChangesets(
-	ctx context.Context,
-	author string,
+	commits []changeset,
 	knownChangesets map[string]struct{},
 	changesets map[string]changeset,
-	opts options) error {
-
-	r, done, wait, err := git(
-		opts,
-		"log",
-		"--author",
-		author,
-		`--format=format:%h%n%H%n%s%n%an%n%ae%n%at`,
-		"--numstat")
-	if err != nil {
-		return err
+	opts options) {
+
+	for _, cur := range commits {
+		key := changesetKey(cur.Repo, cur.Long)
+		if _, ok := knownChangesets[key]; ok {
+			// Ignore existing commit
+			continue
+		}
+
+		if opts.config.UTC {
+			cur.AuthorDate = cur.AuthorDate.UTC()
+		} else {
+			cur.AuthorDate = cur.AuthorDate.Local()
+		}
+
+		// Only count the commit if it occurred during the time which
+		// the member was employed with the source organization.
+		var validCommit bool
+		for _, e := range m.Employed {
+			if e.From != nil && cur.AuthorDate.After(*e.From) {
+				if e.Until == nil || cur.AuthorDate.Before(*e.Until) {
+					validCommit = true
+					break
+				}
+			}
+		}
+
+		// A commit found as both authored and co-authored by the
+		// member's e-mail addresses is an authored commit.
+		if validCommit {
+			if e, ok := changesets[key]; !ok || e.CoAuthored {
+				changesets[key] = cur
+			}
+		} else if opts.config.Debug {
+			log.Printf("ignoring commit: sha=%s, date=%s, author=%s <%s>",
+				cur.Short, cur.AuthorDate, cur.AuthorName, cur.AuthorEmail)
+		}
 	}
-	defer done()
+}
+
+// gitLogFormat is the format of the commits parsed by parseGitLog. Each
+// commit begins with a record separator and its body ends with a group
+// separator.
+const gitLogFormat = "--format=format:" +
+	"%x1e%h%n%H%n%s%n%aN%n%aE%n%at%n%cN%n%cE%n%b%x1d"
+
+// parseGitLog parses the output of "git log --numstat" using
+// gitLogFormat and invokes fn for each of the changesets.
+func parseGitLog(
+	ctx context.Context,
+	r io.Reader,
+	repo string,
+	fn func(changeset) error) error {
 
 	var (
 		scan     = bufio.NewScanner(r)
 		addDelRX = regexp.MustCompile(`^(\-|\d+)\s+(\-|\d+)\s*([^\s].*)$`)
+		cur      *changeset
 	)
 
-	// COMMIT_ID_SHORT
+	// Subjects and paths may be longer than the default buffer.
+	scan.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		err := fn(*cur)
+		cur = nil
+		return err
+	}
+
+	// <RECORD SEPARATOR>COMMIT_ID_SHORT
 	// COMMIT_ID_LONG
 	// SUBJECT
 	// AUTHOR_NAME
 	// AUTHOR_EMAIL
 	// AUTHOR_DATE (UNIX epoch)
+	// COMMITTER_NAME
+	// COMMITTER_EMAIL
+	// BODY...<GROUP SEPARATOR>
+	// <BLANK LINE>
 	// ADD_N     DEL_N     FILE_NAME
 	// ADD_N     DEL_N     FILE_NAME
 	// ...
-	// <BLANK LINE>
-	var doNotScan bool
-	for ctx.Err() == nil {
-		if !doNotScan {
-			doNotScan = false
-			if !scan.Scan() {
-				break
-			}
-		}
-		var cur changeset
-		cur.Short = scan.Text()
-		scan.Scan()
-		cur.Long = scan.Text()
-		scan.Scan()
-		cur.Subject = scan.Text()
-		scan.Scan()
-		cur.AuthorName = scan.Text()
-		scan.Scan()
-		cur.AuthorEmail = scan.Text()
-		scan.Scan()
-		epoch, _ := strconv.ParseInt(scan.Text(), 10, 64)
-		cur.AuthorDate = time.Unix(epoch, 0)
-		if opts.config.UTC {
-			cur.AuthorDate = cur.AuthorDate.UTC()
-		}
-
-		// Advance to the next line. This may or may not be the
-		// next commit. The issue is when additions/deletions are
-		// absent. When this is the case there is no break between
-		// one commit to the next. Injecting a new line into the
-		// format doesn't help because it would still be necessary to
-		// test to see if additions/deletions are encountered.
-		if !scan.Scan() {
-			break
-		}
-
-		// Check to see if the current line is an additions/deletion line
-		if !addDelRX.MatchString(scan.Text()) {
-			// No additions/deletion found. Jump to the next iteration
-			// of this for loop, but indicate that the next Scan() should
-			// be disabled since we're already sitting at the top of a
-			// new commit entry.
-			doNotScan = true
-			continue
-		}
+	for ctx.Err() == nil && scan.Scan() {
+		line := scan.Text()
 
-		// At this point the line is an additions/deletions line
-		for scan.Text() != "" {
-			var entry changesetEntry
-			match := addDelRX.FindStringSubmatch(scan.Text())
-			if len(match) != 4 {
-				return fmt.Errorf(
-					"error matching changeset add/del line: "+
-						"login=%s, author=%s, line=%s, changeset=%+v",
-					m.Login, author, scan.Text(), cur)
+		if strings.HasPrefix(line, "\x1e") {
+			if err := flush(); err != nil {
+				return err
 			}
-			entry.Add, _ = strconv.Atoi(match[1])
-			entry.Del, _ = strconv.Atoi(match[2])
-			entry.Path = match[3]
-
-			cur.Changes = append(cur.Changes, entry)
-
-			if !scan.Scan() {
-				break
+			cur = &changeset{Repo: repo}
+			cur.Short = strings.TrimPrefix(line, "\x1e")
+			header := []*string{
+				&cur.Long,
+				&cur.Subject,
+				&cur.AuthorName,
+				&cur.AuthorEmail,
+				nil,
+				&cur.CommitterName,
+				&cur.CommitterEmail,
 			}
-		}
-
-		if _, ok := knownChangesets[cur.Long]; ok {
-			// Ignore existing commit
-			continue
-		}
-
-		// Only count the commit if it occurred during the time which
-		// the member was employed with the source organization.
-		var validCommit bool
-		for _, e := range m.Employed {
-			if e.From != nil && cur.AuthorDate.After(*e.From) {
-				if e.Until == nil || cur.AuthorDate.Before(*e.Until) {
-					validCommit = true
+			for _, field := range header {
+				if !scan.Scan() {
+					return fmt.Errorf(
+						"error reading changeset header: repo=%s, "+
+							"changeset=%+v", repo, *cur)
+				}
+				if field != nil {
+					*field = scan.Text()
+					continue
+				}
+				epoch, _ := strconv.ParseInt(scan.Text(), 10, 64)
+				cur.AuthorDate = time.Unix(epoch, 0)
+			}
+			var body []string
+			for {
+				if !scan.Scan() {
+					return fmt.Errorf(
+						"error reading changeset body: repo=%s, "+
+							"changeset=%+v", repo, *cur)
+				}
+				line := scan.Text()
+				if i := strings.Index(line, "\x1d"); i >= 0 {
+					body = append(body, line[:i])
 					break
 				}
+				body = append(body, line)
 			}
+			cur.CoAuthors = parseCoAuthors(
+				strings.Join(body, "\n"), cur.AuthorEmail)
+			continue
 		}
 
-		if validCommit {
-			changesets[cur.Long] = cur
-		} else if opts.config.Debug {
-			log.Printf("ignoring commit: sha=%s, date=%s, author=%s <%s>",
-				cur.Short, cur.AuthorDate, cur.AuthorName, cur.AuthorEmail)
+		if line == "" || cur == nil {
+			continue
+		}
+
+		match := addDelRX.FindStringSubmatch(line)
+		if len(match) != 4 {
+			return fmt.Errorf(
+				"error matching changeset add/del line: "+
+					"repo=%s, line=%s, changeset=%+v",
+				repo, line, *cur)
 		}
+		var entry changesetEntry
+		entry.Add, _ = strconv.Atoi(match[1])
+		entry.Del, _ = strconv.Atoi(match[2])
+		entry.Path = match[3]
+		entry.Binary = match[1] == "-" && match[2] == "-"
+		cur.Changes = append(cur.Changes, entry)
 	}
 
-	return wait()
+	if err := scan.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return flush()
 }
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGitIndex(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcDir := path.Join(tmpDir, "src")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(file string) string {
+		t.Helper()
+		if err := ioutil.WriteFile(
+			path.Join(srcDir, file), []byte(file+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, srcDir, "add", file)
+		runGit(t, srcDir, "commit", "--quiet", "-m", file)
+		return runGit(t, srcDir, "rev-parse", "HEAD")
+	}
+
+	runGit(t, srcDir, "init", "--quiet")
+	first := commit("first")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "empty")
+	second := commit("second")
+
+	var opts options
+	opts.config.OutputDir = path.Join(tmpDir, "data")
+	opts.chanGit = make(chan struct{}, 1)
+
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact", GitDir: srcDir + "/.git"}
+
+	assertIndex := func(expHead string, expCommits ...string) {
+		t.Helper()
+		if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+			t.Fatal(err)
+		}
+		if tgt.Head != expHead {
+			t.Fatalf("head=%s, expected %s", tgt.Head, expHead)
+		}
+		x, err := getGitIndex(ctx, tgt, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x.Head != expHead {
+			t.Fatalf("index head=%s, expected %s", x.Head, expHead)
+		}
+		commits := x.lookupEmail("akutz@vmware.com")
+		if len(commits) != len(expCommits) {
+			t.Fatalf("len(commits)=%d, expected %d",
+				len(commits), len(expCommits))
+		}
+		for i, c := range commits {
+			if c.Subject != expCommits[i] {
+				t.Errorf("commits[%d]=%s, expected %s",
+					i, c.Subject, expCommits[i])
+			}
+			if c.Repo != tgt.String() {
+				t.Errorf("commits[%d].Repo=%s, expected %s",
+					i, c.Repo, tgt.String())
+			}
+		}
+		if n := len(x.lookupEmail("nobody@vmware.com")); n != 0 {
+			t.Errorf("len(commits)=%d, expected 0", n)
+		}
+	}
+
+	// The index is built from scratch.
+	assertIndex(second, "second", "empty", "first")
+
+	// The index is updated with the new commits.
+	third := commit("third")
+	assertIndex(third, "third", "second", "empty", "first")
+
+	// The index is rebuilt when its HEAD is no longer an ancestor.
+	runGit(t, srcDir, "reset", "--quiet", "--hard", first)
+	amended := commit("amended")
+	assertIndex(amended, "amended", "first")
+
+	x, err := getGitIndex(ctx, tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := x.Commits[0]; len(c.Changes) != 1 ||
+		c.Changes[0].Path != "amended" || c.Changes[0].Add != 1 {
+		t.Errorf("changes=%+v", c.Changes)
+	}
+}
+
+func TestGitIndexWindow(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	srcDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+	defer os.Unsetenv("GIT_COMMITTER_DATE")
+
+	commit := func(subject, authored, committed string) {
+		t.Helper()
+		os.Setenv("GIT_COMMITTER_DATE", committed+"T12:00:00Z")
+		runGit(t, srcDir, "commit", "--quiet", "--allow-empty",
+			"--date", authored+"T12:00:00Z", "-m", subject)
+	}
+
+	runGit(t, srcDir, "init", "--quiet")
+	commit("june", "2018-06-15", "2018-06-15")
+	commit("rebased", "2018-06-20", "2018-07-15")
+	commit("july", "2018-07-20", "2018-07-20")
+	commit("october", "2018-10-05", "2018-10-05")
+
+	var opts options
+	opts.config.OutputDir = path.Join(srcDir, "data")
+	opts.config.UTC = true
+	opts.chanGit = make(chan struct{}, 1)
+	if opts.config.Since, err = parseWindowTime("2018-07-01", opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.config.Until, err = parseWindowTime("2018-10-01", opts); err != nil {
+		t.Fatal(err)
+	}
+	since, until := opts.config.Since, opts.config.Until
+
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact", GitDir: srcDir + "/.git"}
+	if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+		t.Fatal(err)
+	}
+
+	assertIndex := func(expCommits ...string) {
+		t.Helper()
+		x, err := getGitIndex(ctx, tgt, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits := x.lookupEmail("akutz@vmware.com")
+		if len(commits) != len(expCommits) {
+			t.Fatalf("len(commits)=%d, expected %d",
+				len(commits), len(expCommits))
+		}
+		for i, c := range commits {
+			if c.Subject != expCommits[i] {
+				t.Errorf("commits[%d]=%s, expected %s",
+					i, c.Subject, expCommits[i])
+			}
+		}
+	}
+
+	// Only the commits authored in the window are indexed.
+	assertIndex("july")
+
+	// The index is rebuilt for a wider window.
+	opts.config.Until = nil
+	assertIndex("october", "july")
+	opts.config.Since = nil
+	assertIndex("october", "july", "rebased", "june")
+
+	// An index built for a wider window is used for a narrower one.
+	opts.config.Since, opts.config.Until = since, until
+	assertIndex("october", "july", "rebased", "june")
+}
+
+func TestGitIndexCoAuthors(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	srcDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	runGit(t, srcDir, "init", "--quiet")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty",
+		"--author", "Bob <bob@vmware.com>",
+		"-m", "paired",
+		"-m", "Some details.\n\nCo-authored-by: Andrew Kutz <akutz@vmware.com>")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "solo")
+
+	var opts options
+	opts.config.OutputDir = path.Join(srcDir, "data")
+	opts.chanGit = make(chan struct{}, 1)
+
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact", GitDir: srcDir + "/.git"}
+	if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+		t.Fatal(err)
+	}
+	x, err := getGitIndex(ctx, tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commits := x.lookupEmail("akutz@vmware.com")
+	if len(commits) != 2 {
+		t.Fatalf("len(commits)=%d, expected 2", len(commits))
+	}
+	for _, c := range commits {
+		switch c.Subject {
+		case "solo":
+			if c.CoAuthored {
+				t.Error("solo commit is co-authored")
+			}
+		case "paired":
+			if !c.CoAuthored {
+				t.Error("paired commit is not co-authored")
+			}
+			if len(c.CoAuthors) != 1 ||
+				c.CoAuthors[0].Name != "Andrew Kutz" {
+				t.Errorf("coAuthors=%+v", c.CoAuthors)
+			}
+		default:
+			t.Errorf("unexpected commit: %s", c.Subject)
+		}
+	}
+
+	if commits := x.lookupEmail("bob@vmware.com"); len(commits) != 1 ||
+		commits[0].CoAuthored {
+		t.Errorf("bob's commits=%+v", commits)
+	}
+}
+
+func TestGitIndexMailmap(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	srcDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	runGit(t, srcDir, "init", "--quiet")
+	if err := ioutil.WriteFile(
+		path.Join(srcDir, ".mailmap"),
+		[]byte("Andrew Kutz <akutz@vmware.com> <andrew@kutz.io>\n"),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, srcDir, "add", ".mailmap")
+	runGit(t, srcDir, "commit", "--quiet", "-m", "mailmap",
+		"--author", "Andy <andrew@kutz.io>")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "jimbob",
+		"--author", "Jim Bob <jimakutz@vmware.com>")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "paired",
+		"--author", "Jim Bob <jimakutz@vmware.com>",
+		"-m", "Co-authored-by: Andy <andrew@kutz.io>")
+
+	var opts options
+	opts.config.OutputDir = path.Join(srcDir, "data")
+	opts.chanGit = make(chan struct{}, 1)
+
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact", GitDir: srcDir + "/.git"}
+	if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+		t.Fatal(err)
+	}
+	x, err := getGitIndex(ctx, tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The e-mail address does not match jimakutz@vmware.com, and the
+	// mailmapped author and co-author match.
+	commits := x.lookupEmail("AKUTZ@vmware.com")
+	if len(commits) != 2 {
+		t.Fatalf("len(commits)=%d, expected 2: %+v", len(commits), commits)
+	}
+	for _, c := range commits {
+		if c.Subject == "paired" && !c.CoAuthored {
+			t.Error("paired commit is not co-authored")
+		}
+		if c.Subject == "mailmap" && c.AuthorName != "Andrew Kutz" {
+			t.Errorf("authorName=%s, expected Andrew Kutz", c.AuthorName)
+		}
+	}
+	// A member whose e-mail address is mapped to the canonical address
+	// finds the canonical identity's commits.
+	emails, err := x.canonicalEmails(
+		ctx, opts, []string{"Andrew@Kutz.io", "jimakutz@vmware.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expEmails := []string{
+		"andrew@kutz.io", "akutz@vmware.com", "jimakutz@vmware.com"}
+	if !reflect.DeepEqual([]string(emails), expEmails) {
+		t.Errorf("emails=%v, expected %v", emails, expEmails)
+	}
+	m := member{
+		Login:    "akutz",
+		Emails:   []string{"andrew@kutz.io"},
+		Employed: uniqueDateRangeSlice{{From: &time.Time{}}},
+	}
+	opts.targets = []target{tgt}
+	opts.gitIndexes = map[string]*gitIndex{tgt.String(): x}
+	if err := m.gitLog(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Commits) != 2 {
+		t.Errorf("len(m.Commits)=%d, expected 2", len(m.Commits))
+	}
+	if n := len(x.lookupName("jim bob")); n != 2 {
+		t.Errorf("len(commits)=%d, expected 2", n)
+	}
+
+	// Changing the .mailmap file rebuilds the index, so the older commits
+	// are canonicalized with the new identities.
+	if err := ioutil.WriteFile(
+		path.Join(srcDir, ".mailmap"),
+		[]byte("Andrew Kutz <akutz@vmware.com> <andrew@kutz.io>\n"+
+			"James Bob <jbob@vmware.com> <jimakutz@vmware.com>\n"),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, srcDir, "commit", "--quiet", "-a", "-m", "jbob",
+		"--author", "Jim Bob <jimakutz@vmware.com>")
+	if tgt.Head, err = gitHead(ctx, opts, tgt.GitDir); err != nil {
+		t.Fatal(err)
+	}
+	mailmap := x.Mailmap
+	if x, err = getGitIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if x.Mailmap == "" || x.Mailmap == mailmap {
+		t.Errorf("mailmap=%s, expected a new blob ID", x.Mailmap)
+	}
+	if n := len(x.lookupEmail("jbob@vmware.com")); n != 3 {
+		t.Errorf("len(commits)=%d, expected 3", n)
+	}
+	if n := len(x.lookupEmail("jimakutz@vmware.com")); n != 0 {
+		t.Errorf("len(commits)=%d, expected 0", n)
+	}
+}
+
+func TestMailmapIdent(t *testing.T) {
+	for _, tc := range []struct {
+		name, email, exp string
+	}{
+		{"Andrew Kutz", "akutz@vmware.com", "Andrew Kutz <akutz@vmware.com>"},
+		{"", "akutz@vmware.com", "<akutz@vmware.com>"},
+	} {
+		if act := mailmapIdent(tc.name, tc.email); act != tc.exp {
+			t.Errorf("exp=%q act=%q", tc.exp, act)
+		}
+	}
+}
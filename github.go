@@ -3,8 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
+	"net/http"
 	"sync"
 	"time"
 
@@ -12,32 +11,30 @@ import (
 	"golang.org/x/oauth2"
 )
 
-func newGitHubAPIClient(ctx context.Context, apiKey string) *github.Client {
+func newGitHubAPIClient(
+	ctx context.Context,
+	tokens []oauth2.TokenSource,
+	transport http.RoundTripper,
+	opts options) (*github.Client, error) {
 
-	// Create a new token source.
-	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: apiKey})
-
-	// Create a new Oauth2 client
-	oauth2Client := oauth2.NewClient(ctx, tokenSource)
+	// Unless disabled, cache the API responses and revalidate them with
+	// conditional requests.
+	if !opts.config.GitHub.NoCache {
+		transport = newHTTPCacheTransport(httpCacheDir(opts), transport)
+	}
 
-	// Create a new GitHub client.
-	return github.NewClient(oauth2Client)
-}
+	// Authenticate each API call with the token that has the most
+	// remaining calls.
+	transport = newTokenPool(tokens, transport)
 
-func (o options) waitForAPI() {
-	o.chanAPI <- struct{}{}
-}
-func (o options) doneWithAPI() {
-	go func() {
-		time.Sleep(o.config.GitHub.API.Wait)
-		<-o.chanAPI
-	}()
-}
-
-func printRateLimit(rep *github.Response, opts options) {
-	if rep != nil && opts.config.GitHub.API.ShowRateLimit {
-		fmt.Fprintln(os.Stderr, formatRateReset(rep.Rate))
+	// Create a new GitHub client, which may be for a GitHub Enterprise
+	// Server.
+	client := &http.Client{Transport: transport}
+	if opts.config.GitHub.BaseURL == "" && opts.config.GitHub.UploadURL == "" {
+		return github.NewClient(client), nil
 	}
+	return github.NewEnterpriseClient(
+		apiBaseURL(opts), apiUploadURL(opts), client)
 }
 
 // formatRateReset formats d to look like "[rate reset in 2s]" or
@@ -74,41 +71,17 @@ func formatRateReset(r github.Rate) string {
 		r.Limit, r.Remaining, timeString)
 }
 
-func retryAfter(rep *github.Response, cur *int, opts options) bool {
-	if *cur > opts.config.GitHub.API.Retries {
-		return false
-	}
-
-	if rep == nil {
-		return false
-	}
-
-	if v := rep.Header["Retry-After"]; len(v) > 0 {
-		if secs, _ := strconv.Atoi(v[0]); secs > 0 {
-			time.Sleep(time.Duration(secs) * time.Second)
-		}
-	} else if rep.StatusCode == 500 {
-		time.Sleep(opts.config.GitHub.API.RetryWait)
-	} else {
-		return false
-	}
-
-	*cur++
-	return true
-}
-
 func (m *member) loadFromGitHub(ctx context.Context, opts options) error {
 	if opts.config.GitHub.NoUsers {
 		return nil
 	}
 	retries := 0
 	for {
-		opts.waitForAPI()
+		opts.api.wait(ctx)
 		user, rep, err := opts.github.Users.Get(ctx, m.Login)
-		opts.doneWithAPI()
-		printRateLimit(rep, opts)
+		opts.api.done(rep)
 		if err != nil {
-			if retryAfter(rep, &retries, opts) {
+			if opts.api.retry(ctx, rep, err, &retries) {
 				continue
 			}
 			return err
@@ -146,15 +119,14 @@ func fetchMemberLogins(
 		retries := 0
 
 		for ctx.Err() == nil && listOpts.Page > 0 {
-			opts.waitForAPI()
+			opts.api.wait(ctx)
 			members, rep, err := opts.github.Organizations.ListMembers(
 				ctx,
 				opts.config.MemberOrg,
 				listOpts)
-			opts.doneWithAPI()
-			printRateLimit(rep, opts)
+			opts.api.done(rep)
 			if err != nil {
-				if retryAfter(rep, &retries, opts) {
+				if opts.api.retry(ctx, rep, err, &retries) {
 					continue
 				}
 				chanErrs <- err
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitIndex is every commit reachable from a target's HEAD, indexed by
+// author.
+type gitIndex struct {
+	Version int    `json:"version"`
+	Head    string `json:"head"`
+
+	// Mailmap is the ID of the .mailmap blob with which the identities
+	// were canonicalized. The index is rebuilt when it changes.
+	Mailmap string `json:"mailmap,omitempty"`
+
+	// Since and Until are the -since and -until with which the index was
+	// built. The index holds the commits authored in the window, and is
+	// rebuilt when a window it does not cover is reported.
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+
+	Commits []changeset `json:"commits"`
+
+	authors   identityIndex
+	coAuthors identityIndex
+
+	// gitDir is the target's git directory, which is used to canonicalize
+	// the e-mail addresses that are looked up.
+	gitDir string
+
+	// mailmapped maps the lower-cased e-mail addresses that were looked up
+	// to their lower-cased canonical e-mail addresses.
+	mu         sync.Mutex
+	mailmapped map[string]string
+}
+
+// gitMailmapBlob configures git to read the .mailmap file from HEAD. Git
+// only does this by default for bare repositories, but a target's git
+// directory may belong to a working copy.
+const gitMailmapBlob = "mailmap.blob=HEAD:.mailmap"
+
+// gitIndexVersion is incremented when the data collected for each commit
+// changes. Cached indexes with a different version are rebuilt.
+const gitIndexVersion = 3
+
+// identityIndex maps the lower-cased names and e-mail addresses of
+// identities to the indexes of their commits.
+type identityIndex struct {
+	names  map[string][]int
+	emails map[string][]int
+}
+
+func newIdentityIndex() identityIndex {
+	return identityIndex{names: map[string][]int{}, emails: map[string][]int{}}
+}
+
+func (ii identityIndex) add(name, email string, i int) {
+	if name != "" {
+		name = strings.ToLower(name)
+		ii.names[name] = append(ii.names[name], i)
+	}
+	if email != "" {
+		email = strings.ToLower(email)
+		ii.emails[email] = append(ii.emails[email], i)
+	}
+}
+
+func gitIndexFilePath(t target, opts options) string {
+	return path.Join(
+		opts.config.OutputDir, ".cache", "index", t.Org, t.Repo+".json.gz")
+}
+
+func (x *gitIndex) loadFromDisk(t target, opts options) error {
+	f, err := os.Open(gitIndexFilePath(t, opts))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return json.NewDecoder(r).Decode(x)
+}
+
+func (x *gitIndex) writeToDisk(t target, opts options) error {
+	filePath := gitIndexFilePath(t, opts)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := gzip.NewWriter(f)
+	if err := json.NewEncoder(w).Encode(x); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (x *gitIndex) reindex() {
+	x.authors = newIdentityIndex()
+	x.coAuthors = newIdentityIndex()
+	for i, c := range x.Commits {
+		x.authors.add(c.AuthorName, c.AuthorEmail, i)
+		for _, ca := range c.CoAuthors {
+			x.coAuthors.add(ca.Name, ca.Email, i)
+		}
+	}
+}
+
+// canonicalEmails returns the e-mail addresses and their canonical e-mail
+// addresses according to the target's .mailmap file.
+func (x *gitIndex) canonicalEmails(
+	ctx context.Context, opts options, emails []string) ([]string, error) {
+
+	// Without a .mailmap file every e-mail address is canonical.
+	if x.Mailmap == "" {
+		return emails, nil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.mailmapped == nil {
+		x.mailmapped = map[string]string{}
+	}
+	var unknown []string
+	for _, email := range emails {
+		email = strings.ToLower(email)
+		if _, ok := x.mailmapped[email]; !ok {
+			unknown = append(unknown, email)
+		}
+	}
+	if len(unknown) > 0 {
+		canonical, err := checkMailmap(ctx, opts, x.gitDir, unknown)
+		if err != nil {
+			return nil, err
+		}
+		for i, email := range unknown {
+			x.mailmapped[email] = strings.ToLower(canonical[i].Email)
+		}
+	}
+
+	var result uniqueStringSlice
+	for _, email := range emails {
+		email = strings.ToLower(email)
+		result.append(email)
+		result.append(x.mailmapped[email])
+	}
+	return result, nil
+}
+
+// lookupEmail returns the commits authored or co-authored by the e-mail
+// address. Co-authored commits are marked as such.
+func (x *gitIndex) lookupEmail(email string) []changeset {
+	email = strings.ToLower(email)
+	return x.commits(x.authors.emails[email], x.coAuthors.emails[email])
+}
+
+// lookupName returns the commits authored or co-authored by the name.
+// Co-authored commits are marked as such.
+func (x *gitIndex) lookupName(name string) []changeset {
+	name = strings.ToLower(name)
+	return x.commits(x.authors.names[name], x.coAuthors.names[name])
+}
+
+func (x *gitIndex) commits(authored, coAuthored []int) []changeset {
+	var commits []changeset
+	for _, i := range authored {
+		commits = append(commits, x.Commits[i])
+	}
+	for _, i := range coAuthored {
+		c := x.Commits[i]
+		c.CoAuthored = true
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+// getGitIndexes returns the git indexes for all of the targets with a
+// git directory, keyed by target.
+func getGitIndexes(
+	ctx context.Context, opts options) (map[string]*gitIndex, error) {
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		indexes  = map[string]*gitIndex{}
+		chanErrs = make(chan error, len(opts.targets))
+	)
+
+	for _, t := range opts.targets {
+		if t.GitDir == "" || t.Head == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			x, err := getGitIndex(ctx, t, opts)
+			if err != nil {
+				chanErrs <- err
+				return
+			}
+			mu.Lock()
+			indexes[t.String()] = x
+			mu.Unlock()
+		}(t)
+	}
+
+	wg.Wait()
+	close(chanErrs)
+
+	if err := <-chanErrs; err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// getGitIndex loads the target's cached git index and updates it with the
+// commits added since the index's HEAD.
+func getGitIndex(
+	ctx context.Context, t target, opts options) (*gitIndex, error) {
+
+	mailmap, err := gitMailmapID(ctx, opts, t)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &gitIndex{}
+	if err := x.loadFromDisk(t, opts); err != nil {
+		return nil, err
+	}
+	since, until := opts.config.Since, opts.config.Until
+	if x.Version != gitIndexVersion || x.Mailmap != mailmap ||
+		!windowCovers(x.Since, x.Until, since, until) {
+		if opts.config.Debug && x.Version == gitIndexVersion {
+			log.Printf(
+				"rebuilding git index: repo=%s, mailmap=%s, last mailmap=%s, "+
+					"window=%s..%s, last window=%s..%s",
+				t, mailmap, x.Mailmap,
+				formatWindowTime(since), formatWindowTime(until),
+				formatWindowTime(x.Since), formatWindowTime(x.Until))
+		}
+		x = &gitIndex{
+			Version: gitIndexVersion,
+			Mailmap: mailmap,
+			Since:   since,
+			Until:   until,
+		}
+	}
+
+	x.gitDir = t.GitDir
+	if x.Head == t.Head {
+		x.reindex()
+		return x, nil
+	}
+
+	revs := t.Head
+	if x.Head != "" {
+		ok, err := gitIsAncestor(ctx, opts, t.GitDir, x.Head, t.Head)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			revs = fmt.Sprintf("%s..%s", x.Head, t.Head)
+		} else {
+			if opts.config.Debug {
+				log.Printf(
+					"rebuilding git index: repo=%s, "+
+						"last=%s is not an ancestor of head=%s",
+					t, x.Head, t.Head)
+			}
+			x.Commits = nil
+		}
+	}
+
+	// Git stops walking the history at the commits committed before the
+	// start of the window. A commit is never committed before it was
+	// authored, so the commits authored in the window are filtered by
+	// their author dates as they are parsed.
+	args := []string{
+		"-c", gitMailmapBlob, "log", gitLogFormat, "--numstat", "-M"}
+	if x.Since != nil {
+		args = append(args, "--since="+formatWindowTime(x.Since))
+	}
+	args = append(args, revs)
+
+	r, done, wait, err := git(opts, t.GitDir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []changeset
+	err = parseGitLog(ctx, r, t.String(), func(c changeset) error {
+		if inTimeWindow(c.AuthorDate, x.Since, x.Until) {
+			commits = append(commits, c)
+		}
+		return nil
+	})
+	if err != nil {
+		io.Copy(ioutil.Discard, r)
+	}
+	if werr := wait(); err == nil {
+		err = werr
+	}
+
+	// Release the git command before canonicalizing the co-authors
+	// since that runs more git commands.
+	done()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := canonicalizeCoAuthors(ctx, t, commits, opts); err != nil {
+		return nil, err
+	}
+
+	// The log lists the newest commits first.
+	x.Commits = append(commits, x.Commits...)
+	x.Head = t.Head
+	if err := x.writeToDisk(t, opts); err != nil {
+		return nil, err
+	}
+
+	x.reindex()
+	return x, nil
+}
+
+// mailmapIdentRX matches the identities printed by "git check-mailmap".
+var mailmapIdentRX = regexp.MustCompile(`^(.*?)\s*<([^>]*)>$`)
+
+// gitMailmapID returns the ID of the .mailmap blob in the target's HEAD,
+// or an empty string if HEAD does not have a .mailmap file.
+func gitMailmapID(
+	ctx context.Context, opts options, t target) (string, error) {
+
+	id, err := gitOutput(
+		ctx, opts,
+		"--git-dir", t.GitDir,
+		"rev-parse", "--verify", "--quiet", t.Head+":.mailmap")
+	if err == nil {
+		return id, nil
+	}
+	if err, ok := err.(*gitError); ok && err.exitCode() > 0 {
+		return "", nil
+	}
+	return "", err
+}
+
+// mailmapIdent formats an identity for "git check-mailmap", which accepts
+// an e-mail address without a name.
+func mailmapIdent(name, email string) string {
+	if name == "" {
+		return fmt.Sprintf("<%s>", email)
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+// checkMailmap returns the canonical identities of the identities, which
+// are formatted with mailmapIdent or are e-mail addresses, according to
+// the .mailmap file in HEAD of the git directory.
+func checkMailmap(
+	ctx context.Context,
+	opts options,
+	gitDir string,
+	idents []string) ([]coAuthor, error) {
+
+	canonical := make([]coAuthor, 0, len(idents))
+
+	// Resolve the identities in batches to avoid exceeding the maximum
+	// length of a command line.
+	const batchSize = 100
+	for i := 0; i < len(idents); i += batchSize {
+		batch := idents[i:]
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		args := []string{
+			"--git-dir", gitDir,
+			"-c", gitMailmapBlob,
+			"check-mailmap",
+		}
+		for _, ident := range batch {
+			if !strings.Contains(ident, "<") {
+				ident = mailmapIdent("", ident)
+			}
+			args = append(args, ident)
+		}
+		out, err := gitOutput(ctx, opts, args...)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(out, "\n")
+		if len(lines) != len(batch) {
+			return nil, fmt.Errorf(
+				"error checking mailmap: gitDir=%s, "+
+					"identities=%d, results=%d",
+				gitDir, len(batch), len(lines))
+		}
+		for _, line := range lines {
+			match := mailmapIdentRX.FindStringSubmatch(line)
+			if len(match) != 3 {
+				return nil, fmt.Errorf(
+					"error matching mailmap identity: gitDir=%s, line=%s",
+					gitDir, line)
+			}
+			canonical = append(canonical, coAuthor{Name: match[1], Email: match[2]})
+		}
+	}
+	return canonical, nil
+}
+
+// canonicalizeCoAuthors applies the target's .mailmap file to the
+// commits' co-authors. The authors and committers are canonicalized by
+// "git log" itself.
+func canonicalizeCoAuthors(
+	ctx context.Context, t target, commits []changeset, opts options) error {
+
+	var idents uniqueStringSlice
+	for _, c := range commits {
+		for _, ca := range c.CoAuthors {
+			idents.append(mailmapIdent(ca.Name, ca.Email))
+		}
+	}
+	if len(idents) == 0 {
+		return nil
+	}
+
+	results, err := checkMailmap(ctx, opts, t.GitDir, idents)
+	if err != nil {
+		return err
+	}
+	canonical := map[string]coAuthor{}
+	for i, ident := range idents {
+		canonical[ident] = results[i]
+	}
+
+	for i := range commits {
+		for j, ca := range commits[i].CoAuthors {
+			ident := mailmapIdent(ca.Name, ca.Email)
+			if c, ok := canonical[ident]; ok {
+				commits[i].CoAuthors[j] = c
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// httpCacheEntry is a cached response to a GET request.
+type httpCacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	StatusCode   int         `json:"statusCode"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+}
+
+// httpCacheTransport caches the responses to GET requests and revalidates
+// them with conditional requests, which GitHub does not rate limit.
+type httpCacheTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+func newHTTPCacheTransport(
+	dir string, base http.RoundTripper) *httpCacheTransport {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &httpCacheTransport{dir: dir, base: base}
+}
+
+func httpCacheDir(opts options) string {
+	return path.Join(opts.config.OutputDir, ".cache", "http")
+}
+
+// httpCredentialKey is the context key of the identity of the credentials
+// with which a request is authenticated.
+type httpCredentialKey struct{}
+
+func withHTTPCredential(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, httpCredentialKey{}, id)
+}
+
+// filePath returns the path of the cached response to the request, which
+// is keyed by URL, Accept header and credentials.
+func (t *httpCacheTransport) filePath(req *http.Request) string {
+	credential, _ := req.Context().Value(httpCredentialKey{}).(string)
+	if credential == "" {
+		credential = req.Header.Get("Authorization")
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s",
+		req.URL.String(), req.Header.Get("Accept"), credential)
+	return path.Join(t.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func (t *httpCacheTransport) load(filePath string) *httpCacheEntry {
+	buf, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	var e httpCacheEntry
+	if err := json.Unmarshal(buf, &e); err != nil {
+		// A corrupt entry is treated as a cache miss and replaced.
+		return nil
+	}
+	return &e
+}
+
+// store writes the entry to disk.
+func (t *httpCacheTransport) store(filePath string, e httpCacheEntry) error {
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(t.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
+
+func (t *httpCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	filePath := t.filePath(req)
+	cached := t.load(filePath)
+	if cached != nil {
+		// The request must not be modified by a RoundTripper, so the
+		// conditional headers are set on a copy.
+		creq := req.WithContext(req.Context())
+		creq.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			creq.Header[k] = v
+		}
+		if cached.ETag != "" {
+			creq.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			creq.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+		req = creq
+	}
+
+	rep, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rep.StatusCode == http.StatusNotModified && cached != nil {
+		rep.Body.Close()
+		return cached.response(req, rep.Header), nil
+	}
+
+	if rep.StatusCode != http.StatusOK {
+		return rep, nil
+	}
+	etag, lastModified := rep.Header.Get("ETag"), rep.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return rep, nil
+	}
+
+	body, err := ioutil.ReadAll(rep.Body)
+	rep.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rep.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := t.store(filePath, httpCacheEntry{
+		URL:          req.URL.String(),
+		ETag:         etag,
+		LastModified: lastModified,
+		StatusCode:   rep.StatusCode,
+		Header:       rep.Header,
+		Body:         body,
+	}); err != nil {
+		// The cache is an optimization, so the response is still used.
+		fmt.Fprintf(os.Stderr, "error caching %s: %v\n", req.URL, err)
+	}
+	return rep, nil
+}
+
+// response returns the cached response. The rate limit headers are those
+// of the 304 response since they describe the current rate limit.
+func (e *httpCacheEntry) response(
+	req *http.Request, notModified http.Header) *http.Response {
+
+	header := make(http.Header, len(e.Header))
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	for k, v := range notModified {
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Ratelimit-") {
+			header[k] = v
+		}
+	}
+	header.Set("X-From-Cache", "1")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
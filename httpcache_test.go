@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+func TestHTTPCacheTransport(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var (
+		requests    int
+		notModified int
+		name        = "Andrew"
+	)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			etag := fmt.Sprintf(`"%s"`, name)
+			w.Header().Set("X-RateLimit-Limit", "5000")
+			w.Header().Set("X-RateLimit-Remaining", fmt.Sprint(5000-requests))
+			if r.Header.Get("If-None-Match") == etag {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"login":"akutz","name":%q}`, name)
+		}))
+	defer s.Close()
+
+	client := github.NewClient(&http.Client{
+		Transport: newHTTPCacheTransport(tmpDir, nil),
+	})
+	client.BaseURL, _ = url.Parse(s.URL + "/")
+
+	getName := func() (string, *github.Response) {
+		user, rep, err := client.Users.Get(context.Background(), "akutz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.GetName(), rep
+	}
+
+	for i, exp := range []struct {
+		name        string
+		notModified int
+		fromCache   bool
+	}{
+		{"Andrew", 0, false},
+		{"Andrew", 1, true},
+		{"Andy", 1, false},
+		{"Andy", 2, true},
+	} {
+		if i == 2 {
+			name = "Andy"
+		}
+		act, rep := getName()
+		if act != exp.name {
+			t.Errorf("%d: name: exp=%s act=%s", i, exp.name, act)
+		}
+		if notModified != exp.notModified {
+			t.Errorf("%d: notModified: exp=%d act=%d",
+				i, exp.notModified, notModified)
+		}
+		if fromCache := rep.Header.Get("X-From-Cache") != ""; fromCache != exp.fromCache {
+			t.Errorf("%d: fromCache: exp=%v act=%v", i, exp.fromCache, fromCache)
+		}
+		// The rate limit is that of the latest response.
+		if rep.Rate.Remaining != 5000-requests {
+			t.Errorf("%d: remaining: exp=%d act=%d",
+				i, 5000-requests, rep.Rate.Remaining)
+		}
+	}
+}
+
+// authTransport sets the Authorization header of the requests.
+type authTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(req.Context())
+	req.Header = req.Header.Clone()
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+func TestHTTPCacheTransportAuthorization(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The response depends on the credentials, but the ETag does not.
+	var notModified int
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"akutz"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			email := ""
+			if r.Header.Get("Authorization") == "token private" {
+				email = "akutz@vmware.com"
+			}
+			w.Header().Set("ETag", `"akutz"`)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"login":"akutz","email":%q}`, email)
+		}))
+	defer s.Close()
+
+	cache := newHTTPCacheTransport(tmpDir, nil)
+	getEmail := func(token string) string {
+		t.Helper()
+		client := github.NewClient(&http.Client{
+			Transport: authTransport{token: token, base: cache},
+		})
+		client.BaseURL, _ = url.Parse(s.URL + "/")
+		user, _, err := client.Users.Get(context.Background(), "akutz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.GetEmail()
+	}
+
+	for i, exp := range []struct {
+		token       string
+		email       string
+		notModified int
+	}{
+		{"private", "akutz@vmware.com", 0},
+		{"public", "", 0},
+		{"private", "akutz@vmware.com", 1},
+		{"public", "", 2},
+	} {
+		if act := getEmail(exp.token); act != exp.email {
+			t.Errorf("%d: email: exp=%q act=%q", i, exp.email, act)
+		}
+		if notModified != exp.notModified {
+			t.Errorf("%d: notModified: exp=%d act=%d",
+				i, exp.notModified, notModified)
+		}
+	}
+}
+
+// rotatingTokenSource returns a new token each time.
+type rotatingTokenSource struct {
+	n int
+}
+
+func (s *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	s.n++
+	return &oauth2.Token{AccessToken: fmt.Sprintf("installation-%d", s.n)}, nil
+}
+
+func TestHTTPCacheTransportCredential(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var notModified int
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"akutz"` {
+				notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"akutz"`)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"login":"akutz"}`)
+		}))
+	defer s.Close()
+
+	cache := newHTTPCacheTransport(tmpDir, nil)
+	getUser := func(src oauth2.TokenSource) {
+		t.Helper()
+		client := github.NewClient(&http.Client{
+			Transport: newTokenPool([]oauth2.TokenSource{src}, cache),
+		})
+		client.BaseURL, _ = url.Parse(s.URL + "/")
+		if _, _, err := client.Users.Get(context.Background(), "akutz"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The installation's responses are revalidated although its token
+	// changes.
+	installation := credentialTokenSource{
+		TokenSource: &rotatingTokenSource{},
+		id:          "app 1 installation 2",
+	}
+	for i, exp := range []int{0, 1, 2} {
+		getUser(installation)
+		if notModified != exp {
+			t.Errorf("%d: notModified: exp=%d act=%d", i, exp, notModified)
+		}
+	}
+
+	// Other credentials do not share the installation's responses.
+	getUser(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "other"}))
+	if notModified != 2 {
+		t.Errorf("other: notModified: exp=2 act=%d", notModified)
+	}
+	getUser(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "other"}))
+	if notModified != 3 {
+		t.Errorf("other: notModified: exp=3 act=%d", notModified)
+	}
+}
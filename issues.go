@@ -1,56 +1,98 @@
-// +build none
-
 package main
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/go-github/github"
 )
 
 type issue struct {
-	URL           string `json:"url"`
-	Created       bool   `json:"created"`
-	Commented     bool   `json:"commented"`
-	IsPullRequest bool   `json:"isPullRequest"`
+	Repo          string     `json:"repo"`
+	Number        int        `json:"number"`
+	URL           string     `json:"url"`
+	Title         string     `json:"title,omitempty"`
+	State         string     `json:"state,omitempty"`
+	Created       bool       `json:"created,omitempty"`
+	Assigned      bool       `json:"assigned,omitempty"`
+	Mentioned     bool       `json:"mentioned,omitempty"`
+	IsPullRequest bool       `json:"isPullRequest,omitempty"`
+	CreatedAt     *time.Time `json:"createdAt,omitempty"`
+	ClosedAt      *time.Time `json:"closedAt,omitempty"`
+	MergedAt      *time.Time `json:"mergedAt,omitempty"`
+
+	// Unmerged is set when a closed pull request was found to not be
+	// merged, so it is not looked up again unless it is closed again.
+	Unmerged bool `json:"unmerged,omitempty"`
+}
+
+// issueRelation describes how a member is related to an issue.
+type issueRelation int
+
+const (
+	issueCreated issueRelation = iota
+	issueAssigned
+	issueMentioned
+)
+
+type relatedIssue struct {
+	issue    *github.Issue
+	relation issueRelation
 }
 
+// getIssues gets the issues and pull requests from the target
+// repositories that the member created, was assigned or was mentioned in.
 func (m *member) getIssues(ctx context.Context, opts options) error {
+	for _, t := range opts.targets {
+		if err := m.getTargetIssues(ctx, t, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *member) getTargetIssues(
+	ctx context.Context, t target, opts options) error {
 
 	var (
 		wg         sync.WaitGroup
-		chanIssues = make(chan *issueWrapper)
-		chanErrs   = make(chan error, 1)
+		chanIssues = make(chan relatedIssue)
+		chanErrs   = make(chan error, 3)
 	)
 
-	fetchIssuesWith := func(listOpts github.IssueListByRepoOptions) {
+	fetchIssuesWith := func(
+		listOpts github.IssueListByRepoOptions, rel issueRelation) {
+
+		// Issues not updated since the start of the window were not
+		// created in it, and any that are cached remain cached.
+		if since := opts.config.Since; since != nil {
+			listOpts.Since = *since
+		}
+
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			chanIssuesIn, chanErrsIn := fetchIssues(ctx, client, opts)
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case err, ok := <-chanErrsIn:
-					if ok {
-						chanErrs <- err
-					}
-					return
-				case issue, ok := <-chanIssuesIn:
-					if !ok {
-						return
-					}
-					chanIssues <- issue
-				}
+			chanIssuesIn, chanErrsIn := fetchIssues(ctx, t, listOpts, opts)
+
+			// The issues channel is closed before the error channel, so
+			// the error is read after all of the issues have been.
+			for issue := range chanIssuesIn {
+				chanIssues <- relatedIssue{issue: issue, relation: rel}
+			}
+			if err, ok := <-chanErrsIn; ok {
+				chanErrs <- err
 			}
 		}()
 	}
 
-	fetchIssuesWith(github.IssueListByRepoOptions{Creator: login})
-	fetchIssuesWith(github.IssueListByRepoOptions{Assignee: login})
-	fetchIssuesWith(github.IssueListByRepoOptions{Mentioned: login})
+	fetchIssuesWith(
+		github.IssueListByRepoOptions{Creator: m.Login}, issueCreated)
+	fetchIssuesWith(
+		github.IssueListByRepoOptions{Assignee: m.Login}, issueAssigned)
+	fetchIssuesWith(
+		github.IssueListByRepoOptions{Mentioned: m.Login}, issueMentioned)
 
 	go func() {
 		wg.Wait()
@@ -58,43 +100,134 @@ func (m *member) getIssues(ctx context.Context, opts options) error {
 		close(chanErrs)
 	}()
 
-	return chanIssues, chanErrs
+	// Index the target's cached issues so the fetched issues update them
+	// in place. The cached issues from other targets are left untouched.
+	var (
+		issues  = map[int]*issue{}
+		fetched = map[int]*issue{}
+		others  []issue
+	)
+	for i := range m.Issues {
+		if m.Issues[i].Repo == t.String() {
+			issues[m.Issues[i].Number] = &m.Issues[i]
+		} else {
+			others = append(others, m.Issues[i])
+		}
+	}
+
+	for ri := range chanIssues {
+		isPR := ri.issue.IsPullRequest()
+		if isPR && opts.config.GitHub.NoPullRequests {
+			continue
+		}
+		if !isPR && opts.config.GitHub.NoIssues {
+			continue
+		}
+
+		num := ri.issue.GetNumber()
+		cur, ok := fetched[num]
+		if !ok {
+			cur = &issue{Repo: t.String(), Number: num}
+			if cached, ok := issues[num]; ok {
+				cur.MergedAt = cached.MergedAt
+				cur.Unmerged = cached.Unmerged &&
+					cached.ClosedAt != nil && ri.issue.ClosedAt != nil &&
+					cached.ClosedAt.Equal(*ri.issue.ClosedAt)
+			}
+			fetched[num] = cur
+		}
+		cur.URL = ri.issue.GetHTMLURL()
+		cur.Title = ri.issue.GetTitle()
+		cur.State = ri.issue.GetState()
+		cur.IsPullRequest = isPR
+		cur.CreatedAt = ri.issue.CreatedAt
+		cur.ClosedAt = ri.issue.ClosedAt
+
+		switch ri.relation {
+		case issueCreated:
+			cur.Created = true
+		case issueAssigned:
+			cur.Assigned = true
+		case issueMentioned:
+			cur.Mentioned = true
+		}
+	}
+
+	// The member's issues are not updated if any of the lists failed.
+	if err := <-chanErrs; err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Only closed pull requests can be merged, and a known merge time
+	// never changes, so the remaining pull requests can be skipped. A
+	// pull request that was closed without being merged is skipped until
+	// it is reopened and closed again.
+	for _, cur := range fetched {
+		if !cur.IsPullRequest || cur.State != "closed" ||
+			cur.MergedAt != nil || cur.Unmerged {
+			continue
+		}
+		mergedAt, err := getPullRequestMergedAt(ctx, t, cur.Number, opts)
+		if err != nil {
+			return err
+		}
+		cur.MergedAt = mergedAt
+		cur.Unmerged = mergedAt == nil
+	}
+
+	// Issues that are no longer returned by the API remain in the cache.
+	for num, cur := range issues {
+		if _, ok := fetched[num]; !ok {
+			fetched[num] = cur
+		}
+	}
+
+	m.Issues = others
+	for _, cur := range fetched {
+		m.Issues = append(m.Issues, *cur)
+	}
+	sort.Slice(m.Issues, func(i, j int) bool {
+		if m.Issues[i].Repo != m.Issues[j].Repo {
+			return m.Issues[i].Repo < m.Issues[j].Repo
+		}
+		return m.Issues[i].Number < m.Issues[j].Number
+	})
+
+	return nil
 }
 
 func fetchIssues(
 	ctx context.Context,
+	t target,
 	listOpts github.IssueListByRepoOptions,
-	opts options) (chan *issueWrapper, chan error) {
+	opts options) (chan *github.Issue, chan error) {
 
 	var (
-		chanIssues = make(chan *issueWrapper)
+		chanIssues = make(chan *github.Issue)
 		chanErrs   = make(chan error, 1)
 	)
 
 	go func() {
-		var wg sync.WaitGroup
 		defer func() {
-			wg.Wait()
 			close(chanIssues)
 			close(chanErrs)
 		}()
 
-		opts.Page = 1
-		opts.State = "all"
+		listOpts.Page = 1
+		listOpts.State = "all"
 
 		retries := 0
 
-		for ctx.Err() == nil && opts.Page > 0 {
-			waitForAPI()
-			issues, rep, err := client.Issues.ListByRepo(
-				ctx,
-				config.targetOrg,
-				config.targetRepo,
-				&opts)
-			doneWithAPI()
-			printRateLimit(rep)
+		for ctx.Err() == nil && listOpts.Page > 0 {
+			opts.api.wait(ctx)
+			issues, rep, err := opts.github.Issues.ListByRepo(
+				ctx, t.Org, t.Repo, &listOpts)
+			opts.api.done(rep)
 			if err != nil {
-				if retryAfter(rep, &retries) {
+				if opts.api.retry(ctx, rep, err, &retries) {
 					continue
 				}
 				chanErrs <- err
@@ -102,38 +235,36 @@ func fetchIssues(
 			}
 
 			for i := 0; i < len(issues) && ctx.Err() == nil; i++ {
-				wg.Add(1)
-				go func(i int) {
-					issue := &issueWrapper{Issue: *issues[i]}
-					if !config.noFetchPullRequests && issue.IsPullRequest() {
-						retries := 0
-						for {
-							waitForAPI()
-							pr, rep, err := client.PullRequests.Get(
-								ctx,
-								config.targetOrg,
-								config.targetRepo,
-								issue.GetNumber())
-							doneWithAPI()
-							if err != nil {
-								if retryAfter(rep, &retries) {
-									continue
-								}
-								chanErrs <- err
-								return
-							}
-							issue.MergedAt = pr.MergedAt
-							break
-						}
-					}
-					chanIssues <- issue
-					wg.Done()
-				}(i)
+				chanIssues <- issues[i]
 			}
 
-			opts.Page = rep.NextPage
+			listOpts.Page = rep.NextPage
 		}
 	}()
 
 	return chanIssues, chanErrs
 }
+
+// getPullRequestMergedAt returns the time at which the pull request was
+// merged or nil if the pull request was not merged.
+func getPullRequestMergedAt(
+	ctx context.Context,
+	t target,
+	number int,
+	opts options) (*time.Time, error) {
+
+	retries := 0
+	for {
+		opts.api.wait(ctx)
+		pr, rep, err := opts.github.PullRequests.Get(
+			ctx, t.Org, t.Repo, number)
+		opts.api.done(rep)
+		if err != nil {
+			if opts.api.retry(ctx, rep, err, &retries) {
+				continue
+			}
+			return nil, err
+		}
+		return pr.MergedAt, nil
+	}
+}
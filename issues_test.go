@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testIssue is an issue or pull request served by testIssueServer.
+type testIssue struct {
+	number    int
+	pr        bool
+	creator   string
+	assignee  string
+	mentioned string
+	createdAt time.Time
+	closedAt  *time.Time
+	mergedAt  *time.Time
+}
+
+// testIssueServer serves the issues and pull requests of vmware/impact.
+type testIssueServer struct {
+	sync.Mutex
+	issues []*testIssue
+
+	// pulls is the number of times each pull request was fetched.
+	pulls map[int]int
+
+	// fail is the filter, such as "assignee", with which the issues
+	// cannot be listed.
+	fail string
+}
+
+func (s *testIssueServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.URL.Path == "/repos/vmware/impact/issues" {
+		q := r.URL.Query()
+		if s.fail != "" && q.Get(s.fail) != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message":"failed"}`)
+			return
+		}
+		v := []map[string]interface{}{}
+		for _, is := range s.issues {
+			if (q.Get("creator") != "" && q.Get("creator") != is.creator) ||
+				(q.Get("assignee") != "" && q.Get("assignee") != is.assignee) ||
+				(q.Get("mentioned") != "" && q.Get("mentioned") != is.mentioned) {
+				continue
+			}
+			state := "open"
+			if is.closedAt != nil {
+				state = "closed"
+			}
+			i := map[string]interface{}{
+				"number":     is.number,
+				"title":      fmt.Sprintf("#%d", is.number),
+				"state":      state,
+				"created_at": is.createdAt,
+				"closed_at":  is.closedAt,
+			}
+			if is.pr {
+				i["pull_request"] = map[string]string{
+					"url": fmt.Sprintf("http://%s/repos/vmware/impact/pulls/%d",
+						r.Host, is.number),
+				}
+			}
+			v = append(v, i)
+		}
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	const prefix = "/repos/vmware/impact/pulls/"
+	if strings.HasPrefix(r.URL.Path, prefix) {
+		number, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, prefix))
+		for _, is := range s.issues {
+			if is.pr && is.number == number {
+				s.pulls[number]++
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"number":    number,
+					"merged_at": is.mergedAt,
+				})
+				return
+			}
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func newTestIssueServer() (*testIssueServer, *httptest.Server) {
+	date := func(day int) *time.Time {
+		t := time.Date(2018, time.July, day, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	is := &testIssueServer{
+		pulls: map[int]int{},
+		issues: []*testIssue{
+			{
+				number:    1,
+				pr:        true,
+				creator:   "akutz",
+				createdAt: *date(1),
+				closedAt:  date(2),
+				mergedAt:  date(2),
+			},
+			{
+				number:    2,
+				pr:        true,
+				creator:   "akutz",
+				createdAt: *date(3),
+				closedAt:  date(4),
+			},
+			{
+				number:    3,
+				pr:        true,
+				creator:   "bob",
+				assignee:  "akutz",
+				createdAt: *date(5),
+			},
+			{
+				number:    4,
+				creator:   "bob",
+				assignee:  "akutz",
+				mentioned: "akutz",
+				createdAt: *date(6),
+				closedAt:  date(7),
+			},
+			{
+				number:    5,
+				creator:   "akutz",
+				createdAt: *date(8),
+			},
+		},
+	}
+	return is, httptest.NewServer(is)
+}
+
+func TestGetIssuesError(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	is, s := newTestIssueServer()
+	defer s.Close()
+	is.fail = "assignee"
+
+	opts := newTestAPIOptions(t, s, tmpDir)
+	opts.targets = []target{{Org: "vmware", Repo: "impact"}}
+
+	// The error is returned regardless of the order in which the lists
+	// finish, and the cached issues are left as they were.
+	for i := 0; i < 20; i++ {
+		m := member{
+			Login:  "akutz",
+			Issues: []issue{{Repo: "vmware/impact", Number: 9, Created: true}},
+		}
+		if err := m.getIssues(context.Background(), opts); err == nil {
+			t.Fatalf("%d: exp error", i)
+		}
+		if len(m.Issues) != 1 || m.Issues[0].Number != 9 {
+			t.Fatalf("%d: issues=%+v", i, m.Issues)
+		}
+	}
+}
+
+func TestGetIssues(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	is, s := newTestIssueServer()
+	defer s.Close()
+
+	opts := newTestAPIOptions(t, s, tmpDir)
+	opts.targets = []target{{Org: "vmware", Repo: "impact"}}
+	ctx := context.Background()
+
+	m := member{Login: "akutz"}
+	if err := m.getIssues(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Issues) != 5 {
+		t.Fatalf("len(issues)=%d, expected 5", len(m.Issues))
+	}
+	if pr := m.Issues[0]; pr.MergedAt == nil || pr.Unmerged {
+		t.Errorf("#1=%+v, expected merged", pr)
+	}
+	if pr := m.Issues[1]; pr.MergedAt != nil || !pr.Unmerged {
+		t.Errorf("#2=%+v, expected unmerged", pr)
+	}
+	if pr := m.Issues[2]; pr.MergedAt != nil || pr.Unmerged {
+		t.Errorf("#3=%+v, expected open", pr)
+	}
+	if exp := map[int]int{1: 1, 2: 1}; fmt.Sprint(is.pulls) != fmt.Sprint(exp) {
+		t.Errorf("pulls=%v, expected %v", is.pulls, exp)
+	}
+
+	exp := issueAndPullRequestReport{
+		Login:        "akutz",
+		Issues:       issueReport{Created: 1, Assigned: 1, Mentioned: 1},
+		PullRequests: issueReport{Created: 2, Assigned: 1, Merged: 1},
+	}
+	if act := m.issueAndPullRequestReport(); act != exp {
+		t.Errorf("report: exp=%+v act=%+v", exp, act)
+	}
+
+	// The merge state of the closed pull requests is not looked up again.
+	is.pulls = map[int]int{}
+	if err := m.getIssues(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(is.pulls) != 0 {
+		t.Errorf("pulls=%v, expected none", is.pulls)
+	}
+
+	// A pull request that is reopened, merged and closed again is.
+	is.Lock()
+	closedAt := is.issues[1].closedAt.Add(time.Hour)
+	is.issues[1].closedAt = &closedAt
+	is.issues[1].mergedAt = &closedAt
+	is.Unlock()
+	if err := m.getIssues(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[int]int{2: 1}; fmt.Sprint(is.pulls) != fmt.Sprint(exp) {
+		t.Errorf("pulls=%v, expected %v", is.pulls, exp)
+	}
+	if pr := m.Issues[1]; pr.MergedAt == nil || !pr.MergedAt.Equal(closedAt) ||
+		pr.Unmerged {
+		t.Errorf("#2=%+v, expected merged", pr)
+	}
+	if n := m.issueAndPullRequestReport().PullRequests.Merged; n != 2 {
+		t.Errorf("merged=%d, expected 2", n)
+	}
+}
+
+func TestIssueAndPullRequestReport(t *testing.T) {
+	merged := time.Date(2018, time.July, 1, 0, 0, 0, 0, time.UTC)
+	m := member{
+		Login: "akutz",
+		Issues: []issue{
+			{Number: 1, Created: true},
+			{Number: 2, Created: true, Assigned: true, Mentioned: true},
+			{Number: 3, Mentioned: true},
+			{Number: 4, IsPullRequest: true, Created: true, MergedAt: &merged},
+			{Number: 5, IsPullRequest: true, Created: true, Unmerged: true},
+			{Number: 6, IsPullRequest: true, Assigned: true, MergedAt: &merged},
+		},
+	}
+	exp := issueAndPullRequestReport{
+		Login:        "akutz",
+		Issues:       issueReport{Created: 2, Assigned: 1, Mentioned: 2},
+		PullRequests: issueReport{Created: 2, Assigned: 1, Merged: 1},
+	}
+	act := m.issueAndPullRequestReport()
+	if act != exp {
+		t.Errorf("exp=%+v act=%+v", exp, act)
+	}
+	if !act.hasIssues() {
+		t.Error("hasIssues=false")
+	}
+	if (member{Login: "akutz"}).issueAndPullRequestReport().hasIssues() {
+		t.Error("hasIssues=true without issues")
+	}
+}
@@ -5,14 +5,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"os/exec"
 	"path"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
 	ldap "gopkg.in/ldap.v2"
 )
 
@@ -23,6 +23,16 @@ const (
 	exitCodeGitDir      // 5
 	exitCodeAffiliates  // 6
 	exitCodeWriteReport // 7
+	exitCodeReviews     // 8
+	exitCodeTargets     // 9
+	exitCodeGitIndex    // 10
+	exitCodeAliases     // 11
+	exitCodeAreas       // 12
+	exitCodeExclusions  // 13
+	exitCodeDiff        // 14
+	exitCodeCache       // 15
+	exitCodeServe       // 16
+	exitCodeConfig      // 17
 )
 
 type options struct {
@@ -31,27 +41,63 @@ type options struct {
 	ldap   ldap.Client
 	devs   devAffiliates
 
-	// chanAPI controls the number of concurrent API calls
-	chanAPI chan struct{}
+	// aliases are the additional identities of the members
+	aliases aliases
+
+	// areas assigns the paths of changed files to areas
+	areas *areaClassifier
+
+	// exclusions determines the changes excluded from effective churn
+	exclusions *exclusions
+
+	// targets are the repositories for which activity is collected
+	targets []target
+
+	// gitIndexes are the commits for each target, keyed by target
+	gitIndexes map[string]*gitIndex
+
+	// reviews is the review activity for each target
+	reviews *reviewIndexes
+
+	// api schedules the API calls
+	api *apiScheduler
 
 	// chanGit controls the number of concurrent git commands
 	chanGit chan struct{}
+
+	// gitCAFile is the CA bundle git trusts if -ca-file is specified
+	gitCAFile string
+
+	// readOnly reports the cached members without updating their
+	// activity or writing them to disk
+	readOnly bool
 }
 
 type config struct {
-	Debug        bool         `json:"debug"`
-	Args         []string     `json:"args"`
-	OutputDir    string       `json:"output-dir"`
-	MemberOrg    string       `json:"member-org"`
-	TargetOrg    string       `json:"target-org"`
-	TargetRepo   string       `json:"target-repo"`
-	Resume       bool         `json:"resume"`
-	NoAffiliates bool         `json:"no-fetch-affiliates"`
-	UTC          bool         `json:"utc"`
-	Offline      bool         `json:"offline"`
-	Git          gitConfig    `json:"git"`
-	GitHub       gitHubConfig `json:"gitHub"`
-	LDAP         ldapConfig   `json:"ldap"`
+	Debug            bool             `json:"debug"`
+	Args             []string         `json:"args"`
+	OutputDir        string           `json:"output-dir"`
+	MemberOrg        string           `json:"member-org"`
+	TargetOrg        string           `json:"target-org"`
+	TargetRepo       string           `json:"target-repo"`
+	Targets          []string         `json:"targets,omitempty"`
+	Resume           bool             `json:"resume"`
+	NoAffiliates     bool             `json:"no-fetch-affiliates"`
+	AliasFile        string           `json:"alias-file,omitempty"`
+	UTC              bool             `json:"utc"`
+	Period           string           `json:"period,omitempty"`
+	Format           string           `json:"format"`
+	MarkdownTemplate string           `json:"markdown-template,omitempty"`
+	Top              int              `json:"top"`
+	SQLite           bool             `json:"sqlite"`
+	Since            *time.Time       `json:"since,omitempty"`
+	Until            *time.Time       `json:"until,omitempty"`
+	Offline          bool             `json:"offline"`
+	Git              gitConfig        `json:"git"`
+	Areas            areasConfig      `json:"areas"`
+	Exclusions       exclusionsConfig `json:"exclusions"`
+	GitHub           gitHubConfig     `json:"gitHub"`
+	LDAP             ldapConfig       `json:"ldap"`
 }
 
 type gitHubConfig struct {
@@ -59,6 +105,19 @@ type gitHubConfig struct {
 	NoUsers        bool            `json:"no-fetch-users"`
 	NoIssues       bool            `json:"no-fetch-issues"`
 	NoPullRequests bool            `json:"no-fetch-pull-requests"`
+	NoReviews      bool            `json:"no-fetch-reviews"`
+	NoCache        bool            `json:"no-api-cache"`
+	TokenFile      string          `json:"token-file,omitempty"`
+	App            gitHubAppConfig `json:"app"`
+	BaseURL        string          `json:"api-url,omitempty"`
+	UploadURL      string          `json:"upload-url,omitempty"`
+	CAFile         string          `json:"ca-file,omitempty"`
+}
+
+type gitHubAppConfig struct {
+	ID             int64  `json:"app-id,omitempty"`
+	InstallationID int64  `json:"app-installation-id,omitempty"`
+	PrivateKeyFile string `json:"app-private-key,omitempty"`
 }
 
 type githubAPIConfig struct {
@@ -71,8 +130,21 @@ type githubAPIConfig struct {
 
 type gitConfig struct {
 	Max       int    `json:"git-max"`
+	SyncMax   int    `json:"git-sync-max"`
 	Disabled  bool   `json:"no-git"`
+	NoFetch   bool   `json:"no-fetch-git"`
 	TargetDir string `json:"target-git-dir"`
+	URL       string `json:"git-url"`
+}
+
+type areasConfig struct {
+	File     string `json:"area-file,omitempty"`
+	NoOwners bool   `json:"no-area-owners"`
+}
+
+type exclusionsConfig struct {
+	Globs      []string `json:"exclude,omitempty"`
+	NoDefaults bool     `json:"no-default-exclusions"`
 }
 
 type ldapConfig struct {
@@ -86,163 +158,109 @@ type ldapTLSConfig struct {
 }
 
 func main() {
-	flag.Usage = usage
-
-	// Set up an options object to send into the functions.
-	var opts options
-
-	opts.config.Debug, _ = strconv.ParseBool(os.Getenv("DEBUG"))
-
-	// Set up the flags
-	flag.StringVar(
-		&opts.config.OutputDir, "output", "data",
-		"The output directory")
-	flag.StringVar(
-		&opts.config.MemberOrg, "member-org", "VMware",
-		"The source GitHub org")
-	flag.StringVar(
-		&opts.config.TargetOrg, "target-org", "kubernetes",
-		"The targeted GitHub org")
-	flag.StringVar(
-		&opts.config.TargetRepo, "target-repo", "kubernetes",
-		"The targeted GitHub repo")
-	flag.BoolVar(
-		&opts.config.Resume, "resume", false,
-		"Resume at the specified member name. An errors occurs if "+
-			"more than one username is specified.")
-	flag.BoolVar(
-		&opts.config.UTC, "utc", false,
-		"Print timestamps using UTC")
-	flag.BoolVar(
-		&opts.config.Offline, "offline", false,
-		"Offline mode sets all -no-fetch flags to true")
-	flag.BoolVar(
-		&opts.config.Offline, "no-fetch", false,
-		"Synonym for -offline")
-	flag.BoolVar(
-		&opts.config.Offline, "report-only", false,
-		"Synonym for -offline")
-	flag.BoolVar(
-		&opts.config.NoAffiliates, "no-fetch-affiliates", false,
-		"Do not update the local developer affiliations file "+
-			"(https://goo.gl/ux4PVs)")
-
-	flag.StringVar(
-		&opts.config.LDAP.Host, "ldap-host", "SCROOTDC01.vmware.com:3269",
-		"The LDAP host used to supplement e-mail addresses")
-	flag.BoolVar(
-		&opts.config.LDAP.Disabled, "no-ldap", false,
-		"Disable LDAP lookups")
-	flag.BoolVar(
-		&opts.config.LDAP.TLS.Insecure, "ldap-tls-insecure", false,
-		"Enable LDAP TLS insecure mode")
-
-	flag.BoolVar(
-		&opts.config.GitHub.NoUsers, "no-fetch-users", false,
-		"Do not update local user cache")
-	flag.BoolVar(
-		&opts.config.GitHub.NoIssues, "no-fetch-issues", false,
-		"Do not update local issue cache")
-	flag.BoolVar(
-		&opts.config.GitHub.NoPullRequests, "no-fetch-pull-requests", false,
-		"Do not update local pull request cache")
-	flag.IntVar(
-		&opts.config.GitHub.API.Max, "api-max", 2,
-		"Number of max concurrent API calls")
-	flag.IntVar(
-		&opts.config.GitHub.API.Retries, "api-retries", 5,
-		"Number of retries for a failed API call")
-	var apiWait string
-	flag.StringVar(
-		&apiWait, "api-wait", "1s",
-		"Duration of time to wait between API calls")
-	var apiRetryWait string
-	flag.StringVar(
-		&apiRetryWait, "api-retry-wait", "10s",
-		"Duration of time to wait between failed API calls when the "+
-			"response header \"Retry-After\" is missing")
-	flag.BoolVar(
-		&opts.config.GitHub.API.ShowRateLimit, "show-rate-limit",
-		opts.config.Debug,
-		"Shows the rate limit info after all API calls")
-
-	// Check to see if the git command is in the path.
-	if exec.Command("git", "version").Run() == nil {
-		var defaultTargetGitDir string
-		if goPath := getGoPath(); goPath != "" {
-			gitDir := path.Join(
-				goPath,
-				"src",
-				"github.com",
-				opts.config.TargetOrg,
-				opts.config.TargetRepo,
-				".git")
-			if ok, err := fileExists(gitDir); !ok {
-				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
-					os.Exit(exitCodeGitDir)
-				}
-			} else {
-				defaultTargetGitDir = gitDir
-			}
+	if len(os.Args) > 1 {
+		if cmd, ok := findCommand(os.Args[1]); ok {
+			os.Exit(cmd.run(os.Args[2:]))
 		}
-		flag.StringVar(
-			&opts.config.Git.TargetDir, "target-git-dir", defaultTargetGitDir,
-			"The path to the git directory to search for commit activity")
-		flag.BoolVar(
-			&opts.config.Git.Disabled, "no-git", false,
-			"Do not write git commit activity")
-		flag.IntVar(
-			&opts.config.Git.Max, "git-max", 10,
-			"Number of max concurrent git commands")
-	} else {
-		opts.config.Git.Disabled = true
 	}
 
-	// Parse the flags
-	flag.Parse()
+	// Without a command the members are fetched and reported, which is
+	// how the program was invoked before it had commands.
+	os.Exit(runMain(os.Args[1:]))
+}
 
-	// Create the program's context
-	ctx := context.Background()
+// cliFlags are the values of the flags that are parsed into the options
+// after the command line is parsed.
+type cliFlags struct {
+	apiWait      string
+	apiRetryWait string
+	since        string
+	until        string
+	diffFormat   string
+	addr         string
+}
+
+// initOptions validates the parsed flags and prepares the options for
+// collecting the members' activity. The program exits if the options are
+// invalid or any of their dependencies cannot be loaded.
+func initOptions(
+	ctx context.Context, fs *flag.FlagSet, cf cliFlags, opts *options) {
 
 	if opts.config.Offline {
 		opts.config.LDAP.Disabled = true
 		opts.config.GitHub.NoUsers = true
 		opts.config.GitHub.NoIssues = true
 		opts.config.GitHub.NoPullRequests = true
+		opts.config.GitHub.NoReviews = true
+		opts.config.Git.NoFetch = true
 	}
 
 	// Parse the GitHub API retry config if the GitHub API is used.
-	if !opts.config.GitHub.NoUsers &&
-		!opts.config.GitHub.NoIssues &&
-		!opts.config.GitHub.NoPullRequests {
+	if !opts.config.GitHub.NoUsers ||
+		!opts.config.GitHub.NoIssues ||
+		!opts.config.GitHub.NoPullRequests ||
+		!opts.config.GitHub.NoReviews {
 
 		// Parse the amount of time to wait between API calls.
-		if d, err := time.ParseDuration(apiWait); err != nil {
+		if d, err := time.ParseDuration(cf.apiWait); err != nil {
 			opts.config.GitHub.API.Wait = time.Duration(1) * time.Second
 		} else {
 			opts.config.GitHub.API.Wait = d
 		}
 
 		// Parse the amount of time to wait between failed API calls.
-		if d, err := time.ParseDuration(apiRetryWait); err != nil {
+		if d, err := time.ParseDuration(cf.apiRetryWait); err != nil {
 			opts.config.GitHub.API.RetryWait = time.Duration(10) * time.Second
 		} else {
 			opts.config.GitHub.API.RetryWait = d
 		}
 	}
 
-	opts.config.Args = flag.Args()
+	if opts.config.Period != "" && !validPeriod(opts.config.Period) {
+		fmt.Fprintf(
+			os.Stderr, "Invalid period: %s\n", opts.config.Period)
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if !validFormat(opts.config.Format) {
+		fmt.Fprintf(
+			os.Stderr, "Invalid format: %s\n", opts.config.Format)
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Parse the reporting window.
+	for _, w := range []struct {
+		value string
+		time  **time.Time
+	}{
+		{cf.since, &opts.config.Since},
+		{cf.until, &opts.config.Until},
+	} {
+		t, err := parseWindowTime(w.value, *opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fs.Usage()
+			os.Exit(1)
+		}
+		*w.time = t
+	}
+
+	// The arguments replace the config file's args.
+	if fs.NArg() > 0 {
+		opts.config.Args = fs.Args()
+	}
 	if !opts.config.Resume {
 		// If resume is disabled then remove duplicate args
-		opts.config.Args = unique(flag.Args())
-	} else if flag.NArg() != 1 {
+		opts.config.Args = unique(opts.config.Args)
+	} else if len(opts.config.Args) != 1 {
 		// If resume is enabled and there is not exactly one argument
 		// then print an error
 		fmt.Fprintln(
 			os.Stderr,
 			"The flag -resume must be used with a single username")
-		flag.Usage()
+		fs.Usage()
 		os.Exit(1)
 	}
 
@@ -258,26 +276,70 @@ func main() {
 	if !opts.config.Git.Disabled {
 		// chanGit controls the number of concurrent git commands
 		opts.chanGit = make(chan struct{}, opts.config.Git.Max)
+
+		// The mirrors are fetched with the CA bundle in -ca-file, if any.
+		if !opts.config.Git.NoFetch {
+			gitCAFile, err := writeGitCABundle(*opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			opts.gitCAFile = gitCAFile
+		}
 	}
 
 	// Create the github API client if any of the features
 	// that use it are enabled.
-	if !opts.config.GitHub.NoUsers &&
-		!opts.config.GitHub.NoIssues &&
-		!opts.config.GitHub.NoPullRequests {
-
-		// Parse the GitHub API key.
-		apiKey := os.Getenv("GITHUB_API_KEY")
-		if apiKey == "" {
-			fmt.Fprintln(os.Stderr, "GITHUB_API_KEY required")
+	if !opts.config.GitHub.NoUsers ||
+		!opts.config.GitHub.NoIssues ||
+		!opts.config.GitHub.NoPullRequests ||
+		!opts.config.GitHub.NoReviews {
+
+		// The transport trusts the CA bundle in -ca-file, if any.
+		transport, err := newHTTPTransport(*opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		// Parse the GitHub API keys.
+		apiKeys, err := getAPITokens(*opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		var tokens []oauth2.TokenSource
+		for _, k := range apiKeys {
+			tokens = append(tokens,
+				oauth2.StaticTokenSource(&oauth2.Token{AccessToken: k}))
+		}
+
+		// Authenticate as a GitHub App installation.
+		if opts.config.GitHub.App.ID != 0 {
+			src, err := newAppTokenSource(
+				ctx, &http.Client{Transport: transport}, *opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			tokens = append(tokens, src)
+		}
+
+		if len(tokens) == 0 {
+			fmt.Fprintln(
+				os.Stderr, "GITHUB_API_KEY, -token-file or -app-id required")
 			os.Exit(1)
 		}
 
 		// Create the GitHub client.
-		opts.github = newGitHubAPIClient(ctx, apiKey)
+		opts.github, err = newGitHubAPIClient(ctx, tokens, transport, *opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-		// chanAPI controls the number of concurrent API calls
-		opts.chanAPI = make(chan struct{}, opts.config.GitHub.API.Max)
+		// api schedules the API calls within the rate limit
+		opts.api = newAPIScheduler(opts.config.GitHub.API)
 	}
 
 	// Create the ldap client.
@@ -288,12 +350,11 @@ func main() {
 			fmt.Fprintln(os.Stderr, "LDAP_USER & LDAP_PASS required")
 			os.Exit(1)
 		}
-		client, err := ldapBind(ctx, ldapUser, ldapPass, opts)
+		client, err := ldapBind(ctx, ldapUser, ldapPass, *opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(exitCodeLDAPBind)
 		}
-		defer client.Close()
 		opts.ldap = client
 	}
 
@@ -302,7 +363,7 @@ func main() {
 
 	// Parse the developer affiliates file.
 	if !opts.config.NoAffiliates {
-		_, devs, err := getDevAffiliates(ctx, opts)
+		_, devs, err := getDevAffiliates(ctx, *opts)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(exitCodeAffiliates)
@@ -310,7 +371,67 @@ func main() {
 		opts.devs = devs
 	}
 
-	// Get all of the members of the GitHub org.
+	// Parse the identity aliases file.
+	aliases, err := getAliases(*opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeAliases)
+	}
+	opts.aliases = aliases
+
+	// Get the target repositories.
+	targets, err := getTargets(ctx, *opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeTargets)
+	}
+	opts.targets = targets
+
+	// Index the commits in the target repositories, unless the cached
+	// members are reported as they are.
+	if !opts.config.Git.Disabled && !opts.readOnly {
+		gitIndexes, err := getGitIndexes(ctx, *opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitCodeGitIndex)
+		}
+		opts.gitIndexes = gitIndexes
+	}
+
+	// Get the areas of the target repositories. The targets of the cached
+	// members reported as they are have no HEAD, so only the area file is
+	// read, and only the exclusion globs are used.
+	areas, err := getAreaClassifier(ctx, *opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeAreas)
+	}
+	opts.areas = areas
+
+	// Parse the exclusions and find the generated files in the target
+	// repositories.
+	exclusions, err := newExclusions(ctx, *opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCodeExclusions)
+	}
+	opts.exclusions = exclusions
+
+	// The review activity for the target repositories is loaded when the
+	// first member is reported.
+	opts.reviews = &reviewIndexes{}
+}
+
+// closeOptions releases the clients created by initOptions.
+func closeOptions(opts options) {
+	if opts.ldap != nil {
+		opts.ldap.Close()
+	}
+}
+
+// streamMembers gets the members and exits the program if an error
+// occurs while getting them.
+func streamMembers(ctx context.Context, opts options) chan member {
 	chanMembers, chanErrs := getMembers(ctx, opts)
 
 	go func() {
@@ -329,10 +450,7 @@ func main() {
 		}
 	}()
 
-	if err := writeReport(ctx, chanMembers, opts); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(exitCodeWriteReport)
-	}
+	return chanMembers
 }
 
 func unique(src []string) []string {
@@ -377,36 +495,3 @@ func getGoPath() string {
 	}
 	return ""
 }
-
-func usage() {
-	fmt.Fprintf(
-		flag.CommandLine.Output(),
-		"usage: %s [FLAGS] [USER...]\n\n",
-		os.Args[0])
-	fmt.Fprintf(
-		flag.CommandLine.Output(),
-		"FLAGS\n")
-	flag.PrintDefaults()
-	fmt.Fprintln(
-		flag.CommandLine.Output(), `
-ENVIRONMENT VARIABLES
-  DEBUG
-    Set to a truthy value to enable verbose output
-
-  GITHUB_API_KEY
-    A GitHub API key with the following permissions:
-
-      * public_repo
-      * read:discussion
-      * read:gpg_key
-      * read:org
-      * read:public_key
-      * read:repo_hook
-      * read:user
-      * repo:invite
-      * repo:status
-      * repo_deployment
-      * user:email
-
-    This environment variable is REQUIRED.`)
-}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// markdownNotablePullRequests is the number of merged pull requests
+// listed in the Markdown report.
+const markdownNotablePullRequests = 20
+
+// markdownReport accumulates the reported members for the Markdown
+// report.
+type markdownReport struct {
+	members []memberReport
+	totals  memberReport
+	org     *orgPeriods
+	pulls   []markdownPullRequest
+}
+
+// markdownPullRequest is a merged pull request created by a member.
+type markdownPullRequest struct {
+	Login    string
+	Repo     string
+	Number   int
+	Title    string
+	URL      string
+	MergedAt time.Time
+}
+
+// markdownPeriod is the org's activity in a period and its change from
+// the previous period. The change of the first period is from zero.
+type markdownPeriod struct {
+	Period  string
+	Members int
+	Report  memberReport
+	Delta   struct {
+		Members            int
+		Commits            int
+		Additions          int
+		Deletions          int
+		PullRequestsMerged int
+		Reviews            int
+	}
+}
+
+func newMarkdownReport(opts options) *markdownReport {
+	return &markdownReport{org: newOrgPeriods(opts.config.MemberOrg)}
+}
+
+// periodOptions returns the options used to bucket the Markdown report's
+// periods. The periods are quarters unless -period is set.
+func (mr *markdownReport) periodOptions(opts options) options {
+	if opts.config.Period == "" {
+		opts.config.Period = periodQuarter
+	}
+	return opts
+}
+
+func (mr *markdownReport) add(m member, r memberReport, opts options) {
+	mr.members = append(mr.members, r)
+	mr.totals.add(r)
+	mr.org.add(m, mr.periodOptions(opts))
+	for _, is := range m.Issues {
+		if !is.IsPullRequest || !is.Created || is.MergedAt == nil {
+			continue
+		}
+		mr.pulls = append(mr.pulls, markdownPullRequest{
+			Login:    m.Login,
+			Repo:     is.Repo,
+			Number:   is.Number,
+			Title:    is.Title,
+			URL:      is.URL,
+			MergedAt: *is.MergedAt,
+		})
+	}
+}
+
+// ranked returns the members sorted by their commits, merged pull
+// requests and reviews, in that order.
+func (mr *markdownReport) ranked() []memberReport {
+	members := append([]memberReport(nil), mr.members...)
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		if a.PullRequestsMerged != b.PullRequestsMerged {
+			return a.PullRequestsMerged > b.PullRequestsMerged
+		}
+		if a.Reviews != b.Reviews {
+			return a.Reviews > b.Reviews
+		}
+		return a.Login < b.Login
+	})
+	return members
+}
+
+// periods returns the org's activity by period, oldest first.
+func (mr *markdownReport) periods(opts options) []markdownPeriod {
+	opts = mr.periodOptions(opts)
+	var periods []markdownPeriod
+	for _, p := range mr.org.org.periods(opts) {
+		mp := markdownPeriod{
+			Period:  p,
+			Members: len(mr.org.members[p]),
+			Report:  mr.org.org.forPeriod(p, opts).report(opts),
+		}
+		var prev markdownPeriod
+		if i := len(periods); i > 0 {
+			prev = periods[i-1]
+		}
+		mp.Delta.Members = mp.Members - prev.Members
+		mp.Delta.Commits = mp.Report.Commits - prev.Report.Commits
+		mp.Delta.Additions = mp.Report.Additions - prev.Report.Additions
+		mp.Delta.Deletions = mp.Report.Deletions - prev.Report.Deletions
+		mp.Delta.PullRequestsMerged =
+			mp.Report.PullRequestsMerged - prev.Report.PullRequestsMerged
+		mp.Delta.Reviews = mp.Report.Reviews - prev.Report.Reviews
+		periods = append(periods, mp)
+	}
+	return periods
+}
+
+// notablePullRequests returns the most recently merged pull requests.
+func (mr *markdownReport) notablePullRequests() []markdownPullRequest {
+	pulls := append([]markdownPullRequest(nil), mr.pulls...)
+	sort.Slice(pulls, func(i, j int) bool {
+		return pulls[i].MergedAt.After(pulls[j].MergedAt)
+	})
+	if len(pulls) > markdownNotablePullRequests {
+		pulls = pulls[:markdownNotablePullRequests]
+	}
+	return pulls
+}
+
+var markdownFuncs = template.FuncMap{
+	// inc returns i+1 for numbering items from one
+	"inc": func(i int) int { return i + 1 },
+
+	// delta formats a change with its sign
+	"delta": func(i int) string {
+		if i > 0 {
+			return fmt.Sprintf("+%d", i)
+		}
+		return fmt.Sprintf("%d", i)
+	},
+
+	// date formats a time as a date
+	"date": func(t time.Time) string { return t.Format("2006-01-02") },
+}
+
+func parseMarkdownTemplate(opts options) (*template.Template, error) {
+	text := defaultMarkdownTemplate
+	if filePath := opts.config.MarkdownTemplate; filePath != "" {
+		buf, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		text = string(buf)
+	}
+	return template.New("markdown").Funcs(markdownFuncs).Parse(text)
+}
+
+func (mr *markdownReport) writeToDisk(
+	filePath string,
+	tpl *template.Template,
+	sum orgSummary,
+	opts options) error {
+
+	data := struct {
+		Metadata           reportMetadata
+		Members            int
+		Totals             memberReport
+		Summary            orgSummary
+		Metrics            []summaryMetric
+		LeaderboardMetrics []string
+		Ranked             []memberReport
+		Periods            []markdownPeriod
+		PullRequests       []markdownPullRequest
+	}{
+		Metadata:           newReportMetadata(opts),
+		Members:            len(mr.members),
+		Totals:             mr.totals,
+		Summary:            sum,
+		Metrics:            summaryMetrics,
+		LeaderboardMetrics: leaderboardMetrics,
+		Ranked:             mr.ranked(),
+		Periods:            mr.periods(opts),
+		PullRequests:       mr.notablePullRequests(),
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return tpl.Execute(f, data)
+}
+
+// defaultMarkdownTemplate is the template used to render the Markdown
+// report unless -markdown-template is set.
+const defaultMarkdownTemplate = `# GitHub Impact{{with .Metadata.MemberOrg}}: {{.}}{{end}}
+
+Generated {{date .Metadata.GeneratedAt}} for
+{{- range $i, $t := .Metadata.Targets}}{{if $i}},{{end}} {{$t}}{{end}}
+{{- with .Metadata.Since}}, since {{date .}}{{end}}
+{{- with .Metadata.Until}}, until {{date .}}{{end}}.
+
+## Totals
+
+| Members | Commits | Additions | Deletions | Pull Requests | Merged | Issues | Reviews |
+|--------:|--------:|----------:|----------:|--------------:|-------:|-------:|--------:|
+| {{.Members}} | {{.Totals.Commits}} | {{.Totals.Additions}} | {{.Totals.Deletions}} | {{.Totals.PullRequestsCreated}} | {{.Totals.PullRequestsMerged}} | {{.Totals.IssuesCreated}} | {{.Totals.Reviews}} |
+
+{{.Summary.ActiveContributors}} active contributors: {{.Summary.Committers}} committers, {{.Summary.PullRequestAuthors}} pull request authors and {{.Summary.Reviewers}} reviewers.
+
+| Metric | Median | 75th Percentile | 90th Percentile | Max |
+|--------|-------:|----------------:|----------------:|----:|
+{{range .Metrics}}{{$d := index $.Summary.Distributions .Name}}| {{.Name}} | {{$d.Median}} | {{$d.P75}} | {{$d.P90}} | {{$d.Max}} |
+{{end}}
+## Leaderboards
+{{range .LeaderboardMetrics}}
+### {{.}}
+
+{{range $i, $e := index $.Summary.Leaderboards .}}{{inc $i}}. @{{$e.Login}} ({{$e.Value}})
+{{end}}{{end}}{{if .Periods}}
+## By Period
+
+| Period | Members | Commits | Δ | Merged | Δ | Reviews | Δ |
+|--------|--------:|--------:|--:|-------:|--:|--------:|--:|
+{{range $i, $p := .Periods}}| {{$p.Period}} | {{$p.Members}} | {{$p.Report.Commits}} | {{if $i}}{{delta $p.Delta.Commits}}{{end}} | {{$p.Report.PullRequestsMerged}} | {{if $i}}{{delta $p.Delta.PullRequestsMerged}}{{end}} | {{$p.Report.Reviews}} | {{if $i}}{{delta $p.Delta.Reviews}}{{end}} |
+{{end}}{{end}}
+## Contributors
+
+| # | Login | Name | Commits | Additions | Deletions | Merged | Reviews |
+|--:|-------|------|--------:|----------:|----------:|-------:|--------:|
+{{range $i, $m := .Ranked}}| {{inc $i}} | @{{$m.Login}} | {{$m.Name}} | {{$m.Commits}} | {{$m.Additions}} | {{$m.Deletions}} | {{$m.PullRequestsMerged}} | {{$m.Reviews}} |
+{{end}}{{if .PullRequests}}
+## Notable Merged Pull Requests
+
+{{range .PullRequests}}* [{{.Repo}}#{{.Number}}]({{.URL}}) {{.Title}} (@{{.Login}}, {{date .MergedAt}})
+{{end}}{{end}}`
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarkdownReport(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.UTC = true
+	opts.config.MemberOrg = "vmware"
+
+	date := func(month time.Month) time.Time {
+		return time.Date(2018, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	merged := date(time.August)
+
+	mr := newMarkdownReport(opts)
+	summ := &summarizer{}
+	for _, m := range []member{
+		{
+			Login: "bob",
+			Commits: []changeset{
+				{Repo: "vmware/impact", Long: "b1", AuthorDate: date(time.February)},
+			},
+		},
+		{
+			Login: "akutz",
+			Commits: []changeset{
+				{Repo: "vmware/impact", Long: "a1", AuthorDate: date(time.March)},
+				{Repo: "vmware/impact", Long: "a2", AuthorDate: date(time.July)},
+				{Repo: "vmware/impact", Long: "a3", AuthorDate: date(time.August)},
+			},
+			Issues: []issue{
+				{
+					Repo:          "vmware/impact",
+					Number:        42,
+					Title:         "Add a Markdown report",
+					URL:           "https://github.com/vmware/impact/pull/42",
+					Created:       true,
+					IsPullRequest: true,
+					MergedAt:      &merged,
+				},
+			},
+		},
+	} {
+		r := m.report(opts)
+		mr.add(m, r, opts)
+		summ.add(r)
+	}
+
+	if r := mr.ranked(); r[0].Login != "akutz" || r[1].Login != "bob" {
+		t.Errorf("ranked=%s,%s", r[0].Login, r[1].Login)
+	}
+	periods := mr.periods(opts)
+	if len(periods) != 2 {
+		t.Fatalf("len(periods)=%d, expected 2", len(periods))
+	}
+	if p := periods[1]; p.Period != "2018-Q3" ||
+		p.Report.Commits != 2 || p.Delta.Commits != 0 ||
+		p.Delta.Members != -1 {
+		t.Errorf("periods[1]=%+v", p)
+	}
+
+	tpl, err := parseMarkdownTemplate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := path.Join(tmpDir, "report.md")
+	if err := mr.writeToDisk(filePath, tpl, summ.summary(opts), opts); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(buf)
+	for _, s := range []string{
+		"# GitHub Impact: vmware",
+		"| 1 | @akutz |  | 3 |",
+		"| 2018-Q3 | 1 | 2 | 0 |",
+		"1. @akutz (3)",
+		"* [vmware/impact#42](https://github.com/vmware/impact/pull/42)",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("report is missing %q:\n%s", s, md)
+		}
+	}
+
+	// A custom template replaces the default template.
+	opts.config.MarkdownTemplate = path.Join(tmpDir, "custom.md")
+	if err := ioutil.WriteFile(
+		opts.config.MarkdownTemplate,
+		[]byte("{{range .Ranked}}{{.Login}} {{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if tpl, err = parseMarkdownTemplate(opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := mr.writeToDisk(filePath, tpl, summ.summary(opts), opts); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err = ioutil.ReadFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(buf); s != "akutz bob " {
+		t.Errorf("custom report=%q", s)
+	}
+}
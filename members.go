@@ -3,25 +3,28 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
 type member struct {
-	Login     string               `json:"login"`
-	Name      string               `json:"name,omitempty"`
-	LDAPLogin string               `json:"ldapLogin,omitempty"`
-	Emails    uniqueStringSlice    `json:"emails,omitempty"`
-	Employed  uniqueDateRangeSlice `json:"employed,omitempty"`
-	Commits   []changeset          `json:"commits,omitempty"`
-	//Issues    []issue              `json:"commits,omitempty"`
+	Login          string               `json:"login"`
+	Name           string               `json:"name,omitempty"`
+	LDAPLogin      string               `json:"ldapLogin,omitempty"`
+	Emails         uniqueStringSlice    `json:"emails,omitempty"`
+	Employed       uniqueDateRangeSlice `json:"employed,omitempty"`
+	Commits        []changeset          `json:"commits,omitempty"`
+	Issues         []issue              `json:"issues,omitempty"`
+	Reviews        []review             `json:"reviews,omitempty"`
+	ReviewComments []reviewComment      `json:"reviewComments,omitempty"`
 }
 
 type uniqueStringSlice []string
@@ -66,8 +69,38 @@ func (u *uniqueDateRangeSlice) append(d dateRange) {
 	*u = append(*u, d)
 }
 
+// memberCacheDir returns the directory in which the members are cached.
+// It is apart from the reports in the output directory, whose names may
+// include logins, ex. report-akutz.json.
+func memberCacheDir(outputDir string) string {
+	return path.Join(outputDir, ".cache", "members")
+}
+
 func (m member) filePath(opts options) string {
-	return path.Join(opts.config.OutputDir, fmt.Sprintf("%s.json", m.Login))
+	return path.Join(
+		memberCacheDir(opts.config.OutputDir), fmt.Sprintf("%s.json", m.Login))
+}
+
+// legacyFilePath returns the path to which the member was cached before
+// the members were cached in memberCacheDir.
+func (m member) legacyFilePath(opts options) (string, bool) {
+	filePath := path.Join(
+		opts.config.OutputDir, fmt.Sprintf("%s.json", m.Login))
+	return filePath, isLegacyMemberFile(filePath)
+}
+
+// cachedFilePath returns the path of the file in which the member is
+// cached, or an empty string if the member is not cached.
+func (m member) cachedFilePath(opts options) (string, error) {
+	filePaths := []string{m.filePath(opts)}
+	if filePath, ok := m.legacyFilePath(opts); ok {
+		filePaths = append(filePaths, filePath)
+	}
+	existing, err := existingFiles(filePaths...)
+	if err != nil || len(existing) == 0 {
+		return "", err
+	}
+	return existing[0], nil
 }
 
 func (m member) encode(w io.Writer) error {
@@ -77,12 +110,24 @@ func (m member) encode(w io.Writer) error {
 }
 
 func (m member) writeToDisk(opts options) error {
-	f, err := os.Create(m.filePath(opts))
+	filePath := m.filePath(opts)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	return m.encode(f)
+	if err := m.encode(f); err != nil {
+		return err
+	}
+	if filePath, ok := m.legacyFilePath(opts); ok {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *member) decode(r io.Reader) error {
@@ -91,7 +136,14 @@ func (m *member) decode(r io.Reader) error {
 }
 
 func (m *member) loadFromDisk(opts options) error {
-	f, err := os.Open(m.filePath(opts))
+	filePath, err := m.cachedFilePath(opts)
+	if err != nil {
+		return err
+	}
+	if filePath == "" {
+		filePath = m.filePath(opts)
+	}
+	f, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
@@ -102,12 +154,13 @@ func (m *member) loadFromDisk(opts options) error {
 func (m *member) load(ctx context.Context, opts options) error {
 
 	// Load the user from the local disk cache.
-	if ok, err := fileExists(m.filePath(opts)); err != nil {
+	if filePath, err := m.cachedFilePath(opts); err != nil {
 		return err
-	} else if ok {
+	} else if filePath != "" {
 		if err := m.loadFromDisk(opts); err != nil {
 			return err
 		}
+		m.setDefaultRepo(opts.config.defaultRepo())
 	}
 
 	// Load the user from GitHub if allowed.
@@ -124,10 +177,86 @@ func (m *member) load(ctx context.Context, opts options) error {
 		}
 	}
 
+	// Load from the aliases file.
+	m.loadFromAliases(opts)
+
 	// Load from the affiliates file.
 	return m.loadFromAffiliates(ctx, opts)
 }
 
+// setDefaultRepo assigns the repository to the cached activity that
+// predates support for multiple target repositories.
+func (m *member) setDefaultRepo(repo string) {
+	for i := range m.Commits {
+		if m.Commits[i].Repo == "" {
+			m.Commits[i].Repo = repo
+		}
+	}
+	for i := range m.Issues {
+		if m.Issues[i].Repo == "" {
+			m.Issues[i].Repo = repo
+		}
+	}
+	for i := range m.Reviews {
+		if m.Reviews[i].Repo == "" {
+			m.Reviews[i].Repo = repo
+		}
+	}
+	for i := range m.ReviewComments {
+		if m.ReviewComments[i].Repo == "" {
+			m.ReviewComments[i].Repo = repo
+		}
+	}
+}
+
+// repos returns the sorted names of the repositories in which the member
+// has activity.
+func (m member) repos() []string {
+	var repos uniqueStringSlice
+	for _, c := range m.Commits {
+		repos.append(c.Repo)
+	}
+	for _, i := range m.Issues {
+		repos.append(i.Repo)
+	}
+	for _, r := range m.Reviews {
+		repos.append(r.Repo)
+	}
+	for _, c := range m.ReviewComments {
+		repos.append(c.Repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// forRepo returns a copy of the member with only the activity that
+// occurred in the specified repository.
+func (m member) forRepo(repo string) member {
+	r := m
+	r.Commits, r.Issues, r.Reviews, r.ReviewComments = nil, nil, nil, nil
+	for _, c := range m.Commits {
+		if c.Repo == repo {
+			r.Commits = append(r.Commits, c)
+		}
+	}
+	for _, i := range m.Issues {
+		if i.Repo == repo {
+			r.Issues = append(r.Issues, i)
+		}
+	}
+	for _, rv := range m.Reviews {
+		if rv.Repo == repo {
+			r.Reviews = append(r.Reviews, rv)
+		}
+	}
+	for _, c := range m.ReviewComments {
+		if c.Repo == repo {
+			r.ReviewComments = append(r.ReviewComments, c)
+		}
+	}
+	return r
+}
+
 func getMembers(ctx context.Context, opts options) (chan member, chan error) {
 
 	var (
@@ -155,7 +284,8 @@ func getMembers(ctx context.Context, opts options) (chan member, chan error) {
 		}
 
 		// Write the members to disk before sending them into
-		// the out channel.
+		// the out channel. In read-only mode the cached members are
+		// sent as they are.
 		for {
 			select {
 			case <-ctx.Done():
@@ -169,16 +299,31 @@ func getMembers(ctx context.Context, opts options) (chan member, chan error) {
 				if !ok {
 					return
 				}
-				if !opts.config.Git.Disabled {
+				if !opts.config.Git.Disabled && !opts.readOnly {
 					if err := m.gitLog(ctx, opts); err != nil {
 						chanErrsOut <- err
 						return
 					}
 				}
-				if err := m.writeToDisk(opts); err != nil {
+				if !opts.config.GitHub.NoIssues ||
+					!opts.config.GitHub.NoPullRequests {
+					if err := m.getIssues(ctx, opts); err != nil {
+						chanErrsOut <- err
+						return
+					}
+				}
+				reviews, err := opts.reviews.get(ctx, opts)
+				if err != nil {
 					chanErrsOut <- err
 					return
 				}
+				m.loadFromReviewIndexes(reviews)
+				if !opts.readOnly {
+					if err := m.writeToDisk(opts); err != nil {
+						chanErrsOut <- err
+						return
+					}
+				}
 				chanMembersOut <- m
 			}
 		}
@@ -266,7 +411,7 @@ func getAllMembers(
 				// If resume mode is enabled then only process
 				// the member if their login name is >= the
 				// first command-line argument
-				if opts.config.Resume && login < flag.Arg(0) {
+				if opts.config.Resume && login < opts.config.Args[0] {
 					continue
 				}
 
@@ -289,6 +434,56 @@ func getAllMembers(
 	return chanMembers, chanErrs
 }
 
+// cachedLogin returns the login of the member cached in the JSON file.
+func cachedLogin(filePath string) string {
+	fileName := path.Base(filePath)
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+// isLegacyMemberFile returns a flag indicating whether or not the JSON
+// file is a member named after the login it contains.
+func isLegacyMemberFile(filePath string) bool {
+	buf, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	var m struct {
+		Login string `json:"login"`
+	}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		return false
+	}
+	return m.Login != "" && m.Login == cachedLogin(filePath)
+}
+
+// cachedMemberFiles returns the paths of the members cached in the output
+// directory, including those cached before the members were cached in
+// memberCacheDir.
+func cachedMemberFiles(outputDir string) ([]string, error) {
+	filePaths, err := filepath.Glob(
+		path.Join(memberCacheDir(outputDir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	logins := map[string]struct{}{}
+	for _, filePath := range filePaths {
+		logins[cachedLogin(filePath)] = struct{}{}
+	}
+	matches, err := filepath.Glob(path.Join(outputDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, filePath := range matches {
+		if !isLegacyMemberFile(filePath) {
+			continue
+		}
+		if _, ok := logins[cachedLogin(filePath)]; !ok {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	return filePaths, nil
+}
+
 func getCachedLogins(
 	ctx context.Context, opts options) (chan string, chan error) {
 
@@ -305,22 +500,19 @@ func getCachedLogins(
 			close(chanErrs)
 		}()
 
-		searchPatt := path.Join(opts.config.OutputDir, "*.json")
-		matches, err := filepath.Glob(searchPatt)
+		matches, err := cachedMemberFiles(opts.config.OutputDir)
 		if err != nil {
 			chanErrs <- err
 			return
 		}
 
 		for i := 0; i < len(matches) && ctx.Err() == nil; i++ {
+			login := cachedLogin(matches[i])
 			wg.Add(1)
-			go func(i int) {
-				fileName := path.Base(matches[i])
-				fileExt := path.Ext(fileName)
-				login := strings.TrimSuffix(fileName, fileExt)
+			go func() {
 				chanLogins <- login
 				wg.Done()
-			}(i)
+			}()
 		}
 	}()
 
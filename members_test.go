@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetMembersReadOnly(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	from := time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cached := member{
+		Login:    "akutz",
+		Emails:   uniqueStringSlice{"akutz@vmware.com"},
+		Employed: uniqueDateRangeSlice{{From: &from}},
+	}
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+	opts.config.Args = []string{"akutz"}
+	opts.config.Offline = true
+	opts.config.LDAP.Disabled = true
+	opts.config.GitHub.NoUsers = true
+	opts.config.GitHub.NoIssues = true
+	opts.config.GitHub.NoPullRequests = true
+	opts.config.GitHub.NoReviews = true
+	opts.targets = []target{{Org: "vmware", Repo: "impact"}}
+	x := &gitIndex{Commits: []changeset{{
+		Repo:        "vmware/impact",
+		Short:       "0123456",
+		Long:        "0123456789",
+		AuthorName:  "akutz",
+		AuthorEmail: "akutz@vmware.com",
+		AuthorDate:  from.AddDate(0, 1, 0),
+	}}}
+	x.reindex()
+	opts.gitIndexes = map[string]*gitIndex{"vmware/impact": x}
+
+	getMember := func(opts options) member {
+		chanMembers, chanErrs := getMembers(context.Background(), opts)
+		var members []member
+		for m := range chanMembers {
+			members = append(members, m)
+		}
+		if err := <-chanErrs; err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 1 {
+			t.Fatalf("len(members)=%d, expected 1", len(members))
+		}
+		return members[0]
+	}
+
+	if err := cached.writeToDisk(opts); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := ioutil.ReadFile(cached.filePath(opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached member is reported as it is.
+	opts.readOnly = true
+	if m := getMember(opts); len(m.Commits) != 0 {
+		t.Errorf("commits=%+v, expected none", m.Commits)
+	}
+	if act, err := ioutil.ReadFile(cached.filePath(opts)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(act, exp) {
+		t.Errorf("cache: exp=%s act=%s", exp, act)
+	}
+
+	// Otherwise the member's commits are found and written to disk.
+	opts.readOnly = false
+	if m := getMember(opts); len(m.Commits) != 1 {
+		t.Errorf("len(commits)=%d, expected 1", len(m.Commits))
+	}
+	m := member{Login: "akutz"}
+	if err := m.loadFromDisk(opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Commits) != 1 {
+		t.Errorf("cache: len(commits)=%d, expected 1", len(m.Commits))
+	}
+}
+
+func TestCachedMemberFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+
+	// A login may look like the name of a report.
+	for _, m := range []member{{Login: "akutz"}, {Login: "report-bob"}} {
+		if err := m.writeToDisk(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The members cached by earlier versions are in the output directory
+	// with the reports and other JSON files, which are not members unless
+	// they are named after the login they contain.
+	for fileName, data := range map[string]string{
+		"akutz.json":           `{"login":"akutz"}`,
+		"carol.json":           `{"login":"carol"}`,
+		"dave.json":            `{"login":"carol"}`,
+		"impact.json":          `{"output-dir":"data"}`,
+		"invalid.json":         `{`,
+		"report.json":          `{"login":"carol"}`,
+		"report-akutz.json":    `{"schemaVersion":1}`,
+		"report-metadata.json": `{"schemaVersion":1}`,
+	} {
+		if err := ioutil.WriteFile(
+			path.Join(tmpDir, fileName), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filePaths, err := cachedMemberFiles(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logins []string
+	for _, filePath := range filePaths {
+		logins = append(logins, cachedLogin(filePath))
+	}
+	sort.Strings(logins)
+	exp, act := "akutz carol report-bob", strings.Join(logins, " ")
+	if exp != act {
+		t.Errorf("logins: exp=%s act=%s", exp, act)
+	}
+
+	// A member cached by an earlier version is read from the output
+	// directory and moved when it is written to disk.
+	m := member{Login: "carol"}
+	if err := m.loadFromDisk(opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.writeToDisk(opts); err != nil {
+		t.Fatal(err)
+	}
+	for filePath, exists := range map[string]bool{
+		m.filePath(opts):                       true,
+		path.Join(tmpDir, "carol.json"):        false,
+		path.Join(tmpDir, "report-akutz.json"): true,
+		path.Join(tmpDir, "impact.json"):       true,
+	} {
+		if ok, err := fileExists(filePath); err != nil {
+			t.Fatal(err)
+		} else if ok != exists {
+			t.Errorf("%s: exists=%v", filePath, ok)
+		}
+	}
+
+	// A report is not read as a member.
+	m = member{Login: "report-akutz"}
+	if err := m.loadFromDisk(opts); !os.IsNotExist(err) {
+		t.Errorf("err=%v, expected not exist", err)
+	}
+}
+
+func TestFetchResume(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+	for _, login := range []string{"akutz", "bob", "carol"} {
+		if err := (member{Login: login}).writeToDisk(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The logins of the fetched members are printed to stdout.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := fetchMain([]string{
+		"-output", tmpDir,
+		"-no-git",
+		"-no-ldap",
+		"-no-fetch-affiliates",
+		"-no-fetch-users",
+		"-no-fetch-issues",
+		"-no-fetch-pull-requests",
+		"-no-fetch-reviews",
+		"-resume", "bob",
+	})
+	os.Stdout = stdout
+	w.Close()
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+
+	// The members before the resumed login are skipped.
+	logins := strings.Fields(string(buf))
+	sort.Strings(logins)
+	if exp, act := "bob carol", strings.Join(logins, " "); exp != act {
+		t.Errorf("logins: exp=%s act=%s", exp, act)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// mirrorGitDir returns the path to the target's managed bare mirror.
+func mirrorGitDir(t target, opts options) string {
+	return path.Join(
+		opts.config.OutputDir, ".cache", "git", t.Org, t.Repo+".git")
+}
+
+// mirrorURL returns the URL from which the target's mirror is cloned.
+func mirrorURL(t target, opts options) string {
+	return fmt.Sprintf(
+		"%s/%s/%s.git",
+		gitBaseURL(opts), t.Org, t.Repo)
+}
+
+// syncMirror clones or fetches the target's mirror and returns its path,
+// or an empty string if the mirror does not exist.
+func syncMirror(ctx context.Context, t target, opts options) (string, error) {
+	gitDir := mirrorGitDir(t, opts)
+
+	ok, err := fileExists(gitDir)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.config.Git.NoFetch {
+		if !ok {
+			return "", nil
+		}
+		return gitDir, nil
+	}
+
+	if ok {
+		args := append(gitTLSArgs(opts), "--git-dir", gitDir, "fetch", "--prune")
+		if err := gitRun(ctx, opts, args...); err != nil {
+			return "", err
+		}
+		return gitDir, nil
+	}
+
+	if err := os.MkdirAll(path.Dir(gitDir), 0755); err != nil {
+		return "", err
+	}
+
+	// Clone into a temporary directory so an interrupted clone is not
+	// mistaken for a mirror on the next run.
+	tmpDir := gitDir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return "", err
+	}
+	args := append(
+		gitTLSArgs(opts),
+		"clone", "--mirror", "--quiet", mirrorURL(t, opts), tmpDir)
+	if err := gitRun(ctx, opts, args...); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+	if err := os.Rename(tmpDir, gitDir); err != nil {
+		return "", err
+	}
+	return gitDir, nil
+}
+
+// mirrorErrors are the failures to sync the mirrors of the targets.
+type mirrorErrors []error
+
+func (e mirrorErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// syncMirrors syncs the mirrors of the targets without a git directory
+// and updates the targets to use them.
+func syncMirrors(ctx context.Context, targets []target, opts options) error {
+	var (
+		wg          sync.WaitGroup
+		errs        = make([]error, len(targets))
+		chanTargets = make(chan int)
+		workers     = opts.config.Git.SyncMax
+	)
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chanTargets {
+				t := &targets[i]
+				gitDir, err := syncMirror(ctx, *t, opts)
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to sync mirror: %s: %v", t, err)
+					if ok, _ := fileExists(mirrorGitDir(*t, opts)); ok {
+						gitDir = mirrorGitDir(*t, opts)
+					}
+				}
+				if gitDir == "" {
+					gitDir = defaultGitDir(*t)
+				}
+				t.GitDir = gitDir
+			}
+		}()
+	}
+
+	for i := 0; i < len(targets) && ctx.Err() == nil; i++ {
+		if targets[i].GitDir == "" {
+			chanTargets <- i
+		}
+	}
+	close(chanTargets)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var merrs mirrorErrors
+	for _, err := range errs {
+		if err != nil {
+			merrs = append(merrs, err)
+		}
+	}
+	if len(merrs) > 0 {
+		return merrs
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(
+		os.Environ(),
+		"GIT_AUTHOR_NAME=akutz",
+		"GIT_AUTHOR_EMAIL=akutz@vmware.com",
+		"GIT_COMMITTER_NAME=akutz",
+		"GIT_COMMITTER_EMAIL=akutz@vmware.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %v: %s", cmd.Args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSyncMirror(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Create the repository that is mirrored.
+	srcDir := path.Join(tmpDir, "src", "vmware", "impact.git")
+	if err := os.MkdirAll(srcDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, srcDir, "init", "--quiet")
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "first")
+
+	var opts options
+	opts.config.OutputDir = path.Join(tmpDir, "data")
+	opts.config.Git.URL = "file://" + path.Join(tmpDir, "src")
+	opts.chanGit = make(chan struct{}, 1)
+
+	tgt := target{Org: "vmware", Repo: "impact"}
+
+	// The mirror is not cloned when fetching is disabled.
+	opts.config.Git.NoFetch = true
+	gitDir, err := syncMirror(context.Background(), tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gitDir != "" {
+		t.Fatalf("gitDir=%s, expected none", gitDir)
+	}
+
+	// The mirror is cloned on first use.
+	opts.config.Git.NoFetch = false
+	if gitDir, err = syncMirror(context.Background(), tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if gitDir != mirrorGitDir(tgt, opts) {
+		t.Fatalf("gitDir=%s, expected %s", gitDir, mirrorGitDir(tgt, opts))
+	}
+	head := runGit(t, srcDir, "rev-parse", "HEAD")
+	if v := runGit(t, gitDir, "rev-parse", "HEAD"); v != head {
+		t.Fatalf("mirror HEAD=%s, expected %s", v, head)
+	}
+
+	// The mirror is updated on subsequent use.
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "second")
+	head = runGit(t, srcDir, "rev-parse", "HEAD")
+	if _, err := syncMirror(context.Background(), tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if v := runGit(t, gitDir, "rev-parse", "HEAD"); v != head {
+		t.Fatalf("mirror HEAD=%s, expected %s", v, head)
+	}
+
+	// The existing mirror is used, but not updated, when fetching is
+	// disabled.
+	runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "third")
+	opts.config.Git.NoFetch = true
+	if gitDir, err = syncMirror(context.Background(), tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if v := runGit(t, gitDir, "rev-parse", "HEAD"); v != head {
+		t.Fatalf("mirror HEAD=%s, expected %s", v, head)
+	}
+}
+
+func TestSyncMirrors(t *testing.T) {
+	if exec.Command("git", "version").Run() != nil {
+		t.Skip("git not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Create the repositories that are mirrored, except vmware/missing.
+	for _, repo := range []string{"impact", "other"} {
+		srcDir := path.Join(tmpDir, "src", "vmware", repo+".git")
+		if err := os.MkdirAll(srcDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, srcDir, "init", "--quiet")
+		runGit(t, srcDir, "commit", "--quiet", "--allow-empty", "-m", "first")
+	}
+
+	var opts options
+	opts.config.OutputDir = path.Join(tmpDir, "data")
+	opts.config.Git.URL = "file://" + path.Join(tmpDir, "src")
+	opts.config.Git.SyncMax = 2
+	opts.chanGit = make(chan struct{}, 2)
+	ctx := context.Background()
+
+	newTargets := func() []target {
+		return []target{
+			{Org: "vmware", Repo: "impact"},
+			{Org: "vmware", Repo: "missing"},
+			{Org: "vmware", Repo: "other"},
+			{Org: "vmware", Repo: "local", GitDir: "/tmp/local.git"},
+		}
+	}
+	assertErrors := func(err error, expRepos ...string) {
+		t.Helper()
+		merrs, ok := err.(mirrorErrors)
+		if !ok || len(merrs) != len(expRepos) {
+			t.Fatalf("err=%v, expected failures for %v", err, expRepos)
+		}
+		for i, repo := range expRepos {
+			if !strings.Contains(merrs[i].Error(), repo) {
+				t.Errorf("errs[%d]=%v, expected %s", i, merrs[i], repo)
+			}
+		}
+	}
+
+	// The other mirrors are synced when one of them fails.
+	targets := newTargets()
+	assertErrors(syncMirrors(ctx, targets, opts), "vmware/missing")
+	for i, exp := range []string{
+		mirrorGitDir(targets[0], opts),
+		"",
+		mirrorGitDir(targets[2], opts),
+		"/tmp/local.git",
+	} {
+		if targets[i].GitDir != exp {
+			t.Errorf("%s: gitDir=%s, expected %s",
+				targets[i], targets[i].GitDir, exp)
+		}
+	}
+
+	// A mirror that cannot be updated is used as it is.
+	if err := os.RemoveAll(
+		path.Join(tmpDir, "src", "vmware", "other.git")); err != nil {
+		t.Fatal(err)
+	}
+	targets = newTargets()
+	assertErrors(
+		syncMirrors(ctx, targets, opts), "vmware/missing", "vmware/other")
+	if exp := mirrorGitDir(targets[2], opts); targets[2].GitDir != exp {
+		t.Errorf("gitDir=%s, expected %s", targets[2].GitDir, exp)
+	}
+}
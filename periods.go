@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	periodMonth   = "month"
+	periodQuarter = "quarter"
+	periodYear    = "year"
+)
+
+// validPeriod returns a flag indicating whether or not the period is one
+// of the supported report periods.
+func validPeriod(period string) bool {
+	switch period {
+	case periodMonth, periodQuarter, periodYear:
+		return true
+	}
+	return false
+}
+
+// periodOf returns the label of the period that contains the time, ex.
+// "2018-07", "2018-Q3" or "2018".
+func periodOf(t time.Time, opts options) string {
+	if opts.config.UTC {
+		t = t.UTC()
+	} else {
+		t = t.Local()
+	}
+	switch opts.config.Period {
+	case periodMonth:
+		return t.Format("2006-01")
+	case periodQuarter:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())+2)/3)
+	default:
+		return t.Format("2006")
+	}
+}
+
+// periods returns the sorted labels of the periods in which the member
+// has activity. Issues, pull requests, reviews and review comments
+// without a timestamp do not belong to any period.
+func (m member) periods(opts options) []string {
+	var periods uniqueStringSlice
+	for _, c := range m.Commits {
+		periods.append(periodOf(c.AuthorDate, opts))
+	}
+	for _, i := range m.Issues {
+		if i.CreatedAt != nil {
+			periods.append(periodOf(*i.CreatedAt, opts))
+		}
+	}
+	for _, r := range m.Reviews {
+		if r.SubmittedAt != nil {
+			periods.append(periodOf(*r.SubmittedAt, opts))
+		}
+	}
+	for _, c := range m.ReviewComments {
+		if c.CreatedAt != nil {
+			periods.append(periodOf(*c.CreatedAt, opts))
+		}
+	}
+	sort.Strings(periods)
+	return periods
+}
+
+// forPeriod returns a copy of the member with only the activity that
+// occurred in the specified period.
+func (m member) forPeriod(period string, opts options) member {
+	r := m
+	r.Commits, r.Issues, r.Reviews, r.ReviewComments = nil, nil, nil, nil
+	for _, c := range m.Commits {
+		if periodOf(c.AuthorDate, opts) == period {
+			r.Commits = append(r.Commits, c)
+		}
+	}
+	for _, i := range m.Issues {
+		if i.CreatedAt != nil && periodOf(*i.CreatedAt, opts) == period {
+			r.Issues = append(r.Issues, i)
+		}
+	}
+	for _, rv := range m.Reviews {
+		if rv.SubmittedAt != nil && periodOf(*rv.SubmittedAt, opts) == period {
+			r.Reviews = append(r.Reviews, rv)
+		}
+	}
+	for _, c := range m.ReviewComments {
+		if c.CreatedAt != nil && periodOf(*c.CreatedAt, opts) == period {
+			r.ReviewComments = append(r.ReviewComments, c)
+		}
+	}
+	return r
+}
+
+// orgPeriods accumulates the activity of all of the reported members so
+// it may be rolled up by period.
+type orgPeriods struct {
+	org member
+
+	// members is the set of logins with activity, keyed by period
+	members map[string]map[string]struct{}
+
+	// commits and issues index the org's commits and issues so those
+	// shared by members are counted once
+	commits map[string]int
+	issues  map[string]int
+}
+
+func newOrgPeriods(org string) *orgPeriods {
+	return &orgPeriods{
+		org:     member{Login: org},
+		members: map[string]map[string]struct{}{},
+		commits: map[string]int{},
+		issues:  map[string]int{},
+	}
+}
+
+func (o *orgPeriods) add(m member, opts options) {
+	for _, c := range m.Commits {
+		key := changesetKey(c.Repo, c.Long)
+		if i, ok := o.commits[key]; ok {
+			// The org authored the commit if any of its members did.
+			o.org.Commits[i].CoAuthored =
+				o.org.Commits[i].CoAuthored && c.CoAuthored
+			continue
+		}
+		o.commits[key] = len(o.org.Commits)
+		o.org.Commits = append(o.org.Commits, c)
+	}
+	for _, is := range m.Issues {
+		key := fmt.Sprintf("%s#%d", is.Repo, is.Number)
+		if i, ok := o.issues[key]; ok {
+			oi := &o.org.Issues[i]
+			oi.Created = oi.Created || is.Created
+			oi.Assigned = oi.Assigned || is.Assigned
+			oi.Mentioned = oi.Mentioned || is.Mentioned
+			continue
+		}
+		o.issues[key] = len(o.org.Issues)
+		o.org.Issues = append(o.org.Issues, is)
+	}
+	o.org.Reviews = append(o.org.Reviews, m.Reviews...)
+	o.org.ReviewComments = append(o.org.ReviewComments, m.ReviewComments...)
+	for _, p := range m.periods(opts) {
+		logins, ok := o.members[p]
+		if !ok {
+			logins = map[string]struct{}{}
+			o.members[p] = logins
+		}
+		logins[m.Login] = struct{}{}
+	}
+}
+
+// csvPeriodOrgReportHeader is the header of the org rollup. The member's
+// login, name and e-mail addresses are replaced by the period and the
+// number of members with activity in the period.
+var csvPeriodOrgReportHeader = append(
+	[]string{"period", "members"}, csvReportHeader[3:]...)
+
+// csvRecords returns the org rollup, one record per period.
+func (o *orgPeriods) csvRecords(opts options) [][]string {
+	var records [][]string
+	for _, p := range o.org.periods(opts) {
+		fields := o.org.forPeriod(p, opts).csvFields(opts)
+		records = append(records, append(
+			[]string{p, strconv.Itoa(len(o.members[p]))}, fields[3:]...))
+	}
+	return records
+}
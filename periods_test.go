@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeriodOf(t *testing.T) {
+	// 2018-09-30T23:30:00-07:00 is in Q4 in UTC.
+	tm := time.Date(2018, 9, 30, 23, 30, 0, 0, time.FixedZone("PDT", -7*3600))
+
+	testCases := []struct {
+		period string
+		exp    string
+	}{
+		{periodMonth, "2018-10"},
+		{periodQuarter, "2018-Q4"},
+		{periodYear, "2018"},
+	}
+
+	var opts options
+	opts.config.UTC = true
+	for _, tc := range testCases {
+		opts.config.Period = tc.period
+		if p := periodOf(tm, opts); p != tc.exp {
+			t.Errorf("periodOf(%s, %s)=%s, expected %s",
+				tm, tc.period, p, tc.exp)
+		}
+	}
+}
+
+func TestOrgPeriods(t *testing.T) {
+	var opts options
+	opts.config.UTC = true
+	opts.config.Period = periodQuarter
+
+	date := func(month time.Month) *time.Time {
+		t := time.Date(2018, month, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	akutz := member{
+		Login: "akutz",
+		Commits: []changeset{
+			{Repo: "vmware/impact", Long: "a1", AuthorDate: *date(time.February)},
+			{Repo: "vmware/impact", Long: "a2", AuthorDate: *date(time.August)},
+		},
+		Issues: []issue{
+			{
+				Repo:      "vmware/impact",
+				Number:    1,
+				Created:   true,
+				CreatedAt: date(time.July),
+			},
+			{Repo: "vmware/impact", Number: 2, Created: true},
+		},
+	}
+	bob := member{
+		Login: "bob",
+		Reviews: []review{
+			{Repo: "vmware/impact", PullRequest: 1, SubmittedAt: date(time.September)},
+		},
+	}
+
+	if p := akutz.periods(opts); len(p) != 2 ||
+		p[0] != "2018-Q1" || p[1] != "2018-Q3" {
+		t.Errorf("periods=%v", p)
+	}
+	if q3 := akutz.forPeriod("2018-Q3", opts); len(q3.Commits) != 1 ||
+		len(q3.Issues) != 1 {
+		t.Errorf("forPeriod=%+v", q3)
+	}
+
+	// The commit co-authored by carol and the issue in which she is
+	// mentioned are akutz's too, so the org counts them once.
+	carol := member{
+		Login: "carol",
+		Commits: []changeset{{
+			Repo:       "vmware/impact",
+			Long:       "a2",
+			AuthorDate: *date(time.August),
+			CoAuthored: true,
+		}},
+		Issues: []issue{{
+			Repo:      "vmware/impact",
+			Number:    1,
+			Mentioned: true,
+			CreatedAt: date(time.July),
+		}},
+	}
+
+	org := newOrgPeriods("vmware")
+	org.add(carol, opts)
+	org.add(akutz, opts)
+	org.add(bob, opts)
+	records := org.csvRecords(opts)
+	if len(records) != 2 {
+		t.Fatalf("len(records)=%d, expected 2", len(records))
+	}
+	field := func(r []string, name string) string {
+		for i, h := range csvPeriodOrgReportHeader {
+			if h == name {
+				return r[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	r := records[1]
+	for name, exp := range map[string]string{
+		"period":            "2018-Q3",
+		"members":           "3",
+		"commits":           "1",
+		"coAuthoredCommits": "0",
+		"issuesCreated":     "1",
+		"issuesMentioned":   "1",
+		"reviews":           "1",
+	} {
+		if act := field(r, name); act != exp {
+			t.Errorf("%s: exp=%s act=%s", name, exp, act)
+		}
+	}
+}
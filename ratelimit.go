@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	// maxAPIBackoff is the longest time to wait before retrying a failed
+	// API call.
+	maxAPIBackoff = time.Duration(5) * time.Minute
+
+	// minAbuseWait is the shortest time to wait after exceeding one of
+	// GitHub's secondary rate limits without a Retry-After header.
+	minAbuseWait = time.Duration(1) * time.Minute
+)
+
+// apiScheduler paces the API calls within the rate limit and retries the
+// calls that fail. Each call is preceded by wait and followed by done.
+type apiScheduler struct {
+	config githubAPIConfig
+
+	// sem limits the number of concurrent API calls.
+	sem chan struct{}
+
+	mu sync.Mutex
+
+	// rate is the most recent rate limit returned by the API.
+	rate github.Rate
+
+	// next is the earliest time at which the next API call may be made.
+	next time.Time
+
+	// now and sleep may be replaced by tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newAPIScheduler(config githubAPIConfig) *apiScheduler {
+	max := config.Max
+	if max < 1 {
+		max = 1
+	}
+	return &apiScheduler{
+		config: config,
+		sem:    make(chan struct{}, max),
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// sleepContext sleeps for the duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// interval returns the time between the start of API calls so that the
+// remaining calls are spread over the rest of the rate limit window.
+func (s *apiScheduler) interval(at time.Time) time.Duration {
+	d := s.config.Wait / time.Duration(cap(s.sem))
+	if s.rate.Limit == 0 || !s.rate.Reset.After(at) {
+		return d
+	}
+	untilReset := s.rate.Reset.Sub(at)
+	if s.rate.Remaining <= 0 {
+		return untilReset
+	}
+	if pace := untilReset / time.Duration(s.rate.Remaining); pace > d {
+		d = pace
+	}
+	return d
+}
+
+// wait blocks until an API call may be made. The call must be followed by
+// done.
+func (s *apiScheduler) wait(ctx context.Context) {
+	s.sem <- struct{}{}
+
+	s.mu.Lock()
+	now := s.now()
+	start := s.next
+	if start.Before(now) {
+		start = now
+	}
+	s.next = start.Add(s.interval(start))
+	s.mu.Unlock()
+
+	s.sleep(ctx, start.Sub(now))
+}
+
+// done records the rate limit of the response and allows another API call
+// to be made.
+func (s *apiScheduler) done(rep *github.Response) {
+	defer func() { <-s.sem }()
+	if rep == nil || rep.Rate.Limit == 0 {
+		return
+	}
+	if s.config.ShowRateLimit {
+		fmt.Fprintln(os.Stderr, formatRateReset(rep.Rate))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The responses to concurrent calls may arrive in any order, so only
+	// a newer rate limit window or fewer remaining calls are recorded.
+	reset := rep.Rate.Reset.Time
+	switch {
+	case reset.After(s.rate.Reset.Time):
+		s.rate = rep.Rate
+	case reset.Equal(s.rate.Reset.Time) &&
+		rep.Rate.Remaining < s.rate.Remaining:
+		s.rate = rep.Rate
+	}
+}
+
+// pauseUntil prevents any API calls from being made before the time.
+func (s *apiScheduler) pauseUntil(t time.Time) {
+	s.mu.Lock()
+	if t.After(s.next) {
+		s.next = t
+	}
+	s.mu.Unlock()
+}
+
+// backoff returns the jittered exponential backoff for the retry, which
+// is between half and all of API.RetryWait doubled for each retry.
+func (s *apiScheduler) backoff(retries int) time.Duration {
+	d := s.config.RetryWait
+	if d <= 0 {
+		d = time.Second
+	}
+	for i := 0; i < retries && d < maxAPIBackoff; i++ {
+		d *= 2
+	}
+	if d > maxAPIBackoff {
+		d = maxAPIBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retry returns a flag indicating whether or not the failed API call
+// should be retried, and if so, waits until it may be retried.
+func (s *apiScheduler) retry(
+	ctx context.Context,
+	rep *github.Response,
+	err error,
+	retries *int) bool {
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var d time.Duration
+	switch terr := err.(type) {
+	case *github.RateLimitError:
+		// All of the tokens are exhausted, so wait until the rate limit is
+		// reset, plus a second for any difference between the clocks.
+		reset := terr.Rate.Reset.Time.Add(time.Second)
+		if reset.After(s.now()) {
+			s.pauseUntil(reset)
+			fmt.Fprintf(
+				os.Stderr, "rate limit exceeded, waiting until %s\n",
+				reset.Format(time.RFC3339))
+			return s.sleep(ctx, reset.Sub(s.now())) == nil
+		}
+		// The rate limit should have been reset already, so the call is
+		// retried as though it failed.
+		if *retries >= s.config.Retries {
+			return false
+		}
+		d = s.backoff(*retries)
+	case *github.AbuseRateLimitError:
+		if *retries >= s.config.Retries {
+			return false
+		}
+		if terr.RetryAfter != nil {
+			d = *terr.RetryAfter
+		} else if d = s.backoff(*retries); d < minAbuseWait {
+			d = minAbuseWait
+		}
+		s.pauseUntil(s.now().Add(d))
+	default:
+		if *retries >= s.config.Retries {
+			return false
+		}
+		var ok bool
+		if d, ok = retryAfterHeader(rep); !ok {
+			if !isRetryableAPIError(rep, err) {
+				return false
+			}
+			d = s.backoff(*retries)
+		}
+	}
+
+	*retries++
+	return s.sleep(ctx, d) == nil
+}
+
+// retryAfterHeader returns the duration of the response's Retry-After
+// header.
+func retryAfterHeader(rep *github.Response) (time.Duration, bool) {
+	if rep == nil || rep.Response == nil {
+		return 0, false
+	}
+	if v := rep.Header.Get("Retry-After"); v != "" {
+		if secs, _ := strconv.Atoi(v); secs > 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// isRetryableAPIError returns a flag indicating whether or not the error
+// is a server error or a timeout that may succeed if it is retried.
+func isRetryableAPIError(rep *github.Response, err error) bool {
+	if rep != nil && rep.Response != nil {
+		switch rep.StatusCode {
+		case http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+	return false
+}
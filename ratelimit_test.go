@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func newTestAPIScheduler() (*apiScheduler, *[]time.Duration) {
+	var (
+		now    = time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+		sleeps []time.Duration
+	)
+	s := newAPIScheduler(githubAPIConfig{
+		Max:       2,
+		Retries:   3,
+		Wait:      time.Second,
+		RetryWait: 10 * time.Second,
+	})
+	s.now = func() time.Time { return now }
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+	return s, &sleeps
+}
+
+func testAPIResponse(status int, rate github.Rate) *github.Response {
+	return &github.Response{
+		Response: &http.Response{StatusCode: status, Header: http.Header{}},
+		Rate:     rate,
+	}
+}
+
+func TestAPISchedulerPacing(t *testing.T) {
+	ctx := context.Background()
+	s, sleeps := newTestAPIScheduler()
+
+	// Without a rate limit the calls are API.Wait apart for each of the
+	// concurrent calls.
+	s.wait(ctx)
+	s.done(nil)
+	s.wait(ctx)
+	s.done(nil)
+	if exp := []time.Duration{0, 500 * time.Millisecond}; !equalDurations(*sleeps, exp) {
+		t.Fatalf("exp=%v act=%v", exp, *sleeps)
+	}
+
+	// The remaining calls are spread out until the rate limit is reset.
+	s, sleeps = newTestAPIScheduler()
+	s.wait(ctx)
+	s.done(testAPIResponse(http.StatusOK, github.Rate{
+		Limit:     5000,
+		Remaining: 100,
+		Reset:     github.Timestamp{Time: s.now().Add(1000500 * time.Millisecond)},
+	}))
+	s.wait(ctx)
+	s.done(nil)
+	s.wait(ctx)
+	s.done(nil)
+	exp := []time.Duration{0, 500 * time.Millisecond, 10 * time.Second}
+	if !equalDurations(*sleeps, exp) {
+		t.Fatalf("exp=%v act=%v", exp, *sleeps)
+	}
+}
+
+func TestAPISchedulerRetry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rate limit", func(t *testing.T) {
+		s, sleeps := newTestAPIScheduler()
+		reset := s.now().Add(time.Hour)
+		err := &github.RateLimitError{
+			Rate: github.Rate{Reset: github.Timestamp{Time: reset}},
+		}
+		retries := 0
+		if !s.retry(ctx, nil, err, &retries) {
+			t.Fatal("expected retry")
+		}
+		if exp := time.Hour + time.Second; (*sleeps)[0] != exp {
+			t.Fatalf("exp=%v act=%v", exp, (*sleeps)[0])
+		}
+		if retries != 0 {
+			t.Fatalf("retries=%d", retries)
+		}
+	})
+
+	t.Run("abuse rate limit", func(t *testing.T) {
+		s, sleeps := newTestAPIScheduler()
+		retryAfter := 30 * time.Second
+		retries := 0
+		if !s.retry(ctx, nil,
+			&github.AbuseRateLimitError{RetryAfter: &retryAfter}, &retries) {
+			t.Fatal("expected retry")
+		}
+		if !s.retry(ctx, nil, &github.AbuseRateLimitError{}, &retries) {
+			t.Fatal("expected retry")
+		}
+		if (*sleeps)[0] != retryAfter || (*sleeps)[1] != minAbuseWait {
+			t.Fatalf("sleeps=%v", *sleeps)
+		}
+		if retries != 2 {
+			t.Fatalf("retries=%d", retries)
+		}
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		s, sleeps := newTestAPIScheduler()
+		rep := testAPIResponse(http.StatusBadGateway, github.Rate{})
+		retries := 0
+		for i := 0; i < 3; i++ {
+			if !s.retry(ctx, rep, errors.New("bad gateway"), &retries) {
+				t.Fatalf("%d: expected retry", i)
+			}
+			max := s.config.RetryWait << uint(i)
+			if d := (*sleeps)[i]; d < max/2 || d > max {
+				t.Errorf("%d: backoff=%v", i, d)
+			}
+		}
+		if s.retry(ctx, rep, errors.New("bad gateway"), &retries) {
+			t.Fatal("expected retries to be exhausted")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, _ := newTestAPIScheduler()
+		rep := testAPIResponse(http.StatusNotFound, github.Rate{})
+		retries := 0
+		if s.retry(ctx, rep, errors.New("not found"), &retries) {
+			t.Fatal("unexpected retry")
+		}
+	})
+}
+
+func equalDurations(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
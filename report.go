@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -27,52 +28,221 @@ var csvReportHeader = []string{
 	"pullRequestsAssigned",
 	"pullRequestsMentioned",
 	"pullRequestsMerged",
+	"reviews",
+	"reviewsApproved",
+	"reviewsChangesRequested",
+	"reviewsCommented",
+	"reviewComments",
+	"pullRequestsReviewed",
+	"coAuthoredCommits",
+	"effectiveAdditions",
+	"effectiveDeletions",
 }
 
-func (m member) csvFields(opts options) []string {
+var csvAreaReportHeader = []string{
+	"login",
+	"repo",
+	"area",
+	"commits",
+	"additions",
+	"deletions",
+	"effectiveAdditions",
+	"effectiveDeletions",
+}
+
+// reportSchemaVersion is incremented when the fields of the JSON and
+// NDJSON reports change in a way that is not backwards compatible.
+const reportSchemaVersion = 1
+
+// memberReport is a member's activity. Its JSON fields are named after
+// the columns of the CSV report.
+type memberReport struct {
+	Login                   string     `json:"login"`
+	Name                    string     `json:"name"`
+	Emails                  []string   `json:"emails"`
+	Commits                 int        `json:"commits"`
+	Additions               int        `json:"additions"`
+	Deletions               int        `json:"deletions"`
+	LatestCommitSHA         string     `json:"latestCommitSHA"`
+	LatestCommitDate        *time.Time `json:"latestCommitDate"`
+	IssuesCreated           int        `json:"issuesCreated"`
+	IssuesAssigned          int        `json:"issuesAssigned"`
+	IssuesMentioned         int        `json:"issuesMentioned"`
+	PullRequestsCreated     int        `json:"pullRequestsCreated"`
+	PullRequestsAssigned    int        `json:"pullRequestsAssigned"`
+	PullRequestsMentioned   int        `json:"pullRequestsMentioned"`
+	PullRequestsMerged      int        `json:"pullRequestsMerged"`
+	Reviews                 int        `json:"reviews"`
+	ReviewsApproved         int        `json:"reviewsApproved"`
+	ReviewsChangesRequested int        `json:"reviewsChangesRequested"`
+	ReviewsCommented        int        `json:"reviewsCommented"`
+	ReviewComments          int        `json:"reviewComments"`
+	PullRequestsReviewed    int        `json:"pullRequestsReviewed"`
+	CoAuthoredCommits       int        `json:"coAuthoredCommits"`
+	EffectiveAdditions      int        `json:"effectiveAdditions"`
+	EffectiveDeletions      int        `json:"effectiveDeletions"`
+
+	// CommitDetails and Areas are only included in the JSON and NDJSON
+	// reports.
+	CommitDetails []commitReport `json:"commitDetails"`
+	Areas         []areaStats    `json:"areas"`
+}
+
+// commitReport is a commit authored or co-authored by a member.
+type commitReport struct {
+	Repo               string    `json:"repo"`
+	SHA                string    `json:"sha"`
+	Subject            string    `json:"subject"`
+	AuthorDate         time.Time `json:"authorDate"`
+	CoAuthored         bool      `json:"coAuthored"`
+	Additions          int       `json:"additions"`
+	Deletions          int       `json:"deletions"`
+	EffectiveAdditions int       `json:"effectiveAdditions"`
+	EffectiveDeletions int       `json:"effectiveDeletions"`
+}
+
+// report returns the member's activity. Co-authored commits are counted
+// separately and do not contribute to the member's additions and
+// deletions.
+func (m member) report(opts options) memberReport {
 	var (
-		additions              int
-		deletions              int
-		latestCommitSHA        string
-		latestCommitDate       time.Time
-		latestCommitDateString string
+		issues  = m.issueAndPullRequestReport()
+		reviews = m.reviewReport()
+		r       = memberReport{
+			Login:                   m.Login,
+			Name:                    m.Name,
+			Emails:                  m.Emails,
+			IssuesCreated:           issues.Issues.Created,
+			IssuesAssigned:          issues.Issues.Assigned,
+			IssuesMentioned:         issues.Issues.Mentioned,
+			PullRequestsCreated:     issues.PullRequests.Created,
+			PullRequestsAssigned:    issues.PullRequests.Assigned,
+			PullRequestsMentioned:   issues.PullRequests.Mentioned,
+			PullRequestsMerged:      issues.PullRequests.Merged,
+			Reviews:                 reviews.Reviews,
+			ReviewsApproved:         reviews.Approved,
+			ReviewsChangesRequested: reviews.ChangesRequested,
+			ReviewsCommented:        reviews.Commented,
+			ReviewComments:          reviews.Comments,
+			PullRequestsReviewed:    reviews.PullRequestsReviewed,
+			CommitDetails:           []commitReport{},
+			Areas:                   m.areaReport(opts),
+		}
 	)
+	if r.Emails == nil {
+		r.Emails = []string{}
+	}
+	if r.Areas == nil {
+		r.Areas = []areaStats{}
+	}
+
 	for _, c := range m.Commits {
-		if c.AuthorDate.After(latestCommitDate) {
-			latestCommitSHA = c.Short
-			latestCommitDate = c.AuthorDate
-			if opts.config.UTC {
-				latestCommitDate = latestCommitDate.UTC()
-			}
-			//Mon Jan 2 15:04:05 -0700 MST 2006
-			latestCommitDateString = latestCommitDate.Format(
-				"2006-01-02:15:04:05-07")
+		authorDate := c.AuthorDate
+		if opts.config.UTC {
+			authorDate = authorDate.UTC()
+		}
+		if r.LatestCommitDate == nil || authorDate.After(*r.LatestCommitDate) {
+			r.LatestCommitSHA = c.Short
+			r.LatestCommitDate = &authorDate
+		}
+
+		cr := commitReport{
+			Repo:       c.Repo,
+			SHA:        c.Long,
+			Subject:    c.Subject,
+			AuthorDate: authorDate,
+			CoAuthored: c.CoAuthored,
 		}
 		for _, ce := range c.Changes {
-			additions = additions + ce.Add
-			deletions = deletions + ce.Del
+			cr.Additions = cr.Additions + ce.Add
+			cr.Deletions = cr.Deletions + ce.Del
+			if !opts.exclusions.excluded(c.Repo, ce) {
+				cr.EffectiveAdditions = cr.EffectiveAdditions + ce.Add
+				cr.EffectiveDeletions = cr.EffectiveDeletions + ce.Del
+			}
+		}
+		r.CommitDetails = append(r.CommitDetails, cr)
+
+		if c.CoAuthored {
+			r.CoAuthoredCommits++
+			continue
 		}
+		r.Commits++
+		r.Additions = r.Additions + cr.Additions
+		r.Deletions = r.Deletions + cr.Deletions
+		r.EffectiveAdditions = r.EffectiveAdditions + cr.EffectiveAdditions
+		r.EffectiveDeletions = r.EffectiveDeletions + cr.EffectiveDeletions
 	}
 
+	sort.Slice(r.CommitDetails, func(i, j int) bool {
+		return r.CommitDetails[i].AuthorDate.After(
+			r.CommitDetails[j].AuthorDate)
+	})
+	return r
+}
+
+// add adds the counts of another report to the report. The identity,
+// latest commit and details of the report are not changed.
+func (r *memberReport) add(o memberReport) {
+	r.Commits += o.Commits
+	r.Additions += o.Additions
+	r.Deletions += o.Deletions
+	r.IssuesCreated += o.IssuesCreated
+	r.IssuesAssigned += o.IssuesAssigned
+	r.IssuesMentioned += o.IssuesMentioned
+	r.PullRequestsCreated += o.PullRequestsCreated
+	r.PullRequestsAssigned += o.PullRequestsAssigned
+	r.PullRequestsMentioned += o.PullRequestsMentioned
+	r.PullRequestsMerged += o.PullRequestsMerged
+	r.Reviews += o.Reviews
+	r.ReviewsApproved += o.ReviewsApproved
+	r.ReviewsChangesRequested += o.ReviewsChangesRequested
+	r.ReviewsCommented += o.ReviewsCommented
+	r.ReviewComments += o.ReviewComments
+	r.PullRequestsReviewed += o.PullRequestsReviewed
+	r.CoAuthoredCommits += o.CoAuthoredCommits
+	r.EffectiveAdditions += o.EffectiveAdditions
+	r.EffectiveDeletions += o.EffectiveDeletions
+}
+
+func (r memberReport) csvFields() []string {
+	var latestCommitDate string
+	if r.LatestCommitDate != nil {
+		//Mon Jan 2 15:04:05 -0700 MST 2006
+		latestCommitDate = r.LatestCommitDate.Format("2006-01-02:15:04:05-07")
+	}
 	return []string{
-		m.Login,
-		m.Name,
-		strings.Join(m.Emails, "|"),
-		strconv.Itoa(len(m.Commits)),
-		strconv.Itoa(additions),
-		strconv.Itoa(deletions),
-		latestCommitSHA,
-		latestCommitDateString,
-		"", //strconv.Itoa(r.Issues.Created),
-		"", //strconv.Itoa(r.Issues.Assigned),
-		"", //strconv.Itoa(r.Issues.Mentioned),
-		"", //strconv.Itoa(r.PullRequests.Created),
-		"", //strconv.Itoa(r.PullRequests.Assigned),
-		"", //strconv.Itoa(r.PullRequests.Mentioned),
-		"", //strconv.Itoa(r.PullRequests.Merged),
+		r.Login,
+		r.Name,
+		strings.Join(r.Emails, "|"),
+		strconv.Itoa(r.Commits),
+		strconv.Itoa(r.Additions),
+		strconv.Itoa(r.Deletions),
+		r.LatestCommitSHA,
+		latestCommitDate,
+		strconv.Itoa(r.IssuesCreated),
+		strconv.Itoa(r.IssuesAssigned),
+		strconv.Itoa(r.IssuesMentioned),
+		strconv.Itoa(r.PullRequestsCreated),
+		strconv.Itoa(r.PullRequestsAssigned),
+		strconv.Itoa(r.PullRequestsMentioned),
+		strconv.Itoa(r.PullRequestsMerged),
+		strconv.Itoa(r.Reviews),
+		strconv.Itoa(r.ReviewsApproved),
+		strconv.Itoa(r.ReviewsChangesRequested),
+		strconv.Itoa(r.ReviewsCommented),
+		strconv.Itoa(r.ReviewComments),
+		strconv.Itoa(r.PullRequestsReviewed),
+		strconv.Itoa(r.CoAuthoredCommits),
+		strconv.Itoa(r.EffectiveAdditions),
+		strconv.Itoa(r.EffectiveDeletions),
 	}
 }
 
+func (m member) csvFields(opts options) []string {
+	return m.report(opts).csvFields()
+}
+
 type issueReport struct {
 	Created   int `json:"created,omitempty"`
 	Assigned  int `json:"assigned,omitempty"`
@@ -94,6 +264,35 @@ func (i issueAndPullRequestReport) hasIssues() bool {
 	return i.Issues.hasIssues() || i.PullRequests.hasIssues()
 }
 
+func (i *issueReport) add(is issue) {
+	if is.Created {
+		i.Created++
+		if is.MergedAt != nil {
+			i.Merged++
+		}
+	}
+	if is.Assigned {
+		i.Assigned++
+	}
+	if is.Mentioned {
+		i.Mentioned++
+	}
+}
+
+// issueAndPullRequestReport counts the member's cached issues and
+// pull requests.
+func (m member) issueAndPullRequestReport() issueAndPullRequestReport {
+	r := issueAndPullRequestReport{Login: m.Login}
+	for _, is := range m.Issues {
+		if is.IsPullRequest {
+			r.PullRequests.add(is)
+		} else {
+			r.Issues.add(is)
+		}
+	}
+	return r
+}
+
 func writeReport(
 	ctx context.Context, chanMembers chan member, opts options) error {
 
@@ -104,7 +303,11 @@ func writeReport(
 		reportName = "report"
 	}
 
-	// Create the CSV report file and CSV writer for stdout.
+	if err := writeReportMetadata(reportName, opts); err != nil {
+		return err
+	}
+
+	// Create the CSV report file and the encoder for stdout.
 	// An io.Multiwriter is not used because stdout receives all
 	// members, but the report only receives members that have
 	// activity.
@@ -116,21 +319,187 @@ func writeReport(
 	}
 	defer csvf.Close()
 
-	csvw := csv.NewWriter(csvf)
-	defer csvw.Flush()
-	csvw.Write(csvReportHeader)
-	csvw.Flush()
-	if err := csvw.Error(); err != nil {
+	csvw, err := newCSVReportEncoder(csvf)
+	if err != nil {
+		return err
+	}
+
+	// The JSON and NDJSON reports are written in addition to the CSV
+	// report.
+	var fmtw reportEncoder
+	if format := opts.config.Format; format != formatCSV {
+		fmtFileName := fmt.Sprintf("%s.%s", reportName, format)
+		fmtFilePath := path.Join(opts.config.OutputDir, fmtFileName)
+		fmtf, err := os.Create(fmtFilePath)
+		if err != nil {
+			return err
+		}
+		defer fmtf.Close()
+
+		if fmtw, err = newReportEncoder(fmtf, format, opts); err != nil {
+			return err
+		}
+	}
+
+	// The repository report breaks each member's activity down by the
+	// repository in which it occurred.
+	repoFileName := fmt.Sprintf("%s-repos.csv", reportName)
+	repoFilePath := path.Join(opts.config.OutputDir, repoFileName)
+	repof, err := os.Create(repoFilePath)
+	if err != nil {
+		return err
+	}
+	defer repof.Close()
+
+	repow := csv.NewWriter(repof)
+	defer repow.Flush()
+	repow.Write(append([]string{"repo"}, csvReportHeader...))
+	repow.Flush()
+	if err := repow.Error(); err != nil {
+		return err
+	}
+
+	// The area report breaks each member's commit activity down by the
+	// areas of the repositories in which it occurred.
+	areaFileName := fmt.Sprintf("%s-areas.csv", reportName)
+	areaFilePath := path.Join(opts.config.OutputDir, areaFileName)
+	areaf, err := os.Create(areaFilePath)
+	if err != nil {
+		return err
+	}
+	defer areaf.Close()
+
+	areaw := csv.NewWriter(areaf)
+	defer areaw.Flush()
+	areaw.Write(csvAreaReportHeader)
+	areaw.Flush()
+	if err := areaw.Error(); err != nil {
 		return err
 	}
 
-	csvo := csv.NewWriter(os.Stdout)
-	defer csvo.Flush()
-	csvo.Write(csvReportHeader)
-	csvo.Flush()
-	if err := csvo.Error(); err != nil {
+	// The period reports break each member's activity, and the activity
+	// of all of the members, down by the period in which it occurred.
+	var (
+		periodw *csv.Writer
+		orgw    *csv.Writer
+		org     *orgPeriods
+	)
+	if opts.config.Period != "" {
+		periodFileName := fmt.Sprintf("%s-periods.csv", reportName)
+		periodFilePath := path.Join(opts.config.OutputDir, periodFileName)
+		periodf, err := os.Create(periodFilePath)
+		if err != nil {
+			return err
+		}
+		defer periodf.Close()
+
+		periodw = csv.NewWriter(periodf)
+		defer periodw.Flush()
+		periodw.Write(append([]string{"period"}, csvReportHeader...))
+		periodw.Flush()
+		if err := periodw.Error(); err != nil {
+			return err
+		}
+
+		orgFileName := fmt.Sprintf("%s-periods-org.csv", reportName)
+		orgFilePath := path.Join(opts.config.OutputDir, orgFileName)
+		orgf, err := os.Create(orgFilePath)
+		if err != nil {
+			return err
+		}
+		defer orgf.Close()
+
+		orgw = csv.NewWriter(orgf)
+		defer orgw.Flush()
+		orgw.Write(csvPeriodOrgReportHeader)
+		orgw.Flush()
+		if err := orgw.Error(); err != nil {
+			return err
+		}
+
+		org = newOrgPeriods(opts.config.MemberOrg)
+	}
+
+	// The dashboard and the Markdown report are written after all of the
+	// members are reported. The Markdown template is parsed first so an
+	// invalid template is reported before any members are collected.
+	dash := newDashboard()
+	mdTemplate, err := parseMarkdownTemplate(opts)
+	if err != nil {
 		return err
 	}
+	md := newMarkdownReport(opts)
+
+	// The org summary is computed after all of the members are reported.
+	summ := &summarizer{}
+
+	// The SQLite export has all of the activity of every member,
+	// regardless of -since and -until.
+	var sqlx *sqliteExport
+	if opts.config.SQLite {
+		dbFilePath := path.Join(opts.config.OutputDir, reportName+".db")
+		if sqlx, err = newSQLiteExport(dbFilePath); err != nil {
+			return err
+		}
+	}
+
+	stdout, err := newReportEncoder(os.Stdout, opts.config.Format, opts)
+	if err != nil {
+		return err
+	}
+
+	// finish writes the org summary and the reports that require all of
+	// the members.
+	finish := func() error {
+		sum := summ.summary(opts)
+		if err := stdout.close(sum); err != nil {
+			return err
+		}
+		if fmtw != nil {
+			if err := fmtw.close(sum); err != nil {
+				return err
+			}
+		}
+
+		sumFileName := fmt.Sprintf("%s-summary.csv", reportName)
+		sumFilePath := path.Join(opts.config.OutputDir, sumFileName)
+		sumf, err := os.Create(sumFilePath)
+		if err != nil {
+			return err
+		}
+		defer sumf.Close()
+		if err := sum.encodeCSV(sumf); err != nil {
+			return err
+		}
+		if opts.config.Format == formatCSV {
+			fmt.Fprintf(os.Stderr, "summary written to %s\n", sumFilePath)
+		}
+
+		dashFileName := fmt.Sprintf("%s.html", reportName)
+		dashFilePath := path.Join(opts.config.OutputDir, dashFileName)
+		if err := dash.writeToDisk(dashFilePath, sum, opts); err != nil {
+			return err
+		}
+
+		mdFileName := fmt.Sprintf("%s.md", reportName)
+		mdFilePath := path.Join(opts.config.OutputDir, mdFileName)
+		if err := md.writeToDisk(
+			mdFilePath, mdTemplate, sum, opts); err != nil {
+			return err
+		}
+
+		if sqlx != nil {
+			if err := sqlx.close(); err != nil {
+				return err
+			}
+		}
+
+		if org == nil {
+			return nil
+		}
+		orgw.WriteAll(org.csvRecords(opts))
+		return orgw.Error()
+	}
 
 	for {
 		select {
@@ -138,27 +507,81 @@ func writeReport(
 			return nil
 		case m, ok := <-chanMembers:
 			if !ok {
-				return nil
+				return finish()
 			}
+			if sqlx != nil {
+				if err := sqlx.add(m, opts); err != nil {
+					return err
+				}
+			}
+			m = m.forWindow(opts)
 
-			fields := m.csvFields(opts)
-			csvo.Write(fields)
-			csvo.Flush()
-			if err := csvo.Error(); err != nil {
+			r := m.report(opts)
+			if err := stdout.encode(r); err != nil {
 				return err
 			}
 
-			// Do not report entries with no commits.
-			if len(m.Commits) == 0 {
+			// Every member is counted by the org summary, which computes
+			// the distributions from the active contributors.
+			summ.add(r)
+
+			// Do not report entries with no commits, issues,
+			// pull requests or reviews.
+			if len(m.Commits) == 0 &&
+				!m.issueAndPullRequestReport().hasIssues() &&
+				!m.reviewReport().hasReviews() {
 				continue
 			}
 
-			// Encode to CSV
-			csvw.Write(fields)
-			csvw.Flush()
-			if err := csvw.Error(); err != nil {
+			if err := csvw.encode(r); err != nil {
+				return err
+			}
+			if fmtw != nil {
+				if err := fmtw.encode(r); err != nil {
+					return err
+				}
+			}
+			dash.add(m, r, opts)
+			md.add(m, r, opts)
+
+			for _, repo := range m.repos() {
+				repoFields := m.forRepo(repo).csvFields(opts)
+				repow.Write(append([]string{repo}, repoFields...))
+			}
+			repow.Flush()
+			if err := repow.Error(); err != nil {
+				return err
+			}
+
+			for _, a := range m.areaReport(opts) {
+				areaw.Write([]string{
+					m.Login,
+					a.Repo,
+					a.Area,
+					strconv.Itoa(a.Commits),
+					strconv.Itoa(a.Additions),
+					strconv.Itoa(a.Deletions),
+					strconv.Itoa(a.EffectiveAdditions),
+					strconv.Itoa(a.EffectiveDeletions),
+				})
+			}
+			areaw.Flush()
+			if err := areaw.Error(); err != nil {
+				return err
+			}
+
+			if periodw == nil {
+				continue
+			}
+			for _, p := range m.periods(opts) {
+				periodFields := m.forPeriod(p, opts).csvFields(opts)
+				periodw.Write(append([]string{p}, periodFields...))
+			}
+			periodw.Flush()
+			if err := periodw.Error(); err != nil {
 				return err
 			}
+			org.add(m, opts)
 		}
 	}
 }
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+const (
+	reviewApproved         = "APPROVED"
+	reviewChangesRequested = "CHANGES_REQUESTED"
+	reviewCommented        = "COMMENTED"
+)
+
+type review struct {
+	ID          int64      `json:"id"`
+	Repo        string     `json:"repo"`
+	PullRequest int        `json:"pullRequest"`
+	State       string     `json:"state"`
+	SubmittedAt *time.Time `json:"submittedAt,omitempty"`
+}
+
+type reviewComment struct {
+	ID          int64      `json:"id"`
+	Repo        string     `json:"repo"`
+	PullRequest int        `json:"pullRequest"`
+	Path        string     `json:"path,omitempty"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+}
+
+// reviewCheckpointInterval is how often the progress of a review index's
+// update is written to disk.
+const reviewCheckpointInterval = time.Duration(1) * time.Minute
+
+// reviewIndex is the review activity in a target repository, keyed by
+// the login of the reviewer.
+type reviewIndex struct {
+	sync.Mutex `json:"-"`
+
+	// UpdatedAt is the time at which the newest pull request in the index
+	// was updated. The pull requests updated at or before it are indexed.
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+
+	// Partial is the progress of an update that did not finish.
+	Partial *reviewProgress `json:"partial,omitempty"`
+
+	// Since is the -since with which the index was built. The pull
+	// requests that were not updated since then are not indexed, so the
+	// index is rebuilt when an earlier window is reported.
+	Since *time.Time `json:"since,omitempty"`
+
+	Reviews  map[string][]review        `json:"reviews"`
+	Comments map[string][]reviewComment `json:"comments"`
+}
+
+// reviewProgress is the progress of an update of a review index. The pull
+// requests are listed from the most to the least recently updated, and
+// those updated after Oldest and at or before Newest have been fetched.
+type reviewProgress struct {
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+}
+
+// fetched returns a flag indicating whether or not a pull request updated
+// at the given time was fetched by an update that did not finish.
+func (x *reviewIndex) fetched(updatedAt time.Time) bool {
+	return x.Partial != nil &&
+		updatedAt.After(x.Partial.Oldest) &&
+		!updatedAt.After(x.Partial.Newest)
+}
+
+// checkpoint records that the pull requests updated after oldest and at or
+// before newest have been fetched. The fetched pull requests of an earlier
+// update are included once the current update reaches them.
+func (x *reviewIndex) checkpoint(oldest, newest time.Time) {
+	if p := x.Partial; p != nil {
+		if oldest.After(p.Newest) {
+			// The ranges are not contiguous yet, so the earlier progress
+			// is kept and the pull requests fetched since then are fetched
+			// again by the next update.
+			return
+		}
+		if p.Oldest.Before(oldest) {
+			oldest = p.Oldest
+		}
+		if p.Newest.After(newest) {
+			newest = p.Newest
+		}
+	}
+	x.Partial = &reviewProgress{Oldest: oldest, Newest: newest}
+}
+
+// finish records that all of the pull requests updated at or before newest
+// have been fetched.
+func (x *reviewIndex) finish(newest *time.Time) {
+	if p := x.Partial; p != nil && (newest == nil || p.Newest.After(*newest)) {
+		newest = &p.Newest
+	}
+	if newest != nil && (x.UpdatedAt == nil || newest.After(*x.UpdatedAt)) {
+		x.UpdatedAt = newest
+	}
+	x.Partial = nil
+}
+
+func reviewIndexFilePath(t target, opts options) string {
+	return path.Join(
+		opts.config.OutputDir,
+		".cache",
+		"reviews",
+		t.Org,
+		t.Repo+".json")
+}
+
+func (x *reviewIndex) loadFromDisk(t target, opts options) error {
+	f, err := os.Open(reviewIndexFilePath(t, opts))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(x)
+}
+
+// writeToDisk writes the index to the cache.
+func (x *reviewIndex) writeToDisk(t target, opts options) error {
+	x.Lock()
+	defer x.Unlock()
+
+	filePath := reviewIndexFilePath(t, opts)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(path.Dir(filePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(x); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
+
+func (x *reviewIndex) addReview(login string, r review) {
+	x.Lock()
+	defer x.Unlock()
+	login = strings.ToLower(login)
+	for _, e := range x.Reviews[login] {
+		if e.ID == r.ID {
+			return
+		}
+	}
+	x.Reviews[login] = append(x.Reviews[login], r)
+}
+
+func (x *reviewIndex) addComment(login string, c reviewComment) {
+	x.Lock()
+	defer x.Unlock()
+	login = strings.ToLower(login)
+	for _, e := range x.Comments[login] {
+		if e.ID == c.ID {
+			return
+		}
+	}
+	x.Comments[login] = append(x.Comments[login], c)
+}
+
+// reviewIndexes are the review indexes of the target repositories, which
+// are loaded when the first member is reported.
+type reviewIndexes struct {
+	once    sync.Once
+	indexes map[string]*reviewIndex
+	err     error
+}
+
+// get returns the review indexes for all of the targets, keyed by target.
+// The indexes are loaded and updated by the first call, and subsequent
+// calls return the same indexes or error.
+func (r *reviewIndexes) get(
+	ctx context.Context, opts options) (map[string]*reviewIndex, error) {
+
+	if r == nil {
+		return nil, nil
+	}
+	r.once.Do(func() {
+		r.indexes, r.err = getReviewIndexes(ctx, opts)
+	})
+	return r.indexes, r.err
+}
+
+// getReviewIndexes returns the review indexes for all of the targets,
+// keyed by target.
+func getReviewIndexes(
+	ctx context.Context, opts options) (map[string]*reviewIndex, error) {
+
+	indexes := map[string]*reviewIndex{}
+	for _, t := range opts.targets {
+		x, err := getReviewIndex(ctx, t, opts)
+		if err != nil {
+			return nil, err
+		}
+		indexes[t.String()] = x
+	}
+	return indexes, nil
+}
+
+// getReviewIndex loads the target's cached review index and, unless
+// disabled, updates it with the pull requests that changed since the
+// last run.
+func getReviewIndex(
+	ctx context.Context, t target, opts options) (*reviewIndex, error) {
+
+	x := &reviewIndex{
+		Reviews:  map[string][]review{},
+		Comments: map[string][]reviewComment{},
+	}
+	if err := x.loadFromDisk(t, opts); err != nil {
+		return nil, err
+	}
+	if opts.config.GitHub.NoReviews {
+		return x, nil
+	}
+
+	// The pull requests updated before the start of the window were not
+	// reviewed in it. If the index was built for a later window then the
+	// pull requests updated before it are listed again.
+	since := opts.config.Since
+	if !windowCovers(x.Since, nil, since, nil) {
+		x.UpdatedAt = nil
+	}
+	rebuild := x.UpdatedAt == nil
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+		chanPRs  = make(chan *github.PullRequest)
+		workers  = opts.config.GitHub.API.Max
+	)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for pr := range chanPRs {
+				err := x.fetchPullRequest(workerCtx, t, pr, opts)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					cancel()
+				}
+				wg.Done()
+			}
+		}()
+	}
+	defer close(chanPRs)
+
+	var (
+		newest     *time.Time
+		oldest     *time.Time
+		checkpoint = time.Now()
+		done       bool
+		retries    = 0
+		listOpts   = &github.PullRequestListOptions{
+			State:       "all",
+			Sort:        "updated",
+			Direction:   "desc",
+			ListOptions: github.ListOptions{Page: 1, PerPage: 100},
+		}
+	)
+
+	for !done && workerCtx.Err() == nil && listOpts.Page > 0 {
+		opts.api.wait(workerCtx)
+		prs, rep, err := opts.github.PullRequests.List(
+			workerCtx, t.Org, t.Repo, listOpts)
+		opts.api.done(rep)
+		if err != nil {
+			if opts.api.retry(workerCtx, rep, err, &retries) {
+				continue
+			}
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			errMu.Unlock()
+			break
+		}
+
+		var pageOldest *time.Time
+		for i := 0; i < len(prs) && workerCtx.Err() == nil; i++ {
+			pr := prs[i]
+
+			// The pull requests are sorted by the time they were last
+			// updated, so the first one that is not newer than the
+			// cached index marks the end of the new activity.
+			if x.UpdatedAt != nil && pr.UpdatedAt != nil &&
+				!pr.UpdatedAt.After(*x.UpdatedAt) {
+				done = true
+				break
+			}
+			if since != nil && pr.UpdatedAt != nil &&
+				pr.UpdatedAt.Before(*since) {
+				done = true
+				break
+			}
+			if pr.UpdatedAt != nil {
+				if newest == nil {
+					newest = pr.UpdatedAt
+				}
+				pageOldest = pr.UpdatedAt
+				if x.fetched(*pr.UpdatedAt) {
+					continue
+				}
+			}
+
+			wg.Add(1)
+			chanPRs <- pr
+		}
+
+		// The progress includes the page once all of its pull requests
+		// are fetched.
+		wg.Wait()
+		if workerCtx.Err() != nil {
+			break
+		}
+		if pageOldest != nil {
+			oldest = pageOldest
+		}
+		if oldest != nil && time.Since(checkpoint) >= reviewCheckpointInterval {
+			x.checkpoint(*oldest, *newest)
+			if err := x.writeToDisk(t, opts); err != nil {
+				return nil, err
+			}
+			checkpoint = time.Now()
+		}
+
+		listOpts.Page = rep.NextPage
+	}
+	wg.Wait()
+
+	err := firstErr
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		// Keep the progress so the next run resumes the update.
+		if oldest != nil {
+			x.checkpoint(*oldest, *newest)
+		}
+		if werr := x.writeToDisk(t, opts); werr != nil {
+			return nil, werr
+		}
+		return nil, err
+	}
+
+	x.finish(newest)
+	if rebuild {
+		x.Since = since
+	}
+	if err := x.writeToDisk(t, opts); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// fetchPullRequest adds the reviews and review comments of a pull request
+// to the index. Activity by the author of the pull request is ignored.
+func (x *reviewIndex) fetchPullRequest(
+	ctx context.Context,
+	t target,
+	pr *github.PullRequest,
+	opts options) error {
+
+	var (
+		number = pr.GetNumber()
+		author = pr.GetUser().GetLogin()
+	)
+
+	listOpts := &github.ListOptions{Page: 1}
+	retries := 0
+	for ctx.Err() == nil && listOpts.Page > 0 {
+		opts.api.wait(ctx)
+		reviews, rep, err := opts.github.PullRequests.ListReviews(
+			ctx, t.Org, t.Repo, number, listOpts)
+		opts.api.done(rep)
+		if err != nil {
+			if opts.api.retry(ctx, rep, err, &retries) {
+				continue
+			}
+			return err
+		}
+		for _, r := range reviews {
+			login := r.GetUser().GetLogin()
+			if login == "" || login == author || r.GetState() == "PENDING" {
+				continue
+			}
+			x.addReview(login, review{
+				ID:          r.GetID(),
+				Repo:        t.String(),
+				PullRequest: number,
+				State:       r.GetState(),
+				SubmittedAt: r.SubmittedAt,
+			})
+		}
+		listOpts.Page = rep.NextPage
+	}
+
+	commentOpts := &github.PullRequestListCommentsOptions{
+		ListOptions: github.ListOptions{Page: 1},
+	}
+	retries = 0
+	for ctx.Err() == nil && commentOpts.Page > 0 {
+		opts.api.wait(ctx)
+		comments, rep, err := opts.github.PullRequests.ListComments(
+			ctx, t.Org, t.Repo, number, commentOpts)
+		opts.api.done(rep)
+		if err != nil {
+			if opts.api.retry(ctx, rep, err, &retries) {
+				continue
+			}
+			return err
+		}
+		for _, c := range comments {
+			login := c.GetUser().GetLogin()
+			if login == "" || login == author {
+				continue
+			}
+			x.addComment(login, reviewComment{
+				ID:          c.GetID(),
+				Repo:        t.String(),
+				PullRequest: number,
+				Path:        c.GetPath(),
+				CreatedAt:   c.CreatedAt,
+			})
+		}
+		commentOpts.Page = rep.NextPage
+	}
+
+	return ctx.Err()
+}
+
+// loadFromReviewIndexes adds the member's reviews and review comments
+// from the targets' review indexes to the member.
+func (m *member) loadFromReviewIndexes(indexes map[string]*reviewIndex) {
+	for _, x := range indexes {
+		m.loadFromReviewIndex(x)
+	}
+}
+
+func (m *member) loadFromReviewIndex(x *reviewIndex) {
+	x.Lock()
+	defer x.Unlock()
+
+	login := strings.ToLower(m.Login)
+
+	known := map[int64]struct{}{}
+	for _, r := range m.Reviews {
+		known[r.ID] = struct{}{}
+	}
+	for _, r := range x.Reviews[login] {
+		if _, ok := known[r.ID]; !ok {
+			m.Reviews = append(m.Reviews, r)
+		}
+	}
+
+	known = map[int64]struct{}{}
+	for _, c := range m.ReviewComments {
+		known[c.ID] = struct{}{}
+	}
+	for _, c := range x.Comments[login] {
+		if _, ok := known[c.ID]; !ok {
+			m.ReviewComments = append(m.ReviewComments, c)
+		}
+	}
+}
+
+type reviewReport struct {
+	Reviews              int `json:"reviews,omitempty"`
+	Approved             int `json:"approved,omitempty"`
+	ChangesRequested     int `json:"changesRequested,omitempty"`
+	Commented            int `json:"commented,omitempty"`
+	Comments             int `json:"comments,omitempty"`
+	PullRequestsReviewed int `json:"pullRequestsReviewed,omitempty"`
+}
+
+func (r reviewReport) hasReviews() bool {
+	return r.Reviews > 0 || r.Comments > 0
+}
+
+// reviewReport counts the member's cached reviews and review comments.
+func (m member) reviewReport() reviewReport {
+	var (
+		r   = reviewReport{Comments: len(m.ReviewComments)}
+		prs = map[string]struct{}{}
+	)
+	for _, rv := range m.Reviews {
+		r.Reviews++
+		switch rv.State {
+		case reviewApproved:
+			r.Approved++
+		case reviewChangesRequested:
+			r.ChangesRequested++
+		case reviewCommented:
+			r.Commented++
+		}
+		prs[fmt.Sprintf("%s#%d", rv.Repo, rv.PullRequest)] = struct{}{}
+	}
+	for _, c := range m.ReviewComments {
+		prs[fmt.Sprintf("%s#%d", c.Repo, c.PullRequest)] = struct{}{}
+	}
+	r.PullRequestsReviewed = len(prs)
+	return r
+}
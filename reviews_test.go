@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// testPullRequest is a pull request served by testPullRequestServer. Each
+// reviewer has one approving review and one review comment.
+type testPullRequest struct {
+	number    int
+	author    string
+	updatedAt time.Time
+	reviewers []string
+}
+
+// testPullRequestServer serves the pull requests of vmware/impact, two per
+// page, and their reviews and review comments.
+type testPullRequestServer struct {
+	sync.Mutex
+	prs []*testPullRequest
+
+	// fetched is the number of times the reviews of each pull request
+	// were listed.
+	fetched map[int]int
+
+	// fail are the pull requests whose reviews cannot be listed.
+	fail map[int]bool
+
+	// inFlight and maxInFlight are the number of concurrent requests for
+	// reviews.
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *testPullRequestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/repos/vmware/impact/pulls"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(
+		strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+
+	if parts[0] == "" {
+		s.Lock()
+		prs := append([]*testPullRequest{}, s.prs...)
+		s.Unlock()
+		sort.Slice(prs, func(i, j int) bool {
+			return prs[i].updatedAt.After(prs[j].updatedAt)
+		})
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		start, end := (page-1)*2, page*2
+		if start > len(prs) {
+			start = len(prs)
+		}
+		if end >= len(prs) {
+			end = len(prs)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(
+				`<%s%s?page=%d>; rel="next"`, "http://"+r.Host, prefix, page+1))
+		}
+		var v []map[string]interface{}
+		for _, pr := range prs[start:end] {
+			v = append(v, map[string]interface{}{
+				"number":     pr.number,
+				"user":       map[string]string{"login": pr.author},
+				"updated_at": pr.updatedAt,
+			})
+		}
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+
+	number, _ := strconv.Atoi(parts[0])
+	s.Lock()
+	var pr *testPullRequest
+	for _, p := range s.prs {
+		if p.number == number {
+			pr = p
+		}
+	}
+	fail := s.fail[number]
+	s.Unlock()
+	if pr == nil || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var v []map[string]interface{}
+	switch parts[1] {
+	case "reviews":
+		s.Lock()
+		s.fetched[number]++
+		s.inFlight++
+		if s.inFlight > s.maxInFlight {
+			s.maxInFlight = s.inFlight
+		}
+		s.Unlock()
+		defer func() {
+			s.Lock()
+			s.inFlight--
+			s.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if fail {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"message":"failed"}`)
+			return
+		}
+		for i, login := range pr.reviewers {
+			v = append(v, map[string]interface{}{
+				"id":           number*100 + i,
+				"user":         map[string]string{"login": login},
+				"state":        reviewApproved,
+				"submitted_at": pr.updatedAt,
+			})
+		}
+	case "comments":
+		for i, login := range pr.reviewers {
+			v = append(v, map[string]interface{}{
+				"id":         number*100 + i,
+				"user":       map[string]string{"login": login},
+				"path":       "main.go",
+				"created_at": pr.updatedAt,
+			})
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestPullRequestServer() (*testPullRequestServer, *httptest.Server) {
+	ps := &testPullRequestServer{
+		fetched: map[int]int{},
+		fail:    map[int]bool{},
+	}
+	start := time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		ps.prs = append(ps.prs, &testPullRequest{
+			number:    i,
+			author:    "akutz",
+			updatedAt: start.Add(time.Duration(i) * time.Hour),
+			reviewers: []string{"bob", "akutz"},
+		})
+	}
+	return ps, httptest.NewServer(ps)
+}
+
+func newTestAPIOptions(
+	t *testing.T, s *httptest.Server, outputDir string) options {
+
+	var opts options
+	opts.config.OutputDir = outputDir
+	opts.config.GitHub.API.Max = 2
+	opts.api = newAPIScheduler(opts.config.GitHub.API)
+	opts.github = github.NewClient(nil)
+	var err error
+	if opts.github.BaseURL, err = url.Parse(s.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func TestReviewIndexCheckpoint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ps, s := newTestPullRequestServer()
+	defer s.Close()
+	opts := newTestAPIOptions(t, s, tmpDir)
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact"}
+
+	// The third most recently updated pull request is on the second page,
+	// so the first page is checkpointed.
+	ps.fail[3] = true
+	if _, err := getReviewIndex(ctx, tgt, opts); err == nil {
+		t.Fatal("exp error")
+	}
+	if ps.maxInFlight > opts.config.GitHub.API.Max {
+		t.Errorf("maxInFlight=%d, expected <= %d",
+			ps.maxInFlight, opts.config.GitHub.API.Max)
+	}
+
+	x := &reviewIndex{}
+	if err := x.loadFromDisk(tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if x.UpdatedAt != nil {
+		t.Errorf("updatedAt=%v, expected nil", x.UpdatedAt)
+	}
+	if p := x.Partial; p == nil ||
+		!p.Newest.Equal(ps.prs[4].updatedAt) ||
+		!p.Oldest.Equal(ps.prs[3].updatedAt) {
+		t.Fatalf("partial=%+v", p)
+	}
+	if n := len(x.Reviews["bob"]); n < 2 {
+		t.Errorf("len(reviews)=%d, expected at least 2", n)
+	}
+
+	// The next update resumes after the checkpointed pull requests. The
+	// oldest of them is fetched again since another pull request may have
+	// been updated at the same time.
+	ps.fail[3] = false
+	ps.fetched = map[int]int{}
+	if x, err = getReviewIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	for number, exp := range map[int]int{5: 0, 4: 1, 3: 1, 2: 1, 1: 1} {
+		if act := ps.fetched[number]; act != exp {
+			t.Errorf("fetched[%d]=%d, expected %d", number, act, exp)
+		}
+	}
+	if x.Partial != nil {
+		t.Errorf("partial=%+v, expected nil", x.Partial)
+	}
+	if x.UpdatedAt == nil || !x.UpdatedAt.Equal(ps.prs[4].updatedAt) {
+		t.Errorf("updatedAt=%v, expected %v", x.UpdatedAt, ps.prs[4].updatedAt)
+	}
+	if n := len(x.Reviews["bob"]); n != 5 {
+		t.Errorf("len(reviews)=%d, expected 5", n)
+	}
+}
+
+func TestReviewProgressCheckpoint(t *testing.T) {
+	at := func(h int) time.Time {
+		return time.Date(2018, 7, 1, h, 0, 0, 0, time.UTC)
+	}
+	x := &reviewIndex{}
+	x.checkpoint(at(8), at(10))
+
+	// An update that has not reached the earlier progress keeps it.
+	x.checkpoint(at(11), at(12))
+	if p := x.Partial; !p.Oldest.Equal(at(8)) || !p.Newest.Equal(at(10)) {
+		t.Errorf("partial=%+v", p)
+	}
+
+	// An update that reached the earlier progress extends it.
+	x.checkpoint(at(5), at(12))
+	if p := x.Partial; !p.Oldest.Equal(at(5)) || !p.Newest.Equal(at(12)) {
+		t.Errorf("partial=%+v", p)
+	}
+	if x.fetched(at(5)) || !x.fetched(at(6)) || !x.fetched(at(12)) ||
+		x.fetched(at(13)) {
+		t.Error("fetched")
+	}
+
+	x.finish(nil)
+	if x.Partial != nil || !x.UpdatedAt.Equal(at(12)) {
+		t.Errorf("partial=%+v updatedAt=%v", x.Partial, x.UpdatedAt)
+	}
+}
+
+func TestReviewIndexUpdatedAt(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ps, s := newTestPullRequestServer()
+	defer s.Close()
+	opts := newTestAPIOptions(t, s, tmpDir)
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact"}
+
+	if _, err := getReviewIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pull requests that were not updated since the last update are
+	// not fetched again.
+	ps.fetched = map[int]int{}
+	if _, err := getReviewIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.fetched) != 0 {
+		t.Errorf("fetched=%v, expected none", ps.fetched)
+	}
+
+	// The oldest pull request is reviewed again.
+	ps.Lock()
+	pr := ps.prs[0]
+	pr.updatedAt = ps.prs[4].updatedAt.Add(time.Hour)
+	pr.reviewers = append(pr.reviewers, "carol")
+	ps.fetched = map[int]int{}
+	ps.Unlock()
+
+	x, err := getReviewIndex(ctx, tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.fetched) != 1 || ps.fetched[pr.number] != 1 {
+		t.Errorf("fetched=%v, expected only #%d", ps.fetched, pr.number)
+	}
+	if x.UpdatedAt == nil || !x.UpdatedAt.Equal(pr.updatedAt) {
+		t.Errorf("updatedAt=%v, expected %v", x.UpdatedAt, pr.updatedAt)
+	}
+	if n := len(x.Reviews["carol"]); n != 1 {
+		t.Errorf("len(reviews[carol])=%d, expected 1", n)
+	}
+	if n := len(x.Reviews["bob"]); n != 5 {
+		t.Errorf("len(reviews[bob])=%d, expected 5", n)
+	}
+	if n := len(x.Reviews["akutz"]); n != 0 {
+		t.Errorf("len(reviews[akutz])=%d, expected 0 for the author", n)
+	}
+}
+
+func TestReviewIndexSince(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ps, s := newTestPullRequestServer()
+	defer s.Close()
+	opts := newTestAPIOptions(t, s, tmpDir)
+	ctx := context.Background()
+	tgt := target{Org: "vmware", Repo: "impact"}
+
+	// The pull requests updated before the window are not fetched.
+	since := ps.prs[2].updatedAt
+	opts.config.Since = &since
+	x, err := getReviewIndex(ctx, tgt, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for number, exp := range map[int]int{5: 1, 4: 1, 3: 1, 2: 0, 1: 0} {
+		if act := ps.fetched[number]; act != exp {
+			t.Errorf("fetched[%d]=%d, expected %d", number, act, exp)
+		}
+	}
+	if x.Since == nil || !x.Since.Equal(since) {
+		t.Errorf("since=%v, expected %v", x.Since, since)
+	}
+
+	// The index is used for a later window.
+	later := ps.prs[3].updatedAt
+	opts.config.Since = &later
+	ps.fetched = map[int]int{}
+	if x, err = getReviewIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(ps.fetched) != 0 {
+		t.Errorf("fetched=%v, expected none", ps.fetched)
+	}
+
+	// The older pull requests are fetched for an earlier window.
+	opts.config.Since = nil
+	ps.fetched = map[int]int{}
+	if x, err = getReviewIndex(ctx, tgt, opts); err != nil {
+		t.Fatal(err)
+	}
+	if ps.fetched[1] != 1 || ps.fetched[2] != 1 {
+		t.Errorf("fetched=%v, expected #1 and #2", ps.fetched)
+	}
+	if x.Since != nil {
+		t.Errorf("since=%v, expected nil", x.Since)
+	}
+	if n := len(x.Reviews["bob"]); n != 5 {
+		t.Errorf("len(reviews)=%d, expected 5", n)
+	}
+}
+
+func TestReviewIndexesGet(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ps, s := newTestPullRequestServer()
+	defer s.Close()
+	opts := newTestAPIOptions(t, s, tmpDir)
+	opts.targets = []target{{Org: "vmware", Repo: "impact"}}
+	opts.reviews = &reviewIndexes{}
+	ctx := context.Background()
+
+	if len(ps.fetched) != 0 {
+		t.Fatalf("fetched=%v before the indexes were used", ps.fetched)
+	}
+	for i := 0; i < 2; i++ {
+		indexes, err := opts.reviews.get(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x := indexes["vmware/impact"]; x == nil ||
+			len(x.Reviews["bob"]) != 5 {
+			t.Fatalf("%d: indexes=%v", i, indexes)
+		}
+	}
+	for number, n := range ps.fetched {
+		if n != 1 {
+			t.Errorf("fetched[%d]=%d, expected 1", number, n)
+		}
+	}
+
+	var nilIndexes *reviewIndexes
+	if indexes, err := nilIndexes.get(ctx, opts); indexes != nil || err != nil {
+		t.Errorf("indexes=%v err=%v, expected nil", indexes, err)
+	}
+}
+
+func TestMemberReviewReport(t *testing.T) {
+	newIndex := func() *reviewIndex {
+		return &reviewIndex{
+			Reviews:  map[string][]review{},
+			Comments: map[string][]reviewComment{},
+		}
+	}
+
+	impact, other := newIndex(), newIndex()
+	impact.addReview("Bob", review{
+		ID: 1, Repo: "vmware/impact", PullRequest: 1, State: reviewApproved})
+	impact.addReview("bob", review{
+		ID: 1, Repo: "vmware/impact", PullRequest: 1, State: reviewApproved})
+	impact.addReview("bob", review{
+		ID: 2, Repo: "vmware/impact", PullRequest: 1, State: reviewCommented})
+	impact.addReview("carol", review{
+		ID: 3, Repo: "vmware/impact", PullRequest: 2, State: reviewApproved})
+	impact.addComment("bob", reviewComment{
+		ID: 1, Repo: "vmware/impact", PullRequest: 3})
+	other.addReview("bob", review{
+		ID:          4,
+		Repo:        "vmware/other",
+		PullRequest: 1,
+		State:       reviewChangesRequested,
+	})
+	other.addComment("bob", reviewComment{
+		ID: 2, Repo: "vmware/other", PullRequest: 1})
+
+	// The member's cached reviews are not duplicated.
+	m := member{
+		Login: "Bob",
+		Reviews: []review{{
+			ID: 2, Repo: "vmware/impact", PullRequest: 1, State: reviewCommented,
+		}},
+	}
+	m.loadFromReviewIndexes(map[string]*reviewIndex{
+		"vmware/impact": impact,
+		"vmware/other":  other,
+	})
+
+	exp := reviewReport{
+		Reviews:              3,
+		Approved:             1,
+		ChangesRequested:     1,
+		Commented:            1,
+		Comments:             2,
+		PullRequestsReviewed: 3,
+	}
+	if act := m.reviewReport(); act != exp {
+		t.Errorf("exp=%+v act=%+v", exp, act)
+	}
+}
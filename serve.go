@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isReportFile returns a flag indicating whether or not the file name is
+// one of the reports written to the output directory, ex. report.html or
+// report-akutz-repos.csv.
+func isReportFile(fileName string) bool {
+	if strings.ContainsAny(fileName, `/\`) {
+		return false
+	}
+	return strings.HasPrefix(fileName, "report.") ||
+		strings.HasPrefix(fileName, "report-")
+}
+
+// reportFiles returns the names of the reports in the output directory.
+func reportFiles(outputDir string) ([]string, error) {
+	matches, err := filepath.Glob(path.Join(outputDir, "report*"))
+	if err != nil {
+		return nil, err
+	}
+	var fileNames []string
+	for _, filePath := range matches {
+		if fileName := path.Base(filePath); isReportFile(fileName) {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	sort.Strings(fileNames)
+	return fileNames, nil
+}
+
+var reportIndexTemplate = template.Must(template.New("index").Parse(
+	`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Reports</title></head>
+<body>
+<h1>Reports</h1>
+<ul>
+{{- range .}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- else}}
+<li>There are no reports in the output directory.</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// reportHandler serves the reports in the output directory. The cached
+// members and the rest of the cache are not served. The root redirects to
+// the dashboard if it exists, otherwise it lists the reports.
+func reportHandler(outputDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		fileName := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if fileName == "" {
+			fileNames, err := reportFiles(outputDir)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, f := range fileNames {
+				if f == "report.html" {
+					http.Redirect(w, r, "/report.html", http.StatusFound)
+					return
+				}
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			reportIndexTemplate.Execute(w, fileNames)
+			return
+		}
+
+		if !isReportFile(fileName) {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(path.Join(outputDir, fileName))
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, fileName, fi.ModTime(), f)
+	})
+}
+
+func newServeFlagSet(cf *cliFlags, opts *options) *flag.FlagSet {
+	fs := newFlagSet(
+		"serve", "serve [FLAGS]",
+		"Serves the reports in the output directory over HTTP. The\n"+
+			"cached members and activity are not served.")
+	addConfigFlag(fs)
+	fs.StringVar(
+		&opts.config.OutputDir, "output", opts.config.OutputDir,
+		"The output directory")
+	fs.StringVar(
+		&cf.addr, "addr", "localhost:8080",
+		"The address on which to listen")
+	return fs
+}
+
+func serveMain(args []string) int {
+	var (
+		opts options
+		cf   cliFlags
+	)
+	if err := initConfig(args, newServeFlagSet, &opts.config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeConfig
+	}
+	fs := newServeFlagSet(&cf, &opts)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		return 1
+	}
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "serving %s at http://%s\n",
+		opts.config.OutputDir, cf.addr)
+	err := http.ListenAndServe(cf.addr, reportHandler(opts.config.OutputDir))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeServe
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestReportHandler(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, fileName := range []string{
+		"report.csv",
+		"report-summary.csv",
+		"akutz.json",
+		path.Join(".cache", "repos", "vmware.json"),
+	} {
+		filePath := path.Join(tmpDir, fileName)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(
+			filePath, []byte(fileName), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := httptest.NewServer(reportHandler(tmpDir))
+	defer s.Close()
+
+	get := func(urlPath string) (int, string) {
+		rep, err := http.Get(s.URL + urlPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rep.Body.Close()
+		buf, err := ioutil.ReadAll(rep.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rep.StatusCode, string(buf)
+	}
+
+	// Without a dashboard the root lists the reports.
+	code, body := get("/")
+	if code != http.StatusOK {
+		t.Fatalf("/: %d", code)
+	}
+	if !strings.Contains(body, `href="report-summary.csv"`) ||
+		strings.Contains(body, "akutz.json") {
+		t.Fatalf("/: %s", body)
+	}
+
+	if code, body := get("/report.csv"); code != http.StatusOK ||
+		body != "report.csv" {
+		t.Fatalf("/report.csv: %d %s", code, body)
+	}
+
+	// The cache is not served.
+	for _, urlPath := range []string{
+		"/akutz.json",
+		"/.cache/repos/vmware.json",
+		"/report.html",
+	} {
+		if code, _ := get(urlPath); code != http.StatusNotFound {
+			t.Errorf("%s: %d", urlPath, code)
+		}
+	}
+
+	// The root redirects to the dashboard if it exists.
+	if err := ioutil.WriteFile(
+		path.Join(tmpDir, "report.html"), []byte("dashboard"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := get("/"); code != http.StatusOK || body != "dashboard" {
+		t.Fatalf("/: %d %s", code, body)
+	}
+}
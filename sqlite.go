@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sqliteSchema is the schema of the SQLite export. The commits and issues
+// shared by members are related to them with separate tables.
+const sqliteSchema = `
+CREATE TABLE members (
+	login      TEXT PRIMARY KEY,
+	name       TEXT,
+	ldap_login TEXT
+);
+CREATE TABLE member_emails (
+	login TEXT NOT NULL REFERENCES members (login),
+	email TEXT NOT NULL,
+	PRIMARY KEY (login, email)
+);
+CREATE TABLE member_employment (
+	login      TEXT NOT NULL REFERENCES members (login),
+	from_date  TEXT,
+	until_date TEXT
+);
+CREATE TABLE changesets (
+	repo            TEXT NOT NULL,
+	sha             TEXT NOT NULL,
+	short_sha       TEXT,
+	subject         TEXT,
+	author_name     TEXT,
+	author_email    TEXT,
+	author_date     TEXT,
+	committer_name  TEXT,
+	committer_email TEXT,
+	PRIMARY KEY (repo, sha)
+);
+CREATE TABLE changeset_members (
+	repo        TEXT NOT NULL,
+	sha         TEXT NOT NULL,
+	login       TEXT NOT NULL REFERENCES members (login),
+	co_authored INTEGER NOT NULL,
+	PRIMARY KEY (repo, sha, login),
+	FOREIGN KEY (repo, sha) REFERENCES changesets (repo, sha)
+);
+CREATE TABLE changeset_co_authors (
+	repo  TEXT NOT NULL,
+	sha   TEXT NOT NULL,
+	name  TEXT,
+	email TEXT,
+	FOREIGN KEY (repo, sha) REFERENCES changesets (repo, sha)
+);
+CREATE TABLE changeset_entries (
+	repo      TEXT NOT NULL,
+	sha       TEXT NOT NULL,
+	path      TEXT NOT NULL,
+	additions INTEGER NOT NULL,
+	deletions INTEGER NOT NULL,
+	binary    INTEGER NOT NULL,
+	excluded  INTEGER NOT NULL,
+	FOREIGN KEY (repo, sha) REFERENCES changesets (repo, sha)
+);
+CREATE TABLE issues (
+	repo            TEXT NOT NULL,
+	number          INTEGER NOT NULL,
+	url             TEXT,
+	title           TEXT,
+	state           TEXT,
+	is_pull_request INTEGER NOT NULL,
+	created_at      TEXT,
+	closed_at       TEXT,
+	merged_at       TEXT,
+	PRIMARY KEY (repo, number)
+);
+CREATE TABLE member_issues (
+	login     TEXT NOT NULL REFERENCES members (login),
+	repo      TEXT NOT NULL,
+	number    INTEGER NOT NULL,
+	created   INTEGER NOT NULL,
+	assigned  INTEGER NOT NULL,
+	mentioned INTEGER NOT NULL,
+	PRIMARY KEY (login, repo, number),
+	FOREIGN KEY (repo, number) REFERENCES issues (repo, number)
+);
+CREATE TABLE reviews (
+	id           INTEGER PRIMARY KEY,
+	login        TEXT NOT NULL REFERENCES members (login),
+	repo         TEXT NOT NULL,
+	pull_request INTEGER NOT NULL,
+	state        TEXT,
+	submitted_at TEXT
+);
+CREATE TABLE review_comments (
+	id           INTEGER PRIMARY KEY,
+	login        TEXT NOT NULL REFERENCES members (login),
+	repo         TEXT NOT NULL,
+	pull_request INTEGER NOT NULL,
+	path         TEXT,
+	created_at   TEXT
+);
+`
+
+// sqliteIndexes are the indexes of the export besides those of the
+// primary keys.
+const sqliteIndexes = `
+CREATE INDEX changesets_author_date ON changesets (author_date);
+CREATE INDEX changeset_members_login ON changeset_members (login);
+CREATE INDEX changeset_entries_commit ON changeset_entries (repo, sha);
+CREATE INDEX changeset_co_authors_commit ON changeset_co_authors (repo, sha);
+CREATE INDEX issues_created_at ON issues (created_at);
+CREATE INDEX member_issues_issue ON member_issues (repo, number);
+CREATE INDEX reviews_login ON reviews (login);
+CREATE INDEX reviews_pull_request ON reviews (repo, pull_request);
+CREATE INDEX review_comments_login ON review_comments (login);
+`
+
+// sqliteExport writes the activity of the members to a SQLite database.
+// The database is written when the export is closed.
+type sqliteExport struct {
+	filePath string
+	db       *sqliteDB
+
+	// changesets and issues are the keys of the inserted commits and
+	// issues, which may be shared by members.
+	changesets map[string]struct{}
+	issues     map[string]struct{}
+}
+
+// newSQLiteExport returns an export to the database file, which is
+// replaced when the export is closed.
+func newSQLiteExport(filePath string) (*sqliteExport, error) {
+	db, err := newSQLiteDB(sqliteSchema + sqliteIndexes)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteExport{
+		filePath:   filePath,
+		db:         db,
+		changesets: map[string]struct{}{},
+		issues:     map[string]struct{}{},
+	}, nil
+}
+
+// sqlValue converts a value to the type that is stored in the database.
+// Times are stored as RFC 3339 text in UTC so that they sort and compare
+// as text.
+func sqlValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case time.Time:
+		return tv.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if tv == nil {
+			return nil
+		}
+		return sqlValue(*tv)
+	case bool:
+		if tv {
+			return int64(1)
+		}
+		return int64(0)
+	case int:
+		return int64(tv)
+	}
+	return v
+}
+
+func (e *sqliteExport) insert(table string, values ...interface{}) error {
+	return e.insertWith(false, table, values...)
+}
+
+func (e *sqliteExport) insertOrIgnore(
+	table string, values ...interface{}) error {
+	return e.insertWith(true, table, values...)
+}
+
+func (e *sqliteExport) insertWith(
+	ignore bool, table string, values ...interface{}) error {
+
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = sqlValue(v)
+	}
+	if err := e.db.insert(table, ignore, args...); err != nil {
+		return fmt.Errorf("error inserting into %s: %v", table, err)
+	}
+	return nil
+}
+
+// add inserts the member and all of their activity.
+func (e *sqliteExport) add(m member, opts options) error {
+	if err := e.insert(
+		"members", m.Login, m.Name, m.LDAPLogin); err != nil {
+		return err
+	}
+	for _, email := range m.Emails {
+		if err := e.insertOrIgnore(
+			"member_emails", m.Login, email); err != nil {
+			return err
+		}
+	}
+	for _, dr := range m.Employed {
+		if err := e.insert(
+			"member_employment", m.Login, dr.From, dr.Until); err != nil {
+			return err
+		}
+	}
+
+	for _, c := range m.Commits {
+		if err := e.addChangeset(c, opts); err != nil {
+			return err
+		}
+		if err := e.insertOrIgnore("changeset_members",
+			c.Repo, c.Long, m.Login, c.CoAuthored); err != nil {
+			return err
+		}
+	}
+
+	for _, is := range m.Issues {
+		key := fmt.Sprintf("%s#%d", is.Repo, is.Number)
+		if _, ok := e.issues[key]; !ok {
+			e.issues[key] = struct{}{}
+			if err := e.insert("issues",
+				is.Repo, is.Number, is.URL, is.Title, is.State,
+				is.IsPullRequest, is.CreatedAt, is.ClosedAt,
+				is.MergedAt); err != nil {
+				return err
+			}
+		}
+		if err := e.insert("member_issues",
+			m.Login, is.Repo, is.Number,
+			is.Created, is.Assigned, is.Mentioned); err != nil {
+			return err
+		}
+	}
+
+	for _, rv := range m.Reviews {
+		if err := e.insertOrIgnore("reviews",
+			rv.ID, m.Login, rv.Repo, rv.PullRequest, rv.State,
+			rv.SubmittedAt); err != nil {
+			return err
+		}
+	}
+	for _, c := range m.ReviewComments {
+		if err := e.insertOrIgnore("review_comments",
+			c.ID, m.Login, c.Repo, c.PullRequest, c.Path,
+			c.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addChangeset inserts the commit, its co-authors and its changes unless
+// the commit was inserted for another member.
+func (e *sqliteExport) addChangeset(c changeset, opts options) error {
+	key := changesetKey(c.Repo, c.Long)
+	if _, ok := e.changesets[key]; ok {
+		return nil
+	}
+	e.changesets[key] = struct{}{}
+	if err := e.insert("changesets",
+		c.Repo, c.Long, c.Short, c.Subject,
+		c.AuthorName, c.AuthorEmail, c.AuthorDate,
+		c.CommitterName, c.CommitterEmail); err != nil {
+		return err
+	}
+	for _, ca := range c.CoAuthors {
+		if err := e.insert("changeset_co_authors",
+			c.Repo, c.Long, ca.Name, ca.Email); err != nil {
+			return err
+		}
+	}
+	for _, ce := range c.Changes {
+		if err := e.insert("changeset_entries",
+			c.Repo, c.Long, ce.Path, ce.Add, ce.Del, ce.Binary,
+			opts.exclusions.excluded(c.Repo, ce)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close writes the database.
+func (e *sqliteExport) close() error {
+	return e.db.writeFile(e.filePath)
+}
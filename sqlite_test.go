@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqliteQuery returns the result of the query with the sqlite3 command.
+func sqliteQuery(t *testing.T, dbFilePath, query string) string {
+	out, err := exec.Command("sqlite3", dbFilePath, query).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v: %s", query, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestSQLiteExport(t *testing.T) {
+	if exec.Command("sqlite3", "-version").Run() != nil {
+		t.Skip("sqlite3 not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	if opts.exclusions, err = newExclusions(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	authorDate := time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+	paired := changeset{
+		Repo:        "vmware/impact",
+		Long:        "abc123",
+		Subject:     "Don't panic",
+		AuthorName:  "Andrew Kutz",
+		AuthorEmail: "akutz@vmware.com",
+		AuthorDate:  authorDate,
+		CoAuthors:   []coAuthor{{Name: "Bob", Email: "bob@vmware.com"}},
+		Changes: []changesetEntry{
+			{Add: 3, Del: 1, Path: "main.go"},
+			{Add: 10, Path: "vendor/lib/lib.go"},
+		},
+	}
+	coAuthored := paired
+	coAuthored.CoAuthored = true
+
+	dbFilePath := path.Join(tmpDir, "report.db")
+	e, err := newSQLiteExport(dbFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.add(member{
+		Login:   "akutz",
+		Emails:  []string{"akutz@vmware.com"},
+		Commits: []changeset{paired},
+		Issues: []issue{{
+			Repo: "vmware/impact", Number: 1, Created: true,
+			IsPullRequest: true, MergedAt: &authorDate,
+		}},
+		Reviews: []review{{ID: 7, Repo: "vmware/impact", PullRequest: 2}},
+	}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.add(member{
+		Login:   "bob",
+		Commits: []changeset{coAuthored},
+		Issues: []issue{{
+			Repo: "vmware/impact", Number: 1, Mentioned: true,
+			IsPullRequest: true, MergedAt: &authorDate,
+		}},
+	}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// A member is only inserted once.
+	if err := e.add(member{Login: "bob"}, opts); err == nil {
+		t.Error("exp error for duplicate member")
+	}
+
+	if err := e.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		query string
+		exp   string
+	}{
+		{"PRAGMA integrity_check", "ok"},
+		{"SELECT count(*) FROM members", "2"},
+		{"SELECT count(*) FROM changesets", "1"},
+		{"SELECT subject FROM changesets", "Don't panic"},
+		{"SELECT group_concat(login || ':' || co_authored) FROM " +
+			"(SELECT * FROM changeset_members ORDER BY login)",
+			"akutz:0,bob:1"},
+		{"SELECT sum(additions) FROM changeset_entries WHERE NOT excluded", "3"},
+		{"SELECT count(*) FROM issues WHERE merged_at IS NOT NULL", "1"},
+		{"SELECT count(*) FROM member_issues", "2"},
+		{"SELECT login FROM reviews WHERE id = 7", "akutz"},
+		{"SELECT merged_at FROM issues", "2018-07-01T00:00:00Z"},
+		{"SELECT count(*) FROM sqlite_master " +
+			"WHERE type = 'index' AND sql IS NOT NULL", "9"},
+	}
+	for _, tc := range testCases {
+		if s := sqliteQuery(t, dbFilePath, tc.query); s != tc.exp {
+			t.Errorf("%s=%s, expected %s", tc.query, s, tc.exp)
+		}
+	}
+}
+
+func TestSQLiteDBLarge(t *testing.T) {
+	if exec.Command("sqlite3", "-version").Run() != nil {
+		t.Skip("sqlite3 not found")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	db, err := newSQLiteDB(`
+CREATE TABLE entries (
+	id    INTEGER PRIMARY KEY,
+	path  TEXT NOT NULL,
+	body  TEXT,
+	size  INTEGER
+);
+CREATE TABLE paths (
+	path TEXT NOT NULL,
+	n    INTEGER NOT NULL,
+	PRIMARY KEY (path, n)
+);
+CREATE INDEX entries_body ON entries (body);
+CREATE INDEX entries_size ON entries (size);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rows span several levels of interior pages, and the long values
+	// span overflow pages.
+	const n = 20000
+	for i := n; i > 0; i-- {
+		p := fmt.Sprintf("path/%06d", i)
+		body := fmt.Sprintf("%0200d", i)
+		if i%1000 == 0 {
+			body = strings.Repeat(body, 100)
+		}
+		var size interface{}
+		if i%3 != 0 {
+			size = int64(i*i*1000) - 1<<40
+		}
+		if err := db.insert("entries", false,
+			int64(i), p, body, size); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.insert("paths", false,
+			strings.Repeat(p, 1+i%100), int64(i%7)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.insert("entries", false,
+		int64(1), "path/x", nil, nil); err == nil {
+		t.Error("exp error for duplicate id")
+	}
+	if err := db.insert("paths", false,
+		"path/000700", int64(0)); err == nil {
+		t.Error("exp error for duplicate primary key")
+	}
+	if err := db.insert("paths", true,
+		"path/000700", int64(0)); err != nil {
+		t.Error(err)
+	}
+
+	dbFilePath := path.Join(tmpDir, "large.db")
+	if err := db.writeFile(dbFilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		exp   string
+	}{
+		{"PRAGMA integrity_check", "ok"},
+		{"SELECT count(*) FROM entries", fmt.Sprint(n)},
+		{"SELECT path FROM entries WHERE id = 12345", "path/012345"},
+		{"SELECT count(*) FROM paths", fmt.Sprint(n)},
+		{"SELECT n FROM paths WHERE path = 'path/000700'", "0"},
+		{"SELECT length(body) FROM entries WHERE id = 7000", "20000"},
+		{"SELECT id FROM entries WHERE body = printf('%0200d', 77)", "77"},
+		{"SELECT count(*) FROM entries WHERE size IS NULL", fmt.Sprint(n / 3)},
+		{"SELECT min(size) FROM entries", fmt.Sprint(int64(1000) - 1<<40)},
+	} {
+		if s := sqliteQuery(t, dbFilePath, tc.query); s != tc.exp {
+			t.Errorf("%s=%s, expected %s", tc.query, s, tc.exp)
+		}
+	}
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	for _, tc := range []struct {
+		values []interface{}
+		exp    []byte
+	}{
+		{[]interface{}{nil, int64(0), int64(1)}, []byte{4, 0, 8, 9}},
+		{[]interface{}{int64(-1), "ab"}, []byte{3, 1, 17, 0xff, 'a', 'b'}},
+		{[]interface{}{int64(300)}, []byte{2, 2, 0x01, 0x2c}},
+		{[]interface{}{int64(1) << 40}, []byte{2, 5, 1, 0, 0, 0, 0, 0}},
+		{
+			[]interface{}{strings.Repeat("a", 64)},
+			append([]byte{3, 0x81, 0x0d}, strings.Repeat("a", 64)...),
+		},
+	} {
+		if act := sqliteRecord(tc.values); !bytes.Equal(act, tc.exp) {
+			t.Errorf("%v: exp=%x act=%x", tc.values, tc.exp, act)
+		}
+	}
+
+	for _, tc := range []struct {
+		v   uint64
+		exp []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x00}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 63, []byte{0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0}},
+	} {
+		if act := sqliteVarint(nil, tc.v); !bytes.Equal(act, tc.exp) {
+			t.Errorf("%d: exp=%x act=%x", tc.v, tc.exp, act)
+		}
+	}
+}
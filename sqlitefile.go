@@ -0,0 +1,749 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// sqliteDB is a SQLite database that is built in memory and written to
+// disk in the SQLite file format, https://www.sqlite.org/fileformat.html,
+// so the export needs neither cgo nor a SQLite driver.
+type sqliteDB struct {
+	tables  []*sqliteTable
+	byName  map[string]*sqliteTable
+	indexes []*sqliteIndex
+}
+
+// sqliteTable is a rowid table and its rows.
+type sqliteTable struct {
+	name    string
+	sql     string
+	columns []string
+
+	// alias is the column of the INTEGER PRIMARY KEY, which is the rowid,
+	// or -1 if there is no such column.
+	alias int
+
+	// primaryKey is the index of any other PRIMARY KEY.
+	primaryKey *sqliteIndex
+	keys       map[string]struct{}
+
+	rows   [][]interface{}
+	rowids []int64
+}
+
+// sqliteIndex is an index of a table. The sql of the index of a PRIMARY
+// KEY is empty.
+type sqliteIndex struct {
+	name    string
+	sql     string
+	table   *sqliteTable
+	columns []int
+}
+
+// newSQLiteDB returns an empty database with the schema, which has CREATE
+// TABLE statements with one column or constraint per line and CREATE
+// INDEX statements.
+func newSQLiteDB(schema string) (*sqliteDB, error) {
+	db := &sqliteDB{byName: map[string]*sqliteTable{}}
+	for _, stmt := range strings.Split(schema, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		fields := strings.Fields(stmt)
+		if len(fields) < 3 || fields[0] != "CREATE" {
+			return nil, fmt.Errorf("invalid statement: %s", stmt)
+		}
+		var err error
+		switch fields[1] {
+		case "TABLE":
+			err = db.createTable(fields[2], stmt)
+		case "INDEX":
+			err = db.createIndex(fields, stmt)
+		default:
+			err = fmt.Errorf("invalid statement: %s", stmt)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func (db *sqliteDB) createTable(name, stmt string) error {
+	i, j := strings.Index(stmt, "("), strings.LastIndex(stmt, ")")
+	if i < 0 || j < i {
+		return fmt.Errorf("invalid statement: %s", stmt)
+	}
+	t := &sqliteTable{name: name, sql: stmt, alias: -1}
+	var primaryKey []string
+	for _, def := range strings.Split(stmt[i+1:j], "\n") {
+		def = strings.TrimSuffix(strings.TrimSpace(def), ",")
+		switch {
+		case def == "", strings.HasPrefix(def, "FOREIGN KEY"):
+		case strings.HasPrefix(def, "PRIMARY KEY"):
+			primaryKey = sqliteColumnNames(def)
+		default:
+			fields := strings.Fields(def)
+			if strings.Contains(def, "PRIMARY KEY") {
+				if len(fields) > 1 && fields[1] == "INTEGER" {
+					t.alias = len(t.columns)
+				} else {
+					primaryKey = fields[:1]
+				}
+			}
+			t.columns = append(t.columns, fields[0])
+		}
+	}
+	if primaryKey != nil {
+		x, err := t.index(
+			fmt.Sprintf("sqlite_autoindex_%s_1", name), "", primaryKey)
+		if err != nil {
+			return err
+		}
+		t.primaryKey, t.keys = x, map[string]struct{}{}
+	}
+	db.tables = append(db.tables, t)
+	db.byName[name] = t
+	return nil
+}
+
+// createIndex creates the index in "CREATE INDEX NAME ON TABLE (COLUMNS)".
+func (db *sqliteDB) createIndex(fields []string, stmt string) error {
+	if len(fields) < 5 || fields[3] != "ON" {
+		return fmt.Errorf("invalid statement: %s", stmt)
+	}
+	t, ok := db.byName[fields[4]]
+	if !ok {
+		return fmt.Errorf("no such table: %s", fields[4])
+	}
+	x, err := t.index(fields[2], stmt, sqliteColumnNames(stmt))
+	if err != nil {
+		return err
+	}
+	db.indexes = append(db.indexes, x)
+	return nil
+}
+
+// sqliteColumnNames returns the names in the parentheses of the text.
+func sqliteColumnNames(s string) []string {
+	i, j := strings.Index(s, "("), strings.LastIndex(s, ")")
+	if i < 0 || j < i {
+		return nil
+	}
+	names := strings.Split(s[i+1:j], ",")
+	for k := range names {
+		names[k] = strings.TrimSpace(names[k])
+	}
+	return names
+}
+
+func (t *sqliteTable) index(
+	name, sql string, columns []string) (*sqliteIndex, error) {
+
+	x := &sqliteIndex{name: name, sql: sql, table: t}
+	for _, c := range columns {
+		i := 0
+		for i < len(t.columns) && t.columns[i] != c {
+			i++
+		}
+		if i == len(t.columns) {
+			return nil, fmt.Errorf("no such column: %s.%s", t.name, c)
+		}
+		x.columns = append(x.columns, i)
+	}
+	return x, nil
+}
+
+// insert inserts a row of nil, int64 and string values. A row whose
+// primary key is not unique is an error unless ignore is true, in which
+// case the row is not inserted.
+func (db *sqliteDB) insert(
+	table string, ignore bool, values ...interface{}) error {
+
+	t, ok := db.byName[table]
+	if !ok {
+		return fmt.Errorf("no such table: %s", table)
+	}
+	if len(values) != len(t.columns) {
+		return fmt.Errorf("%s has %d columns but %d values were supplied",
+			table, len(t.columns), len(values))
+	}
+	for _, v := range values {
+		switch v.(type) {
+		case nil, int64, string:
+		default:
+			return fmt.Errorf("invalid %s value: %T", table, v)
+		}
+	}
+
+	rowid := int64(len(t.rows) + 1)
+	key := ""
+	if t.alias >= 0 {
+		id, ok := values[t.alias].(int64)
+		if !ok {
+			return fmt.Errorf("invalid %s.%s: %v",
+				table, t.columns[t.alias], values[t.alias])
+		}
+		rowid = id
+		key = fmt.Sprint(id)
+	} else if t.primaryKey != nil {
+		for _, i := range t.primaryKey.columns {
+			key += fmt.Sprintf("%T:%v\x00", values[i], values[i])
+		}
+	}
+	if t.alias >= 0 || t.primaryKey != nil {
+		if t.keys == nil {
+			t.keys = map[string]struct{}{}
+		}
+		if _, ok := t.keys[key]; ok {
+			if ignore {
+				return nil
+			}
+			return fmt.Errorf("UNIQUE constraint failed: %s", table)
+		}
+		t.keys[key] = struct{}{}
+	}
+	t.rows = append(t.rows, values)
+	t.rowids = append(t.rowids, rowid)
+	return nil
+}
+
+// writeFile writes the database to the file, which is replaced.
+func (db *sqliteDB) writeFile(filePath string) error {
+	f, err := ioutil.TempFile(path.Dir(filePath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := db.write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filePath)
+}
+
+func (db *sqliteDB) write(f *os.File) error {
+	// Page 1 is the root of the schema table, which is written last.
+	w := &sqliteFile{f: f, pages: 1}
+
+	var schema [][]interface{}
+	addIndex := func(x *sqliteIndex) error {
+		root, err := w.writeIndex(x)
+		if err != nil {
+			return err
+		}
+		var sql interface{}
+		if x.sql != "" {
+			sql = x.sql
+		}
+		schema = append(schema, []interface{}{
+			"index", x.name, x.table.name, int64(root), sql})
+		return nil
+	}
+	for _, t := range db.tables {
+		root, err := w.writeTable(t)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, []interface{}{
+			"table", t.name, t.name, int64(root), t.sql})
+		if t.primaryKey != nil {
+			if err := addIndex(t.primaryKey); err != nil {
+				return err
+			}
+		}
+	}
+	for _, x := range db.indexes {
+		if err := addIndex(x); err != nil {
+			return err
+		}
+	}
+
+	b := &sqliteBTree{w: w, root: 1}
+	for i, row := range schema {
+		if err := b.addRow(int64(i+1), sqliteRecord(row)); err != nil {
+			return err
+		}
+	}
+	if _, err := b.finish(); err != nil {
+		return err
+	}
+	_, err := f.WriteAt(w.header(), 0)
+	return err
+}
+
+const (
+	sqlitePageSize = 4096
+
+	// sqliteVersion is the SQLITE_VERSION_NUMBER of the SQLite release
+	// whose file format is written.
+	sqliteVersion = 3008000
+
+	sqliteIndexInterior = 0x02
+	sqliteTableInterior = 0x05
+	sqliteIndexLeaf     = 0x0a
+	sqliteTableLeaf     = 0x0d
+)
+
+// sqliteFile allocates and writes the pages of a database file.
+type sqliteFile struct {
+	f     *os.File
+	pages uint32
+}
+
+func (w *sqliteFile) allocate(n int) uint32 {
+	first := w.pages + 1
+	w.pages += uint32(n)
+	return first
+}
+
+func (w *sqliteFile) writePage(pgno uint32, page []byte) error {
+	_, err := w.f.WriteAt(page, int64(pgno-1)*sqlitePageSize)
+	return err
+}
+
+// header returns the database header at the start of page 1.
+func (w *sqliteFile) header() []byte {
+	h := make([]byte, 100)
+	copy(h, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1                         // rollback journal
+	h[21], h[22], h[23] = 64, 32, 32            // payload fractions
+	binary.BigEndian.PutUint32(h[24:], 1)       // file change counter
+	binary.BigEndian.PutUint32(h[28:], w.pages) // database size in pages
+	binary.BigEndian.PutUint32(h[40:], 1)       // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4)       // schema format number
+	binary.BigEndian.PutUint32(h[56:], 1)       // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1)       // version-valid-for
+	binary.BigEndian.PutUint32(h[96:], sqliteVersion)
+	return h
+}
+
+// writeTable writes the rows of the table in rowid order and returns the
+// root page.
+func (w *sqliteFile) writeTable(t *sqliteTable) (uint32, error) {
+	order := make([]int, len(t.rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return t.rowids[order[i]] < t.rowids[order[j]]
+	})
+	b := &sqliteBTree{w: w}
+	for _, i := range order {
+		row := t.rows[i]
+		if t.alias >= 0 {
+			row = append([]interface{}(nil), row...)
+			row[t.alias] = nil
+		}
+		if err := b.addRow(t.rowids[i], sqliteRecord(row)); err != nil {
+			return 0, err
+		}
+	}
+	return b.finish()
+}
+
+// writeIndex writes the entries of the index, which are the indexed
+// values followed by the rowid, in order and returns the root page.
+func (w *sqliteFile) writeIndex(x *sqliteIndex) (uint32, error) {
+	t := x.table
+	entries := make([][]interface{}, len(t.rows))
+	for i, row := range t.rows {
+		e := make([]interface{}, 0, len(x.columns)+1)
+		for _, c := range x.columns {
+			if c == t.alias {
+				e = append(e, t.rowids[i])
+			} else {
+				e = append(e, row[c])
+			}
+		}
+		entries[i] = append(e, t.rowids[i])
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return compareSQLiteValues(entries[i], entries[j]) < 0
+	})
+	b := &sqliteBTree{w: w, index: true}
+	for _, e := range entries {
+		if err := b.addEntry(sqliteRecord(e)); err != nil {
+			return 0, err
+		}
+	}
+	return b.finish()
+}
+
+// sqliteBTree writes a b-tree from its cells in key order. The leaves are
+// written as they fill, and the interior pages once all of the leaves are
+// written.
+type sqliteBTree struct {
+	w     *sqliteFile
+	index bool
+
+	// root is the page of the root, or zero to allocate it.
+	root uint32
+
+	cells [][]byte
+	used  int
+
+	// children are the written pages of the level and keys are the cells
+	// that separate them. A key of a table is the largest rowid of the
+	// child before it and a key of an index is an entry.
+	children []uint32
+	keys     [][]byte
+
+	// lastRowid is the rowid of the last row of a table.
+	lastRowid int64
+
+	// next is the entry of an index that did not fit in the leaf, which
+	// separates the leaf from the next one.
+	next []byte
+}
+
+// headerOffset returns the offset of the page header, which follows the
+// database header on page 1.
+func (b *sqliteBTree) headerOffset() int {
+	if b.root == 1 {
+		return 100
+	}
+	return 0
+}
+
+func (b *sqliteBTree) fits(headerSize, cells, used, size int) bool {
+	return b.headerOffset()+headerSize+2*(cells+1)+used+size <= sqlitePageSize
+}
+
+func (b *sqliteBTree) addRow(rowid int64, record []byte) error {
+	cell := sqliteVarint(nil, uint64(len(record)))
+	cell = sqliteVarint(cell, uint64(rowid))
+	cell, err := b.w.payloadCell(cell, record, false)
+	if err != nil {
+		return err
+	}
+	if !b.fits(8, len(b.cells), b.used, len(cell)) {
+		if err := b.writeLeaf(); err != nil {
+			return err
+		}
+		b.keys = append(b.keys, sqliteVarint(nil, uint64(b.lastRowid)))
+	}
+	b.lastRowid = rowid
+	return b.addCell(cell)
+}
+
+func (b *sqliteBTree) addEntry(record []byte) error {
+	cell, err := b.w.payloadCell(
+		sqliteVarint(nil, uint64(len(record))), record, true)
+	if err != nil {
+		return err
+	}
+	if b.next != nil {
+		if err := b.writeLeaf(); err != nil {
+			return err
+		}
+		b.keys = append(b.keys, b.next)
+		b.next = nil
+		return b.addCell(cell)
+	}
+	if !b.fits(8, len(b.cells), b.used, len(cell)) {
+		b.next = cell
+		return nil
+	}
+	return b.addCell(cell)
+}
+
+func (b *sqliteBTree) addCell(cell []byte) error {
+	if !b.fits(8, len(b.cells), b.used, len(cell)) {
+		return fmt.Errorf("cell too large: %d bytes", len(cell))
+	}
+	b.cells = append(b.cells, cell)
+	b.used += len(cell)
+	return nil
+}
+
+func (b *sqliteBTree) leafKind() byte {
+	if b.index {
+		return sqliteIndexLeaf
+	}
+	return sqliteTableLeaf
+}
+
+func (b *sqliteBTree) writeLeaf() error {
+	pgno := b.w.allocate(1)
+	if err := b.w.writePage(
+		pgno, sqlitePage(b.leafKind(), 0, b.cells, 0)); err != nil {
+		return err
+	}
+	b.children = append(b.children, pgno)
+	b.cells, b.used = nil, 0
+	return nil
+}
+
+// finish writes the rest of the tree and returns its root page.
+func (b *sqliteBTree) finish() (uint32, error) {
+	// The last entry of an index does not separate two leaves, so the one
+	// before it does.
+	if b.next != nil {
+		last := b.cells[len(b.cells)-1]
+		b.cells = b.cells[:len(b.cells)-1]
+		b.used -= len(last)
+		if err := b.writeLeaf(); err != nil {
+			return 0, err
+		}
+		b.keys = append(b.keys, last)
+		b.cells, b.used = [][]byte{b.next}, len(b.next)
+		b.next = nil
+	}
+	if len(b.children) == 0 {
+		return b.writeRoot(b.leafKind(), b.cells, 0)
+	}
+	if err := b.writeLeaf(); err != nil {
+		return 0, err
+	}
+
+	kind := byte(sqliteTableInterior)
+	if b.index {
+		kind = sqliteIndexInterior
+	}
+	children, keys := b.children, b.keys
+	for {
+		type page struct {
+			cells [][]byte
+			used  int
+			right uint32
+		}
+		var (
+			pages []page
+			up    [][]byte
+			cur   page
+		)
+		for i, child := range children {
+			if i == len(children)-1 {
+				cur.right = child
+				break
+			}
+			cell := make([]byte, 4, 4+len(keys[i]))
+			binary.BigEndian.PutUint32(cell, child)
+			cell = append(cell, keys[i]...)
+			if len(cur.cells) > 0 &&
+				!b.fits(12, len(cur.cells), cur.used, len(cell)) {
+				cur.right = child
+				pages = append(pages, cur)
+				up = append(up, keys[i])
+				cur = page{}
+				continue
+			}
+			cur.cells = append(cur.cells, cell)
+			cur.used += len(cell)
+		}
+
+		if len(pages) == 0 {
+			return b.writeRoot(kind, cur.cells, cur.right)
+		}
+
+		// A page other than the root has at least one cell, so the last
+		// cell of the previous page moves to an empty last page.
+		if len(cur.cells) == 0 {
+			prev := &pages[len(pages)-1]
+			last := prev.cells[len(prev.cells)-1]
+			prev.cells = prev.cells[:len(prev.cells)-1]
+			cell := make([]byte, 4, 4+len(up[len(up)-1]))
+			binary.BigEndian.PutUint32(cell, prev.right)
+			cur.cells = [][]byte{append(cell, up[len(up)-1]...)}
+			prev.right = binary.BigEndian.Uint32(last)
+			up[len(up)-1] = last[4:]
+		}
+		pages = append(pages, cur)
+
+		children = make([]uint32, len(pages))
+		for i, p := range pages {
+			children[i] = b.w.allocate(1)
+			if err := b.w.writePage(
+				children[i], sqlitePage(kind, 0, p.cells, p.right)); err != nil {
+				return 0, err
+			}
+		}
+		keys = up
+	}
+}
+
+func (b *sqliteBTree) writeRoot(
+	kind byte, cells [][]byte, right uint32) (uint32, error) {
+
+	pgno := b.root
+	if pgno == 0 {
+		pgno = b.w.allocate(1)
+	}
+	page := sqlitePage(kind, b.headerOffset(), cells, right)
+	return pgno, b.w.writePage(pgno, page)
+}
+
+// sqlitePage returns a b-tree page with the cells. The right-most child
+// is only written to interior pages.
+func sqlitePage(kind byte, offset int, cells [][]byte, right uint32) []byte {
+	page := make([]byte, sqlitePageSize)
+	headerSize := 8
+	if kind == sqliteTableInterior || kind == sqliteIndexInterior {
+		headerSize = 12
+		binary.BigEndian.PutUint32(page[offset+8:], right)
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+	end := sqlitePageSize
+	for i, c := range cells {
+		end -= len(c)
+		copy(page[end:], c)
+		binary.BigEndian.PutUint16(
+			page[offset+headerSize+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(end))
+	return page
+}
+
+// payloadCell appends the payload to the cell. The part of the payload
+// that does not fit in the page is written to overflow pages, and the
+// cell ends with the first of them.
+func (w *sqliteFile) payloadCell(
+	cell, payload []byte, index bool) ([]byte, error) {
+
+	const u = sqlitePageSize
+	maxLocal := u - 35
+	if index {
+		maxLocal = (u-12)*64/255 - 23
+	}
+	minLocal := (u-12)*32/255 - 23
+	if len(payload) <= maxLocal {
+		return append(cell, payload...), nil
+	}
+	local := minLocal + (len(payload)-minLocal)%(u-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	rest := payload[local:]
+	n := (len(rest) + u - 5) / (u - 4)
+	first := w.allocate(n)
+	for i := 0; i < n; i++ {
+		page := make([]byte, u)
+		if i < n-1 {
+			binary.BigEndian.PutUint32(page, first+uint32(i)+1)
+		}
+		rest = rest[copy(page[4:], rest):]
+		if err := w.writePage(first+uint32(i), page); err != nil {
+			return nil, err
+		}
+	}
+	cell = append(cell, payload[:local]...)
+	var ptr [4]byte
+	binary.BigEndian.PutUint32(ptr[:], first)
+	return append(cell, ptr[:]...), nil
+}
+
+// sqliteVarint appends the variable-length integer to the buffer.
+func sqliteVarint(buf []byte, v uint64) []byte {
+	if v >= 1<<56 {
+		var b [9]byte
+		b[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(buf, b[:]...)
+	}
+	var b [8]byte
+	n := 0
+	for {
+		b[n] = byte(v & 0x7f)
+		n++
+		if v >>= 7; v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i > 0; i-- {
+		buf = append(buf, b[i]|0x80)
+	}
+	return append(buf, b[0])
+}
+
+// sqliteRecord returns the values in the record format.
+func sqliteRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch tv := v.(type) {
+		case nil:
+			types = append(types, 0)
+		case int64:
+			switch {
+			case tv == 0:
+				types = append(types, 8)
+			case tv == 1:
+				types = append(types, 9)
+			default:
+				serialType, size := 6, 8
+				for i, s := range []int{1, 2, 3, 4, 6} {
+					if tv >= -1<<uint(8*s-1) && tv < 1<<uint(8*s-1) {
+						serialType, size = i+1, s
+						break
+					}
+				}
+				types = append(types, byte(serialType))
+				for i := size - 1; i >= 0; i-- {
+					body = append(body, byte(tv>>uint(8*i)))
+				}
+			}
+		case string:
+			types = sqliteVarint(types, uint64(13+2*len(tv)))
+			body = append(body, tv...)
+		}
+	}
+
+	// The size of the header includes the varint of the size.
+	n := len(types) + 1
+	for len(sqliteVarint(nil, uint64(n))) != n-len(types) {
+		n++
+	}
+	record := sqliteVarint(nil, uint64(n))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// compareSQLiteValues compares the entries of an index. NULL sorts before
+// integers, which sort before text, and text is compared byte by byte.
+func compareSQLiteValues(a, b []interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case int64:
+			return 1
+		}
+		return 2
+	}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if ra, rb := rank(a[i]), rank(b[i]); ra != rb {
+			return ra - rb
+		}
+		switch va := a[i].(type) {
+		case int64:
+			if vb := b[i].(int64); va != vb {
+				if va < vb {
+					return -1
+				}
+				return 1
+			}
+		case string:
+			if c := strings.Compare(va, b[i].(string)); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// summaryMetric is a per-member metric that is aggregated in the org
+// summary.
+type summaryMetric struct {
+	Name  string
+	Value func(memberReport) int
+}
+
+// summaryMetrics are the metrics aggregated in the org summary, in the
+// order they are reported.
+var summaryMetrics = []summaryMetric{
+	{"commits", func(r memberReport) int { return r.Commits }},
+	{"coAuthoredCommits", func(r memberReport) int { return r.CoAuthoredCommits }},
+	{"additions", func(r memberReport) int { return r.Additions }},
+	{"deletions", func(r memberReport) int { return r.Deletions }},
+	{"churn", func(r memberReport) int { return r.Additions + r.Deletions }},
+	{"effectiveAdditions", func(r memberReport) int { return r.EffectiveAdditions }},
+	{"effectiveDeletions", func(r memberReport) int { return r.EffectiveDeletions }},
+	{"effectiveChurn", func(r memberReport) int {
+		return r.EffectiveAdditions + r.EffectiveDeletions
+	}},
+	{"issuesCreated", func(r memberReport) int { return r.IssuesCreated }},
+	{"pullRequestsCreated", func(r memberReport) int { return r.PullRequestsCreated }},
+	{"pullRequestsMerged", func(r memberReport) int { return r.PullRequestsMerged }},
+	{"reviews", func(r memberReport) int { return r.Reviews }},
+	{"reviewComments", func(r memberReport) int { return r.ReviewComments }},
+	{"pullRequestsReviewed", func(r memberReport) int { return r.PullRequestsReviewed }},
+}
+
+// leaderboardMetrics are the names of the metrics with leaderboards.
+var leaderboardMetrics = []string{
+	"commits",
+	"churn",
+	"reviews",
+	"pullRequestsMerged",
+}
+
+// orgSummary is the aggregate activity of the reported members.
+type orgSummary struct {
+	// Members is the number of reported members.
+	Members int `json:"members"`
+
+	// ActiveContributors is the number of members with any commits,
+	// issues, pull requests or reviews.
+	ActiveContributors int `json:"activeContributors"`
+
+	// Committers, PullRequestAuthors and Reviewers are the number of
+	// members with at least one authored commit, pull request or review.
+	Committers         int `json:"committers"`
+	PullRequestAuthors int `json:"pullRequestAuthors"`
+	Reviewers          int `json:"reviewers"`
+
+	// Totals are the sums of the metrics, keyed by metric.
+	Totals map[string]int `json:"totals"`
+
+	// Distributions are the per-member distributions of the metrics
+	// among the active contributors, keyed by metric.
+	Distributions map[string]distribution `json:"distributions"`
+
+	// Leaderboards are the members with the highest values of the
+	// leaderboard metrics, keyed by metric.
+	Leaderboards map[string][]leaderboardEntry `json:"leaderboards"`
+}
+
+// distribution is the distribution of a metric. The percentiles use the
+// nearest-rank method.
+type distribution struct {
+	Median int `json:"median"`
+	P75    int `json:"p75"`
+	P90    int `json:"p90"`
+	Max    int `json:"max"`
+}
+
+type leaderboardEntry struct {
+	Login string `json:"login"`
+	Value int    `json:"value"`
+}
+
+// summarizer accumulates the reported members to compute the org summary
+// after the last member is reported.
+type summarizer struct {
+	members []memberReport
+}
+
+func (s *summarizer) add(r memberReport) {
+	// The details are not needed for the summary.
+	r.CommitDetails, r.Areas = nil, nil
+	s.members = append(s.members, r)
+}
+
+func (s *summarizer) summary(opts options) orgSummary {
+	sum := orgSummary{
+		Members:       len(s.members),
+		Totals:        map[string]int{},
+		Distributions: map[string]distribution{},
+		Leaderboards:  map[string][]leaderboardEntry{},
+	}
+
+	var active []memberReport
+	for _, r := range s.members {
+		if !r.hasActivity() {
+			continue
+		}
+		active = append(active, r)
+		if r.Commits > 0 {
+			sum.Committers++
+		}
+		if r.PullRequestsCreated > 0 {
+			sum.PullRequestAuthors++
+		}
+		if r.Reviews > 0 {
+			sum.Reviewers++
+		}
+	}
+	sum.ActiveContributors = len(active)
+
+	for _, metric := range summaryMetrics {
+		values := make([]int, len(active))
+		for i, r := range active {
+			values[i] = metric.Value(r)
+			sum.Totals[metric.Name] += values[i]
+		}
+		sort.Ints(values)
+		sum.Distributions[metric.Name] = distribution{
+			Median: percentile(values, 50),
+			P75:    percentile(values, 75),
+			P90:    percentile(values, 90),
+			Max:    percentile(values, 100),
+		}
+	}
+
+	for _, name := range leaderboardMetrics {
+		metric, ok := findSummaryMetric(name)
+		if !ok {
+			continue
+		}
+		sum.Leaderboards[name] = leaderboard(active, metric, opts.config.Top)
+	}
+	return sum
+}
+
+func findSummaryMetric(name string) (summaryMetric, bool) {
+	for _, metric := range summaryMetrics {
+		if metric.Name == name {
+			return metric, true
+		}
+	}
+	return summaryMetric{}, false
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// leaderboard returns the top members by the metric. Members without any
+// activity for the metric are omitted, and ties are ordered by login.
+func leaderboard(
+	members []memberReport, metric summaryMetric, top int) []leaderboardEntry {
+
+	entries := []leaderboardEntry{}
+	for _, r := range members {
+		if v := metric.Value(r); v > 0 {
+			entries = append(entries, leaderboardEntry{Login: r.Login, Value: v})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Login < entries[j].Login
+	})
+	if top > 0 && len(entries) > top {
+		entries = entries[:top]
+	}
+	return entries
+}
+
+var csvSummaryReportHeader = []string{
+	"section",
+	"metric",
+	"rank",
+	"login",
+	"value",
+}
+
+// encodeCSV writes the summary as long-format CSV.
+//
+//	section,metric,rank,login,value
+//	org,activeContributors,,,42
+//	total,commits,,,1234
+//	median,commits,,,12
+//	leaderboard,commits,1,akutz,321
+func (sum orgSummary) encodeCSV(w io.Writer) error {
+	csvw := csv.NewWriter(w)
+	csvw.Write(csvSummaryReportHeader)
+	for _, c := range []struct {
+		name  string
+		value int
+	}{
+		{"members", sum.Members},
+		{"activeContributors", sum.ActiveContributors},
+		{"committers", sum.Committers},
+		{"pullRequestAuthors", sum.PullRequestAuthors},
+		{"reviewers", sum.Reviewers},
+	} {
+		csvw.Write([]string{"org", c.name, "", "", strconv.Itoa(c.value)})
+	}
+	for _, metric := range summaryMetrics {
+		d := sum.Distributions[metric.Name]
+		for _, stat := range []struct {
+			section string
+			value   int
+		}{
+			{"total", sum.Totals[metric.Name]},
+			{"median", d.Median},
+			{"p75", d.P75},
+			{"p90", d.P90},
+			{"max", d.Max},
+		} {
+			csvw.Write([]string{
+				stat.section, metric.Name, "", "", strconv.Itoa(stat.value),
+			})
+		}
+	}
+	for _, name := range leaderboardMetrics {
+		for i, e := range sum.Leaderboards[name] {
+			csvw.Write([]string{
+				"leaderboard", name, strconv.Itoa(i + 1), e.Login,
+				strconv.Itoa(e.Value),
+			})
+		}
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
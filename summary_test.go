@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrgSummary(t *testing.T) {
+	var opts options
+	opts.config.Top = 2
+
+	summ := &summarizer{}
+	for _, r := range []memberReport{
+		{Login: "akutz", Commits: 10, Additions: 100, Deletions: 50, Reviews: 1},
+		{Login: "bob", Commits: 5, Additions: 500, PullRequestsCreated: 2,
+			PullRequestsMerged: 1},
+		{Login: "carol", Commits: 5, Reviews: 7},
+		{Login: "dave", Commits: 1},
+		{Login: "eve"},
+	} {
+		summ.add(r)
+	}
+	sum := summ.summary(opts)
+
+	if sum.Members != 5 || sum.ActiveContributors != 4 ||
+		sum.Committers != 4 || sum.PullRequestAuthors != 1 ||
+		sum.Reviewers != 2 {
+		t.Errorf("summary=%+v", sum)
+	}
+	if n := sum.Totals["commits"]; n != 21 {
+		t.Errorf("total commits=%d, expected 21", n)
+	}
+	if d := sum.Distributions["commits"]; d.Median != 5 ||
+		d.P75 != 5 || d.P90 != 10 || d.Max != 10 {
+		t.Errorf("commits distribution=%+v", d)
+	}
+
+	testCases := map[string]string{
+		"commits":            "akutz=10,bob=5",
+		"churn":              "bob=500,akutz=150",
+		"reviews":            "carol=7,akutz=1",
+		"pullRequestsMerged": "bob=1",
+	}
+	for metric, exp := range testCases {
+		var entries []string
+		for _, e := range sum.Leaderboards[metric] {
+			entries = append(entries, e.Login+"="+strconv.Itoa(e.Value))
+		}
+		if s := strings.Join(entries, ","); s != exp {
+			t.Errorf("leaderboard %s=%s, expected %s", metric, s, exp)
+		}
+	}
+	for _, name := range leaderboardMetrics {
+		if _, ok := findSummaryMetric(name); !ok {
+			t.Errorf("unknown leaderboard metric: %s", name)
+		}
+	}
+	if _, ok := findSummaryMetric("unknown"); ok {
+		t.Error("exp unknown metric to not be found")
+	}
+
+	w := &bytes.Buffer{}
+	if err := sum.encodeCSV(w); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"org,activeContributors,,,4\n",
+		"total,commits,,,21\n",
+		"leaderboard,churn,1,bob,500\n",
+	} {
+		if !strings.Contains(w.String(), s) {
+			t.Errorf("csv is missing %q", s)
+		}
+	}
+}
+
+func TestWriteReportSummary(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The report is also written to stdout, and the path of the summary
+	// to stderr.
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	outr, outw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errr, errw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, os.Stderr = outw, errw
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+	opts.config.Format = formatCSV
+	opts.config.Top = 10
+	if opts.exclusions, err = newExclusions(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	chanMembers := make(chan member, 2)
+	chanMembers <- member{
+		Login: "akutz",
+		Commits: []changeset{{
+			Repo:       "vmware/impact",
+			Long:       "abc123",
+			AuthorDate: time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC),
+			Changes:    []changesetEntry{{Add: 3, Path: "main.go"}},
+		}},
+	}
+	chanMembers <- member{Login: "bob"}
+	close(chanMembers)
+
+	err = writeReport(context.Background(), chanMembers, opts)
+	os.Stdout, os.Stderr = stdout, stderr
+	outw.Close()
+	errw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The CSV on stdout has only the members, and the summary is found
+	// from the path on stderr.
+	records, err := csv.NewReader(outr).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 ||
+		records[1][0] != "akutz" || records[2][0] != "bob" {
+		t.Errorf("stdout=%v", records)
+	}
+	note, err := ioutil.ReadAll(errr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sumFilePath := path.Join(tmpDir, "report-summary.csv")
+	if exp := "summary written to " + sumFilePath + "\n"; string(note) != exp {
+		t.Errorf("stderr: exp=%q act=%q", exp, note)
+	}
+
+	buf, err := ioutil.ReadFile(sumFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"org,members,,,2\n",
+		"org,activeContributors,,,1\n",
+		"median,commits,,,1\n",
+	} {
+		if !strings.Contains(string(buf), s) {
+			t.Errorf("summary is missing %q:\n%s", s, buf)
+		}
+	}
+}
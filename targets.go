@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// target is a GitHub repository for which activity is collected.
+type target struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	GitDir string `json:"gitDir,omitempty"`
+	Head   string `json:"head,omitempty"`
+}
+
+func (t target) String() string {
+	return fmt.Sprintf("%s/%s", t.Org, t.Repo)
+}
+
+// stringSliceFlag is a flag.Value that may be specified multiple times.
+// Each occurrence may also be a comma-separated list of values.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(v string) error {
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			*s = append(*s, e)
+		}
+	}
+	return nil
+}
+
+// defaultStringSliceFlag is a stringSliceFlag whose default value, such as
+// one from a config file, is replaced rather than appended to the first
+// time the flag is set.
+type defaultStringSliceFlag struct {
+	values *[]string
+	set    bool
+}
+
+func newDefaultStringSliceFlag(values *[]string) *defaultStringSliceFlag {
+	return &defaultStringSliceFlag{values: values}
+}
+
+func (s *defaultStringSliceFlag) String() string {
+	if s == nil || s.values == nil {
+		return ""
+	}
+	return (*stringSliceFlag)(s.values).String()
+}
+
+func (s *defaultStringSliceFlag) Set(v string) error {
+	if !s.set {
+		*s.values = nil
+		s.set = true
+	}
+	return (*stringSliceFlag)(s.values).Set(v)
+}
+
+// parseTarget parses a target in the format ORG/REPO[=GIT_DIR]. The
+// REPO may be "*" to select all of the org's repositories.
+func parseTarget(s string) (target, error) {
+	var t target
+	if i := strings.Index(s, "="); i >= 0 {
+		s, t.GitDir = s[:i], s[i+1:]
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return target{}, fmt.Errorf("invalid target: %s", s)
+	}
+	t.Org, t.Repo = parts[0], parts[1]
+	return t, nil
+}
+
+// defaultRepo is the repository named by -target-org and -target-repo.
+// Cached activity collected before multiple targets were supported
+// belongs to this repository.
+func (c config) defaultRepo() string {
+	return target{Org: c.TargetOrg, Repo: c.TargetRepo}.String()
+}
+
+// getTargets returns the targeted repositories with all wildcards
+// expanded and their git directories.
+func getTargets(ctx context.Context, opts options) ([]target, error) {
+	var specs []target
+	if len(opts.config.Targets) == 0 {
+		specs = append(specs, target{
+			Org:    opts.config.TargetOrg,
+			Repo:   opts.config.TargetRepo,
+			GitDir: opts.config.Git.TargetDir,
+		})
+	} else {
+		for _, s := range opts.config.Targets {
+			t, err := parseTarget(s)
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, t)
+		}
+	}
+
+	var (
+		targets []target
+		known   = map[string]struct{}{}
+	)
+	add := func(t target) {
+		if _, ok := known[t.String()]; ok {
+			return
+		}
+		known[t.String()] = struct{}{}
+		targets = append(targets, t)
+	}
+
+	for _, t := range specs {
+		if t.Repo != "*" {
+			add(t)
+			continue
+		}
+		repos, err := getOrgRepos(ctx, t.Org, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			add(target{Org: t.Org, Repo: repo})
+		}
+	}
+
+	// The cached members are reported without their targets' commits,
+	// so the mirrors are not needed to report them as they are.
+	if opts.config.Git.Disabled || opts.readOnly {
+		return targets, nil
+	}
+
+	// The targets whose mirrors failed to sync are still reported.
+	if err := syncMirrors(ctx, targets, opts); err != nil {
+		if _, ok := err.(mirrorErrors); !ok {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+	for i := range targets {
+		if targets[i].GitDir == "" {
+			continue
+		}
+		head, err := gitHead(ctx, opts, targets[i].GitDir)
+		if err != nil {
+			return nil, err
+		}
+		targets[i].Head = head
+	}
+	if opts.config.Debug {
+		for _, t := range targets {
+			log.Printf("target=%s, git-dir=%s, head=%s", t, t.GitDir, t.Head)
+		}
+	}
+
+	return targets, nil
+}
+
+// defaultGitDir returns the path to the target's git directory inside
+// the GOPATH or an empty string if the directory does not exist.
+func defaultGitDir(t target) string {
+	goPath := getGoPath()
+	if goPath == "" {
+		return ""
+	}
+	gitDir := path.Join(goPath, "src", "github.com", t.Org, t.Repo, ".git")
+	if ok, _ := fileExists(gitDir); !ok {
+		return ""
+	}
+	return gitDir
+}
+
+func orgReposFilePath(org string, opts options) string {
+	return path.Join(opts.config.OutputDir, ".cache", "repos", org+".json")
+}
+
+// getOrgRepos returns the names of the org's repositories. The names are
+// fetched with the GitHub API when it is available and read from the
+// local cache otherwise. Forks and archived repositories are ignored.
+func getOrgRepos(
+	ctx context.Context, org string, opts options) ([]string, error) {
+
+	filePath := orgReposFilePath(org, opts)
+
+	if opts.github == nil {
+		f, err := os.Open(filePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf(
+					"cannot expand %s/* offline: no cached repositories", org)
+			}
+			return nil, err
+		}
+		defer f.Close()
+		var repos []string
+		if err := json.NewDecoder(f).Decode(&repos); err != nil {
+			return nil, err
+		}
+		return repos, nil
+	}
+
+	var repos []string
+
+	listOpts := &github.RepositoryListByOrgOptions{
+		Type:        "sources",
+		ListOptions: github.ListOptions{Page: 1},
+	}
+
+	retries := 0
+
+	for ctx.Err() == nil && listOpts.Page > 0 {
+		opts.api.wait(ctx)
+		page, rep, err := opts.github.Repositories.ListByOrg(
+			ctx, org, listOpts)
+		opts.api.done(rep)
+		if err != nil {
+			if opts.api.retry(ctx, rep, err, &retries) {
+				continue
+			}
+			return nil, err
+		}
+		for _, r := range page {
+			if r.GetArchived() || r.GetFork() || r.GetName() == "" {
+				continue
+			}
+			repos = append(repos, r.GetName())
+		}
+		listOpts.Page = rep.NextPage
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(repos)
+
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(repos); err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		exp target
+		err bool
+	}{
+		{s: "vmware/impact", exp: target{Org: "vmware", Repo: "impact"}},
+		{s: "vmware/*", exp: target{Org: "vmware", Repo: "*"}},
+		{
+			s:   "vmware/impact=/src/impact/.git",
+			exp: target{Org: "vmware", Repo: "impact", GitDir: "/src/impact/.git"},
+		},
+		{
+			s:   "vmware/*=/src/.git",
+			exp: target{Org: "vmware", Repo: "*", GitDir: "/src/.git"},
+		},
+		{s: "", err: true},
+		{s: "vmware", err: true},
+		{s: "vmware/", err: true},
+		{s: "/impact", err: true},
+		{s: "/", err: true},
+		{s: "vmware/impact/extra", err: true},
+		{s: "=/src/impact/.git", err: true},
+	} {
+		act, err := parseTarget(tc.s)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: exp error, act=%+v", tc.s, act)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.s, err)
+			continue
+		}
+		if act != tc.exp {
+			t.Errorf("%q: exp=%+v act=%+v", tc.s, tc.exp, act)
+		}
+	}
+}
+
+func TestGetTargets(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.OutputDir = tmpDir
+	opts.config.Git.Disabled = true
+
+	// The wildcards are expanded offline from the cached repositories.
+	filePath := orgReposFilePath("vmware", opts)
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := json.Marshal([]string{"impact", "other"})
+	if err := ioutil.WriteFile(filePath, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		targets []string
+		exp     string
+		err     bool
+	}{
+		{
+			name:    "repo",
+			targets: []string{"vmware/impact"},
+			exp:     "[vmware/impact=]",
+		},
+		{
+			name:    "wildcard",
+			targets: []string{"vmware/*"},
+			exp:     "[vmware/impact= vmware/other=]",
+		},
+		{
+			name:    "repeated",
+			targets: []string{"vmware/impact", "vmware/impact=/src/.git"},
+			exp:     "[vmware/impact=]",
+		},
+		{
+			name:    "repo then wildcard",
+			targets: []string{"vmware/other=/src/.git", "vmware/*"},
+			exp:     "[vmware/other=/src/.git vmware/impact=]",
+		},
+		{
+			name:    "wildcard then repo",
+			targets: []string{"vmware/*", "vmware/other=/src/.git"},
+			exp:     "[vmware/impact= vmware/other=]",
+		},
+		{
+			name:    "repeated wildcard",
+			targets: []string{"vmware/*", "vmware/*", "akutz/impact"},
+			exp:     "[vmware/impact= vmware/other= akutz/impact=]",
+		},
+		{
+			name:    "uncached org",
+			targets: []string{"akutz/*"},
+			err:     true,
+		},
+		{
+			name:    "malformed",
+			targets: []string{"vmware/impact", "vmware"},
+			err:     true,
+		},
+	} {
+		opts.config.Targets = tc.targets
+		targets, err := getTargets(context.Background(), opts)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: exp error, act=%v", tc.name, targets)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		var act []string
+		for _, tgt := range targets {
+			act = append(act, fmt.Sprintf("%s=%s", tgt, tgt.GitDir))
+		}
+		if fmt.Sprint(act) != tc.exp {
+			t.Errorf("%s: exp=%s act=%v", tc.name, tc.exp, act)
+		}
+	}
+}
+
+func TestGetTargetsReadOnly(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The git directory does not exist, so finding its HEAD fails unless
+	// the cached members are reported as they are.
+	var opts options
+	opts.config.OutputDir = tmpDir
+	opts.chanGit = make(chan struct{}, 1)
+	opts.config.Targets = []string{
+		"vmware/impact=" + path.Join(tmpDir, "impact.git"),
+	}
+	if _, err := getTargets(context.Background(), opts); err == nil {
+		t.Error("exp error")
+	}
+
+	opts.readOnly = true
+	targets, err := getTargets(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].Head != "" {
+		t.Errorf("targets=%+v", targets)
+	}
+}
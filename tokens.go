@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// getAPITokens returns the GitHub API keys in the comma-separated
+// environment variable GITHUB_API_KEY and in the token file, which has
+// one key per line. Blank lines and lines that begin with # are ignored.
+func getAPITokens(opts options) ([]string, error) {
+	var tokens []string
+	for _, t := range strings.Split(os.Getenv("GITHUB_API_KEY"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+
+	if opts.config.GitHub.TokenFile == "" {
+		return tokens, nil
+	}
+	f, err := os.Open(opts.config.GitHub.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scn := bufio.NewScanner(f)
+	for scn.Scan() {
+		t := strings.TrimSpace(scn.Text())
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// credentialTokenSource is a token source whose tokens change, such as a
+// GitHub App's installation tokens, and the stable identity of the
+// credentials they are issued for.
+type credentialTokenSource struct {
+	oauth2.TokenSource
+	id string
+}
+
+// apiToken is one of the tokens used to authenticate API calls and its
+// most recent rate limit.
+type apiToken struct {
+	name   string
+	source oauth2.TokenSource
+
+	// limit and remaining are -1 until the token is used.
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// available returns the number of API calls the token may make at the
+// given time. A token that has not been used, or whose rate limit has
+// been reset, has its full limit.
+func (t *apiToken) available(at time.Time, defaultLimit int) int {
+	switch {
+	case t.remaining < 0:
+		return defaultLimit
+	case !t.reset.After(at):
+		if t.limit > 0 {
+			return t.limit
+		}
+		return defaultLimit
+	}
+	return t.remaining
+}
+
+// credential returns the identity of the credentials of the token, which
+// is the fingerprint of a token that does not change.
+func (t *apiToken) credential(tok *oauth2.Token) string {
+	if src, ok := t.source.(credentialTokenSource); ok {
+		return src.id
+	}
+	sum := sha256.Sum256([]byte(tok.AccessToken))
+	return "token " + hex.EncodeToString(sum[:8])
+}
+
+// tokenPool authenticates each API call with the token that has the most
+// remaining calls, and reports the tokens' combined rate limit.
+type tokenPool struct {
+	sync.Mutex
+	tokens []*apiToken
+	base   http.RoundTripper
+	now    func() time.Time
+}
+
+func newTokenPool(
+	sources []oauth2.TokenSource, base http.RoundTripper) *tokenPool {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	p := &tokenPool{base: base, now: time.Now}
+	for i, src := range sources {
+		p.tokens = append(p.tokens, &apiToken{
+			name:      fmt.Sprintf("token %d", i+1),
+			source:    src,
+			limit:     -1,
+			remaining: -1,
+		})
+	}
+	return p
+}
+
+// defaultLimit is the limit assumed for the tokens that have not been
+// used yet, which is the largest known limit of the other tokens.
+func (p *tokenPool) defaultLimit() int {
+	limit := 0
+	for _, t := range p.tokens {
+		if t.limit > limit {
+			limit = t.limit
+		}
+	}
+	if limit == 0 {
+		// GitHub's rate limit for authenticated requests.
+		limit = 5000
+	}
+	return limit
+}
+
+// pick returns the token with the most remaining calls, or if all of them
+// are exhausted, the token whose limit is reset first.
+func (p *tokenPool) pick() *apiToken {
+	p.Lock()
+	defer p.Unlock()
+
+	var (
+		now          = p.now()
+		defaultLimit = p.defaultLimit()
+		best         *apiToken
+		bestN        int
+	)
+	for _, t := range p.tokens {
+		n := t.available(now, defaultLimit)
+		switch {
+		case best == nil,
+			n > bestN,
+			n == 0 && bestN == 0 && t.reset.Before(best.reset):
+			best, bestN = t, n
+		}
+	}
+	// The remaining calls are decremented before the response so that
+	// concurrent calls are spread across the tokens.
+	if best.remaining > 0 && best.reset.After(now) {
+		best.remaining--
+	}
+	return best
+}
+
+// update records the rate limit in the response headers for the token and
+// replaces the headers with the pool's combined rate limit.
+func (p *tokenPool) update(t *apiToken, h http.Header) {
+	limit, err1 := strconv.Atoi(h.Get(headerRateLimit))
+	remaining, err2 := strconv.Atoi(h.Get(headerRateRemaining))
+	reset, err3 := strconv.ParseInt(h.Get(headerRateReset), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	wasExhausted := t.remaining == 0 && t.reset.After(p.now())
+	t.limit, t.remaining, t.reset = limit, remaining, time.Unix(reset, 0)
+	if remaining == 0 && !wasExhausted && len(p.tokens) > 1 {
+		fmt.Fprintf(
+			os.Stderr, "%s exceeded its rate limit until %s\n",
+			t.name, t.reset.Format(time.RFC3339))
+	}
+
+	if len(p.tokens) == 1 {
+		return
+	}
+
+	// The combined limit is the sum of the tokens' limits and calls. It is
+	// reset when the last token is reset, unless all of the tokens are
+	// exhausted, in which case it is reset when the first token is.
+	var (
+		now          = p.now()
+		defaultLimit = p.defaultLimit()
+		sumLimit     int
+		sumRemaining int
+		first, last  time.Time
+	)
+	for _, t := range p.tokens {
+		if t.limit > 0 {
+			sumLimit += t.limit
+		} else {
+			sumLimit += defaultLimit
+		}
+		sumRemaining += t.available(now, defaultLimit)
+		if t.reset.After(now) {
+			if first.IsZero() || t.reset.Before(first) {
+				first = t.reset
+			}
+			if t.reset.After(last) {
+				last = t.reset
+			}
+		}
+	}
+	combinedReset := last
+	if sumRemaining == 0 {
+		combinedReset = first
+	}
+	if combinedReset.IsZero() {
+		combinedReset = t.reset
+	}
+	h.Set(headerRateLimit, strconv.Itoa(sumLimit))
+	h.Set(headerRateRemaining, strconv.Itoa(sumRemaining))
+	h.Set(headerRateReset, strconv.FormatInt(combinedReset.Unix(), 10))
+}
+
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+)
+
+func (p *tokenPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		t := p.pick()
+		tok, err := t.source.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %v", t.name, err)
+		}
+
+		// The Authorization header is set on a copy of the request.
+		areq := req.WithContext(
+			withHTTPCredential(req.Context(), t.credential(tok)))
+		areq.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			areq.Header[k] = v
+		}
+		tok.SetAuthHeader(areq)
+
+		// The body of a request that is made again is read from GetBody
+		// since the first attempt read it.
+		if attempt > 1 && req.Body != nil {
+			if areq.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		rep, err := p.base.RoundTrip(areq)
+		if err != nil {
+			return nil, err
+		}
+		exceeded := rep.StatusCode == http.StatusForbidden &&
+			rep.Header.Get(headerRateRemaining) == "0"
+		p.update(t, rep.Header)
+
+		// If the token exceeded its rate limit but the pool has not, then
+		// the request is made again with another token. A request whose
+		// body cannot be read again is not repeated.
+		if exceeded && (req.Body == nil || req.GetBody != nil) &&
+			attempt < len(p.tokens) &&
+			rep.Header.Get(headerRateRemaining) != "0" {
+			rep.Body.Close()
+			continue
+		}
+		return rep, nil
+	}
+}
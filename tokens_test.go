@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestGetAPITokens(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "github-impact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var opts options
+	opts.config.GitHub.TokenFile = path.Join(tmpDir, "tokens")
+	if err := ioutil.WriteFile(
+		opts.config.GitHub.TokenFile,
+		[]byte("# team tokens\nc\n\n  d  \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GITHUB_API_KEY", "a, b,")
+	defer os.Unsetenv("GITHUB_API_KEY")
+
+	tokens, err := getAPITokens(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(tokens, exp) {
+		t.Fatalf("exp=%v act=%v", exp, tokens)
+	}
+}
+
+func TestTokenPool(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	remaining := map[string]int{"a": 1, "b": 2}
+	var used, bodies []string
+
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			used = append(used, token)
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.Header().Set(headerRateLimit, "5")
+			w.Header().Set(headerRateReset, fmt.Sprint(reset))
+			if remaining[token] == 0 {
+				w.Header().Set(headerRateRemaining, "0")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			remaining[token]--
+			w.Header().Set(headerRateRemaining, fmt.Sprint(remaining[token]))
+		}))
+	defer s.Close()
+
+	var sources []oauth2.TokenSource
+	for _, token := range []string{"a", "b"} {
+		sources = append(sources,
+			oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	}
+	client := &http.Client{Transport: newTokenPool(sources, nil)}
+
+	get := func() (int, string) {
+		rep, err := client.Get(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep.Body.Close()
+		return rep.StatusCode, rep.Header.Get(headerRateRemaining)
+	}
+
+	for i, exp := range []struct {
+		status    int
+		remaining string
+	}{
+		// The tokens have not been used, so the first token is used.
+		// Neither token's remaining calls are known, so the second
+		// token is assumed to have all of its calls.
+		{http.StatusOK, "5"},
+		// The second token has the most remaining calls.
+		{http.StatusOK, "1"},
+		// The first token is not used again since it was exhausted, so
+		// the second token is used.
+		{http.StatusOK, "0"},
+		// All of the tokens are exhausted.
+		{http.StatusForbidden, "0"},
+	} {
+		status, remaining := get()
+		if status != exp.status || remaining != exp.remaining {
+			t.Errorf("%d: exp=%d/%s act=%d/%s",
+				i, exp.status, exp.remaining, status, remaining)
+		}
+	}
+	if exp := []string{"a", "b", "b", "a"}; !reflect.DeepEqual(used, exp) {
+		t.Fatalf("used: exp=%v act=%v", exp, used)
+	}
+
+	// A token that is exhausted before the pool knows it is retried with
+	// another token.
+	remaining, used = map[string]int{"a": 0, "b": 1}, nil
+	client.Transport = newTokenPool(sources, nil)
+	if status, remaining := get(); status != http.StatusOK || remaining != "0" {
+		t.Errorf("rotate: status=%d remaining=%s", status, remaining)
+	}
+	if exp := []string{"a", "b"}; !reflect.DeepEqual(used, exp) {
+		t.Fatalf("rotate: used: exp=%v act=%v", exp, used)
+	}
+
+	// The body of a request that is retried with another token is sent
+	// again.
+	remaining, used, bodies = map[string]int{"a": 0, "b": 1}, nil, nil
+	client.Transport = newTokenPool(sources, nil)
+	rep, err := client.Post(s.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.Body.Close()
+	if rep.StatusCode != http.StatusOK {
+		t.Errorf("body: status=%d", rep.StatusCode)
+	}
+	if exp := []string{"a", "b"}; !reflect.DeepEqual(used, exp) {
+		t.Fatalf("body: used: exp=%v act=%v", exp, used)
+	}
+	if exp := []string{"body", "body"}; !reflect.DeepEqual(bodies, exp) {
+		t.Errorf("body: exp=%q act=%q", exp, bodies)
+	}
+}
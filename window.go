@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// windowTimeFormats are the formats accepted by -since and -until.
+var windowTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseWindowTime parses the value of -since or -until. Values without a
+// time zone are in UTC if -utc is set, otherwise they are in the local
+// time zone.
+func parseWindowTime(s string, opts options) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	loc := time.Local
+	if opts.config.UTC {
+		loc = time.UTC
+	}
+	for _, layout := range windowTimeFormats {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time: %s", s)
+}
+
+// inWindow returns a flag indicating whether or not the time is at or
+// after -since and before -until.
+func inWindow(t time.Time, opts options) bool {
+	return inTimeWindow(t, opts.config.Since, opts.config.Until)
+}
+
+// inTimeWindow returns a flag indicating whether or not the time is at or
+// after since and before until. A nil since or until is unbounded.
+func inTimeWindow(t time.Time, since, until *time.Time) bool {
+	if since != nil && t.Before(*since) {
+		return false
+	}
+	if until != nil && !t.Before(*until) {
+		return false
+	}
+	return true
+}
+
+// windowCovers returns a flag indicating whether or not the window from
+// since to until includes the window from otherSince to otherUntil.
+func windowCovers(since, until, otherSince, otherUntil *time.Time) bool {
+	if since != nil && (otherSince == nil || otherSince.Before(*since)) {
+		return false
+	}
+	if until != nil && (otherUntil == nil || otherUntil.After(*until)) {
+		return false
+	}
+	return true
+}
+
+// forWindow returns a copy of the member with only the activity that
+// occurred between -since and -until.
+func (m member) forWindow(opts options) member {
+	if opts.config.Since == nil && opts.config.Until == nil {
+		return m
+	}
+	r := m
+	r.Commits, r.Issues, r.Reviews, r.ReviewComments = nil, nil, nil, nil
+	for _, c := range m.Commits {
+		if inWindow(c.AuthorDate, opts) {
+			r.Commits = append(r.Commits, c)
+		}
+	}
+	for _, i := range m.Issues {
+		if i.CreatedAt != nil && inWindow(*i.CreatedAt, opts) {
+			r.Issues = append(r.Issues, i)
+		}
+	}
+	for _, rv := range m.Reviews {
+		if rv.SubmittedAt != nil && inWindow(*rv.SubmittedAt, opts) {
+			r.Reviews = append(r.Reviews, rv)
+		}
+	}
+	for _, c := range m.ReviewComments {
+		if c.CreatedAt != nil && inWindow(*c.CreatedAt, opts) {
+			r.ReviewComments = append(r.ReviewComments, c)
+		}
+	}
+	return r
+}
+
+// reportMetadata describes how a report was generated so that reports
+// from different runs may be compared.
+type reportMetadata struct {
+	GeneratedAt time.Time  `json:"generatedAt"`
+	Args        []string   `json:"args,omitempty"`
+	MemberOrg   string     `json:"memberOrg"`
+	Targets     []string   `json:"targets"`
+	Since       *time.Time `json:"since,omitempty"`
+	Until       *time.Time `json:"until,omitempty"`
+	Period      string     `json:"period,omitempty"`
+	UTC         bool       `json:"utc"`
+}
+
+func newReportMetadata(opts options) reportMetadata {
+	md := reportMetadata{
+		GeneratedAt: time.Now(),
+		Args:        opts.config.Args,
+		MemberOrg:   opts.config.MemberOrg,
+		Since:       opts.config.Since,
+		Until:       opts.config.Until,
+		Period:      opts.config.Period,
+		UTC:         opts.config.UTC,
+	}
+	if opts.config.UTC {
+		md.GeneratedAt = md.GeneratedAt.UTC()
+	}
+	for _, t := range opts.targets {
+		md.Targets = append(md.Targets, t.String())
+	}
+	return md
+}
+
+func writeReportMetadata(reportName string, opts options) error {
+	filePath := path.Join(
+		opts.config.OutputDir, fmt.Sprintf("%s-metadata.json", reportName))
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(newReportMetadata(opts))
+}
+
+// formatWindowTime formats a time parsed by parseWindowTime so that it may
+// be parsed again, ex. as the default value of -since.
+func formatWindowTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
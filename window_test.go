@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForWindow(t *testing.T) {
+	var opts options
+	opts.config.UTC = true
+
+	var err error
+	if opts.config.Since, err = parseWindowTime("2018-07-01", opts); err != nil {
+		t.Fatal(err)
+	}
+	if opts.config.Until, err = parseWindowTime(
+		"2018-10-01T00:00:00Z", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseWindowTime("07/01/2018", opts); err == nil {
+		t.Error("expected invalid time error")
+	}
+
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(2018, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	created := date(time.August, 1)
+
+	m := member{
+		Login: "akutz",
+		Commits: []changeset{
+			{Subject: "before", AuthorDate: date(time.June, 30)},
+			{Subject: "since", AuthorDate: date(time.July, 1)},
+			{Subject: "until", AuthorDate: date(time.October, 1)},
+		},
+		Issues: []issue{
+			{Number: 1, CreatedAt: &created},
+			{Number: 2},
+		},
+		Reviews: []review{
+			{ID: 1, PullRequest: 1, State: reviewApproved, SubmittedAt: &created},
+			{ID: 2, PullRequest: 2, State: reviewCommented},
+		},
+		ReviewComments: []reviewComment{
+			{ID: 1, PullRequest: 1, CreatedAt: &created},
+			{ID: 2, PullRequest: 3},
+		},
+	}
+
+	w := m.forWindow(opts)
+	if len(w.Commits) != 1 || w.Commits[0].Subject != "since" {
+		t.Errorf("commits=%+v", w.Commits)
+	}
+	if len(w.Issues) != 1 || w.Issues[0].Number != 1 {
+		t.Errorf("issues=%+v", w.Issues)
+	}
+	exp := reviewReport{
+		Reviews: 1, Approved: 1, Comments: 1, PullRequestsReviewed: 1}
+	if act := w.reviewReport(); act != exp {
+		t.Errorf("reviews: exp=%+v act=%+v", exp, act)
+	}
+	if len(m.Commits) != 3 {
+		t.Errorf("len(m.Commits)=%d, expected 3", len(m.Commits))
+	}
+}
+
+func TestWindowCovers(t *testing.T) {
+	at := func(month time.Month) *time.Time {
+		t := time.Date(2018, month, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	for i, tc := range []struct {
+		since, until           *time.Time
+		otherSince, otherUntil *time.Time
+		exp                    bool
+	}{
+		{nil, nil, nil, nil, true},
+		{nil, nil, at(7), at(10), true},
+		{at(7), at(10), at(7), at(10), true},
+		{at(7), at(10), at(8), at(9), true},
+		{at(7), at(10), nil, at(10), false},
+		{at(7), at(10), at(6), at(10), false},
+		{at(7), at(10), at(7), nil, false},
+		{at(7), at(10), at(7), at(11), false},
+	} {
+		if act := windowCovers(
+			tc.since, tc.until, tc.otherSince, tc.otherUntil); act != tc.exp {
+			t.Errorf("%d: exp=%v act=%v", i, tc.exp, act)
+		}
+	}
+}